@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/user/openchat/internal/config"
+	"github.com/user/openchat/internal/store"
+)
+
+// unlockAttempts is how many passphrases are tried before giving up
+const unlockAttempts = 3
+
+// stdin reads piped passphrases; it is shared so buffered lines aren't lost
+var stdin = bufio.NewReader(os.Stdin)
+
+// runDB runs a "chatui db" subcommand
+func runDB(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: chatui db encrypt")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "encrypt":
+		if err := encryptDB(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encrypt database: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown db command: %s\n", args[0])
+		fmt.Fprintln(os.Stderr, "Usage: chatui db encrypt")
+		os.Exit(1)
+	}
+}
+
+// encryptDB encrypts the chat database with a new passphrase
+func encryptDB() error {
+	// Loading the configuration creates ~/.chatui for a first run
+	if _, err := config.Load(); err != nil {
+		return err
+	}
+	dbPath, err := config.GetDBPath()
+	if err != nil {
+		return err
+	}
+	st, err := store.New(dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	if st.IsEncrypted() {
+		return errors.New("database is already encrypted")
+	}
+
+	fmt.Println("This encrypts messages, tool calls, citations, attachments, summaries,")
+	fmt.Println("system prompts and JSON schemas in")
+	fmt.Println(dbPath)
+	fmt.Println("Session names, tags, folders, attachment file names and paths, and usage")
+	fmt.Println("stay readable. Without the passphrase the content cannot be recovered,")
+	fmt.Println("and ChatUI asks for it at every launch.")
+	fmt.Println()
+
+	passphrase, err := readPassphrase("New passphrase: ")
+	if err != nil {
+		return err
+	}
+	if passphrase == "" {
+		return errors.New("passphrase is empty")
+	}
+	confirm, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return err
+	}
+	if confirm != passphrase {
+		return errors.New("passphrases do not match")
+	}
+
+	if err := st.Encrypt(passphrase); err != nil {
+		return err
+	}
+	fmt.Println("Database encrypted.")
+	return nil
+}
+
+// unlockStore asks for the passphrase of an encrypted database until it is
+// right or the attempts run out
+func unlockStore(st *store.Store) error {
+	for attempt := 1; ; attempt++ {
+		passphrase, err := readPassphrase("Database passphrase: ")
+		if err != nil {
+			return err
+		}
+		err = st.Unlock(passphrase)
+		if err == nil {
+			return nil
+		}
+		if err != store.ErrWrongPassphrase || attempt == unlockAttempts {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Wrong passphrase, try again.")
+	}
+}
+
+// readPassphrase prompts for a passphrase without echoing it. When stdin is
+// not a terminal it reads a line instead, so the passphrase can be piped in.
+func readPassphrase(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(passphrase), nil
+}
@@ -10,28 +10,35 @@
 // Usage:
 //
 //	chatui [flags]
+//	chatui db encrypt
 //
 // Environment Variables:
 //
 //	OPENAI_API_KEY     - OpenAI API key
 //	ANTHROPIC_API_KEY  - Anthropic API key
 //	GEMINI_API_KEY     - Google Gemini API key
-//	GROQ_API_KEY       - Groq API key (future)
-//	OPENROUTER_API_KEY - OpenRouter API key (future)
+//	GROQ_API_KEY       - Groq API key
+//	OPENROUTER_API_KEY - OpenRouter API key
+//	OLLAMA_HOST        - Ollama server address (default localhost:11434)
 package main
 
 import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"slices"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"github.com/user/openchat/internal/cassette"
 	"github.com/user/openchat/internal/config"
 	"github.com/user/openchat/internal/exporter"
 	"github.com/user/openchat/internal/provider"
 	"github.com/user/openchat/internal/store"
+	"github.com/user/openchat/internal/tools"
 	"github.com/user/openchat/internal/ui"
 )
 
@@ -44,6 +51,10 @@ func main() {
 	showVersion := flag.Bool("version", false, "Show version information")
 	showHelp := flag.Bool("help", false, "Show help information")
 	debugMode := flag.Bool("debug", false, "Enable debug mode (logs to file)")
+	recordPath := flag.String("record", "", "Record provider HTTP traffic to a cassette file")
+	replayPath := flag.String("replay", "", "Replay provider HTTP traffic from a cassette file")
+	useMock := flag.Bool("mock", false, "Start with the mock provider (no network or API key)")
+	mockScript := flag.String("mock-script", "", "Script file for the mock provider (implies --mock)")
 	flag.Parse()
 
 	if *showVersion {
@@ -56,8 +67,31 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Subcommands
+	if args := flag.Args(); len(args) > 0 {
+		if args[0] != "db" {
+			fmt.Fprintf(os.Stderr, "Unknown command: %s\n", args[0])
+			os.Exit(1)
+		}
+		runDB(args[1:])
+		return
+	}
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// --debug adds call logging to the configured middleware
+	middleware := cfg.GetMiddleware()
+	if *debugMode && !slices.Contains(middleware, "logging") {
+		middleware = append([]string{"logging"}, middleware...)
+	}
+
 	// Set up logging
-	if *debugMode {
+	if slices.Contains(middleware, "logging") {
 		configDir, err := config.GetConfigDir()
 		if err != nil {
 			log.Fatal("Failed to get config directory:", err)
@@ -68,20 +102,13 @@ func main() {
 		}
 		defer logFile.Close()
 		log.SetOutput(logFile)
-		log.Println("ChatUI starting in debug mode")
+		log.Println("ChatUI starting with call logging")
 	} else {
 		// Disable logging in normal mode (security: don't log API keys)
 		log.SetOutput(os.Stderr)
 		log.SetFlags(0)
 	}
 
-	// Load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
-		os.Exit(1)
-	}
-
 	// Initialize database
 	dbPath, err := config.GetDBPath()
 	if err != nil {
@@ -96,6 +123,21 @@ func main() {
 	}
 	defer st.Close()
 
+	// Unlock an encrypted database once for this run
+	if st.IsEncrypted() {
+		if err := unlockStore(st); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to unlock database: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Purge sessions that have been in the trash past the retention period
+	if retention := cfg.GetTrashRetention(); retention > 0 {
+		if _, err := st.PurgeTrash(time.Now().Add(-retention)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
 	// Initialize exporter
 	exportPath, err := cfg.GetExportPath()
 	if err != nil {
@@ -103,27 +145,146 @@ func main() {
 		os.Exit(1)
 	}
 	exp := exporter.New(exportPath, cfg.GitAutoCommit)
+	exp.SetIncludeReasoning(cfg.ExportReasoning)
 
-	// Initialize provider registry
+	// Record provider traffic to, or replay it from, a cassette file
+	httpClient := &http.Client{}
+	var recorder *cassette.Transport
+	switch {
+	case *recordPath != "" && *replayPath != "":
+		fmt.Fprintln(os.Stderr, "Use either --record or --replay, not both")
+		os.Exit(1)
+	case *recordPath != "":
+		recorder, err = cassette.New(*recordPath, cassette.ModeRecord)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open cassette: %v\n", err)
+			os.Exit(1)
+		}
+		httpClient = recorder.Client()
+	case *replayPath != "":
+		player, err := cassette.New(*replayPath, cassette.ModeReplay)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open cassette: %v\n", err)
+			os.Exit(1)
+		}
+		httpClient = player.Client()
+		// Recordings hold no keys, so any key will do
+		cfg.SetPlaceholderKey(cassette.Redacted)
+	}
+
+	// Initialize provider registry. Hosted providers are built for each
+	// request with the API key configured at that moment.
 	registry := provider.NewRegistry()
+	registry.SetKeyResolver(cfg.GetAPIKey)
 
 	// Register OpenAI provider
-	openaiKey := cfg.GetAPIKey("openai")
-	openaiProvider := provider.NewOpenAI(openaiKey)
-	registry.Register(openaiProvider)
+	registry.RegisterFactory("openai", func(s provider.Settings) provider.Provider {
+		return provider.NewOpenAIWithClient(s.APIKey, httpClient)
+	})
 
 	// Register Anthropic provider
-	anthropicKey := cfg.GetAPIKey("anthropic")
-	anthropicProvider := provider.NewAnthropic(anthropicKey)
-	registry.Register(anthropicProvider)
+	registry.RegisterFactory("anthropic", func(s provider.Settings) provider.Provider {
+		return provider.NewAnthropicWithClient(s.APIKey, httpClient)
+	})
 
 	// Register Gemini provider
-	geminiKey := cfg.GetAPIKey("gemini")
-	geminiProvider := provider.NewGemini(geminiKey)
-	registry.Register(geminiProvider)
+	registry.RegisterFactory("gemini", func(s provider.Settings) provider.Provider {
+		return provider.NewGeminiWithSettings(s, httpClient)
+	})
+
+	// Register OpenAI-compatible endpoints (Groq, OpenRouter and any from config)
+	for _, ep := range cfg.GetEndpoints() {
+		ep := ep
+		registry.RegisterFactory(ep.Name, func(s provider.Settings) provider.Provider {
+			return provider.NewOpenAICompatible(provider.OpenAICompatibleConfig{
+				Name:    ep.Name,
+				BaseURL: ep.BaseURL,
+				APIKey:  s.APIKey,
+				Headers: ep.Headers,
+				Models:  ep.Models,
+				Keyless: ep.APIKeyEnv == "",
+				Client:  httpClient,
+			})
+		})
+	}
+
+	// Register Ollama provider (local, no API key)
+	ollamaProvider := provider.NewOllamaWithClient(cfg.GetOllamaBaseURL(), httpClient)
+	registry.Register(ollamaProvider)
+
+	// Register the mock provider for demos and UI work
+	var script provider.MockScript
+	if *mockScript != "" {
+		script, err = provider.LoadMockScript(*mockScript)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load mock script: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	mockProvider, err := provider.NewMock(script)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load mock script: %v\n", err)
+		os.Exit(1)
+	}
+	registry.Register(mockProvider)
+	if *useMock || *mockScript != "" {
+		// Select it for this run without writing the config file
+		cfg.SetDefaultProvider(mockProvider.Name())
+		cfg.SetDefaultModel(provider.MockScriptedModel)
+	}
+
+	// Register fallback chains, selected with /model fallback/<chain>
+	if fallbacks := cfg.GetFallbacks(); len(fallbacks) > 0 {
+		chains := make(map[string][]provider.Target, len(fallbacks))
+		for name, chain := range fallbacks {
+			targets, err := provider.ParseChain(chain)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Ignoring fallback chain %q: %v\n", name, err)
+				continue
+			}
+			chains[name] = targets
+		}
+		fallback := provider.NewFallback(registry, chains)
+		registry.RegisterFactory(fallback.Name(), fallback.Factory())
+	}
+
+	var apiKeys []string
+	for _, name := range registry.List() {
+		apiKeys = append(apiKeys, cfg.GetAPIKey(name))
+	}
+
+	// Keep every configured key out of recordings
+	if recorder != nil {
+		for _, key := range apiKeys {
+			recorder.Scrub(key)
+		}
+	}
+
+	// Wrap every provider call in the configured middleware, outermost first
+	for _, name := range middleware {
+		switch name {
+		case "logging":
+			// Metadata only, never content or keys
+			registry.Use(provider.Logging(log.Default()))
+		case "redact":
+			registry.Use(provider.Redact(apiKeys...))
+		default:
+			fmt.Fprintf(os.Stderr, "Ignoring unknown middleware %q\n", name)
+		}
+	}
+
+	// Cache fetched model lists under ~/.chatui/cache
+	if cacheDir, err := config.GetCacheDir(); err == nil {
+		ttl := time.Duration(cfg.ModelCacheTTLHours) * time.Hour
+		registry.SetModelCache(provider.NewModelCache(cacheDir, ttl))
+	}
+
+	// Initialize tool registry (tools only run when enable_tools is set)
+	toolRegistry := tools.NewRegistry()
+	tools.RegisterBuiltins(toolRegistry)
 
 	// Create UI model
-	model := ui.NewModel(cfg, st, exp, registry)
+	model := ui.NewModel(cfg, st, exp, registry, toolRegistry)
 
 	// Create and run Bubble Tea program
 	p := tea.NewProgram(
@@ -144,16 +305,26 @@ ChatUI - Multi-Provider AI Chat TUI
 
 USAGE:
     chatui [OPTIONS]
+    chatui db encrypt   Encrypt the chat database with a passphrase
 
 OPTIONS:
     -h, --help      Show this help message
     -v, --version   Show version information
-    --debug         Enable debug mode (logs to ~/.chatui/debug.log)
+    --debug         Log provider calls to ~/.chatui/debug.log (adds "logging"
+                    to the configured middleware)
+    --record FILE   Record provider HTTP traffic to a cassette file (keys scrubbed)
+    --replay FILE   Replay provider HTTP traffic from a cassette file, offline
+    --mock          Start with the mock provider (no network or API key)
+    --mock-script FILE
+                    Answer from a mock script of patterns and responses
 
 ENVIRONMENT VARIABLES:
     OPENAI_API_KEY      OpenAI API key
     ANTHROPIC_API_KEY   Anthropic API key
     GEMINI_API_KEY      Google Gemini API key
+    GROQ_API_KEY        Groq API key
+    OPENROUTER_API_KEY  OpenRouter API key
+    OLLAMA_HOST         Ollama server address (default localhost:11434)
 
 CONFIGURATION:
     Config file: ~/.chatui/config.json
@@ -162,19 +333,27 @@ CONFIGURATION:
 
 COMMANDS (in-app):
     /new [name]       Create a new chat session
-    /switch           Switch between sessions
+    /switch [tag]     Switch between sessions
     /connect          Configure API keys
     /model            Select provider/model
     /export           Export session to Markdown
     /clear            Clear current session
+    /delete           Move current session to the trash
+    /trash            Restore or purge deleted sessions
+    /undo             Undo the last delete
+    /edit             Edit the last or selected prompt
+    /regen [p/model]  Regenerate the last reply
     /rename <name>    Rename current session
+    /tag [-]<tag>...  Add or remove session tags
+    /pin              Pin or unpin current session
+    /folder [name]    File current session in a folder
     /system <text>    Set system prompt
     /search [query]   Search across all chats
-    /attach <path>    Attach file to context
+    /attach <path>    Attach file or image to context
     /vault            Manage attachments
     /summarize [n]    Summarize older messages
     /context          Show context usage
-    /thinking         Toggle Gemini thinking mode
+    /thinking [level] Set reasoning effort (low, medium, high, off)
     /grounding        Toggle Gemini search grounding
     /help             Show help
 
@@ -184,6 +363,10 @@ KEYBINDINGS:
     Ctrl+Q          Quit application
     Esc             Close modal / Cancel
     Up/Down         Scroll chat / Navigate lists
+    Ctrl+O          Expand/collapse thinking
+    Ctrl+Up/Down    Select a message
+    Ctrl+Left/Right Switch between message versions
+    Ctrl+Z          Undo the last delete
     Tab             Cycle options in dialogs
 
 SECURITY:
@@ -191,6 +374,8 @@ SECURITY:
     - Config file is created with 0600 permissions
     - API keys are never logged or displayed in plain text
     - Model output is sanitized to prevent terminal injection
+    - "chatui db encrypt" encrypts chat content at rest; full-text search
+      then decrypts messages in memory instead of using an index
 
 For more information, visit: https://github.com/user/openchat
 `
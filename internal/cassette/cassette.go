@@ -0,0 +1,310 @@
+// Package cassette records provider HTTP exchanges to files and replays them,
+// so the UI can be developed and bug reports reproduced with no network and
+// no API key. Streaming (SSE and NDJSON) responses are recorded in full and
+// replayed as-is. API keys are scrubbed before anything is written.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Mode selects whether a Transport records or replays
+type Mode int
+
+const (
+	// ModeRecord sends requests to the network and records the exchanges
+	ModeRecord Mode = iota
+	// ModeReplay serves responses from the cassette without the network
+	ModeReplay
+)
+
+// Redacted replaces scrubbed secrets in recordings
+const Redacted = "REDACTED"
+
+// secretHeaders are request headers that carry API keys
+var secretHeaders = []string{"Authorization", "X-Api-Key", "X-Goog-Api-Key", "Api-Key"}
+
+// secretParams are query parameters that carry API keys
+var secretParams = []string{"key", "api_key"}
+
+// ErrNoInteraction is returned in replay mode when the cassette has no
+// recording for a request
+var ErrNoInteraction = errors.New("no recorded interaction for request")
+
+// Cassette is the on-disk format of a recording
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded request and its response
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded HTTP request
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response. Streamed bodies are kept whole.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// Transport is an http.RoundTripper that records to or replays from a
+// cassette file
+type Transport struct {
+	path    string
+	mode    Mode
+	next    http.RoundTripper
+	secrets []string
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// New creates a transport for the cassette at path. In replay mode the file
+// must exist; in record mode it is created, or appended to if it exists.
+func New(path string, mode Mode) (*Transport, error) {
+	t := &Transport{
+		path: path,
+		mode: mode,
+		next: http.DefaultTransport,
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &t.cassette); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette: %w", err)
+		}
+	case mode == ModeRecord && errors.Is(err, os.ErrNotExist):
+		// A new recording
+	default:
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	t.used = make([]bool, len(t.cassette.Interactions))
+	return t, nil
+}
+
+// Client returns an HTTP client using the transport, for the
+// NewOpenAIWithClient-style provider constructors
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// Scrub adds secrets, such as API keys, to remove from recorded URLs, headers
+// and bodies in addition to the well-known key headers and parameters
+func (t *Transport) Scrub(secrets ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range secrets {
+		if s != "" {
+			t.secrets = append(t.secrets, s)
+		}
+	}
+}
+
+// RoundTrip records or replays a single exchange
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	recorded := t.scrubRequest(req, body)
+
+	if t.mode == ModeReplay {
+		return t.replay(req, recorded)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	// Record once the caller has read the whole body, so streams reach the
+	// caller as they arrive
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		done: func(respBody []byte) {
+			t.record(Interaction{
+				Request: recorded,
+				Response: Response{
+					StatusCode: resp.StatusCode,
+					Headers:    resp.Header.Clone(),
+					Body:       t.scrubString(string(respBody)),
+				},
+			})
+		},
+	}
+	return resp, nil
+}
+
+// replay finds the recorded response for a request. Unused exact matches win,
+// then unused recordings of the same method and URL; once those run out the
+// last matching recording is served again.
+func (t *Transport) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	match := -1
+	for i, in := range t.cassette.Interactions {
+		if t.used[i] || !sameEndpoint(in.Request, recorded) {
+			continue
+		}
+		if in.Request.Body == recorded.Body {
+			match = i
+			break
+		}
+		if match < 0 {
+			match = i
+		}
+	}
+	if match < 0 {
+		for i, in := range t.cassette.Interactions {
+			if sameEndpoint(in.Request, recorded) {
+				match = i
+			}
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, recorded.Method, recorded.URL)
+	}
+	t.used[match] = true
+
+	in := t.cassette.Interactions[match].Response
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.StatusCode, http.StatusText(in.StatusCode)),
+		StatusCode:    in.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        in.Headers.Clone(),
+		Body:          io.NopCloser(strings.NewReader(in.Body)),
+		ContentLength: int64(len(in.Body)),
+		Request:       req,
+	}, nil
+}
+
+// record appends an interaction and saves the cassette
+func (t *Transport) record(in Interaction) {
+	t.mu.Lock()
+	t.cassette.Interactions = append(t.cassette.Interactions, in)
+	t.used = append(t.used, true)
+	t.mu.Unlock()
+
+	// A failed save only loses the recording, not the response
+	_ = t.Save()
+}
+
+// Save writes the cassette to its file
+func (t *Transport) Save() error {
+	t.mu.Lock()
+	data, err := json.MarshalIndent(t.cassette, "", "  ")
+	t.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0700); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	if err := os.WriteFile(t.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// scrubRequest returns the recorded form of a request with secrets removed
+func (t *Transport) scrubRequest(req *http.Request, body []byte) Request {
+	u := *req.URL
+	query := u.Query()
+	for _, param := range secretParams {
+		if query.Has(param) {
+			query.Set(param, Redacted)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	headers := req.Header.Clone()
+	for _, name := range secretHeaders {
+		if headers.Get(name) != "" {
+			headers.Set(name, Redacted)
+		}
+	}
+
+	return Request{
+		Method:  req.Method,
+		URL:     t.scrubString(u.String()),
+		Headers: headers,
+		Body:    t.scrubString(string(body)),
+	}
+}
+
+// scrubString removes the configured secrets from s
+func (t *Transport) scrubString(s string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, secret := range t.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+		// Secrets can also appear URL-encoded
+		s = strings.ReplaceAll(s, url.QueryEscape(secret), Redacted)
+	}
+	return s
+}
+
+// sameEndpoint reports whether two requests share a method and URL
+func sameEndpoint(a, b Request) bool {
+	return a.Method == b.Method && a.URL == b.URL
+}
+
+// recordingBody collects a response body as it is read and calls done once,
+// when the body is exhausted or closed
+type recordingBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	done func([]byte)
+	once sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) finish() {
+	b.once.Do(func() {
+		b.done(b.buf.Bytes())
+	})
+}
@@ -0,0 +1,141 @@
+package cassette
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/openchat/internal/provider"
+)
+
+const testKey = "sk-test-secret"
+
+func newSSEServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testKey {
+			t.Errorf("expected real key on the wire, got '%s'", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"model":"gpt-4o","choices":[{"delta":{"content":"Hello"},"index":0}]}` + "\n\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(`data: {"model":"gpt-4o","choices":[{"delta":{"content":" there"},"index":0,"finish_reason":"stop"}]}` + "\n\n"))
+		w.Write([]byte(`data: {"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+}
+
+func streamHello(t *testing.T, client *http.Client, baseURL, apiKey string) provider.ChatResponse {
+	p := provider.NewOpenAICompatible(provider.OpenAICompatibleConfig{
+		Name:    "test",
+		BaseURL: baseURL,
+		APIKey:  apiKey,
+		Client:  client,
+	})
+
+	var received strings.Builder
+	resp, err := p.Stream(context.Background(), provider.ChatRequest{
+		Model:    "gpt-4o",
+		Messages: []provider.Message{{Role: provider.RoleUser, Content: "Hi"}},
+	}, func(delta string) {
+		received.WriteString(delta)
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if received.String() != "Hello there" {
+		t.Errorf("expected 'Hello there', got '%s'", received.String())
+	}
+	return resp
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := newSSEServer(t)
+	path := filepath.Join(t.TempDir(), "cassettes", "hello.json")
+	baseURL := server.URL + "/v1"
+
+	recorder, err := New(path, ModeRecord)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	recorder.Scrub(testKey)
+	streamHello(t, recorder.Client(), baseURL, testKey)
+	server.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cassette not written: %v", err)
+	}
+	if strings.Contains(string(data), testKey) {
+		t.Error("cassette contains the API key")
+	}
+	if !strings.Contains(string(data), Redacted) {
+		t.Error("expected the Authorization header to be redacted")
+	}
+
+	// Replay needs neither the server nor the real key
+	player, err := New(path, ModeReplay)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	resp := streamHello(t, player.Client(), baseURL, "any-key")
+	if resp.Usage.TotalTokens != 7 || resp.FinishReason != "stop" {
+		t.Errorf("unexpected replayed response: %+v", resp)
+	}
+
+	// Requests that were never recorded fail instead of reaching the network
+	_, err = player.Client().Get(server.URL + "/v1/models")
+	if !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("expected ErrNoInteraction, got %v", err)
+	}
+}
+
+func TestScrubQueryKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "gemini.json")
+	recorder, err := New(path, ModeRecord)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	resp, err := recorder.Client().Get(server.URL + "/models/gemini-2.0-flash:generateContent?key=" + testKey)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), testKey) {
+		t.Error("cassette contains the key from the query string")
+	}
+
+	// The scrubbed URL still matches on replay with a different key
+	player, err := New(path, ModeReplay)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	resp, err = player.Client().Get(server.URL + "/models/gemini-2.0-flash:generateContent?key=other")
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != `{"ok":true}` {
+		t.Errorf("unexpected replayed body: %s", body)
+	}
+}
+
+func TestReplayMissingCassette(t *testing.T) {
+	if _, err := New(filepath.Join(t.TempDir(), "missing.json"), ModeReplay); err == nil {
+		t.Error("expected error for a missing cassette in replay mode")
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 )
 
 const (
@@ -21,12 +23,22 @@ const (
 	DefaultExportDir = "exports"
 	// DefaultDBFile is the default database file name
 	DefaultDBFile = "chatui.db"
+	// DefaultCacheDir is the directory name for cached data such as model lists
+	DefaultCacheDir = "cache"
+	// DefaultTrashRetentionDays is how long deleted sessions stay in the trash
+	DefaultTrashRetentionDays = 30
 
 	// Environment variable names for API keys
 	EnvOpenAIKey    = "OPENAI_API_KEY"
 	EnvAnthropicKey = "ANTHROPIC_API_KEY"
+	EnvGeminiKey    = "GEMINI_API_KEY"
 	EnvGroqKey      = "GROQ_API_KEY"
 	EnvOpenRouterKey = "OPENROUTER_API_KEY"
+
+	// EnvOllamaHost overrides the Ollama server address
+	EnvOllamaHost = "OLLAMA_HOST"
+	// DefaultOllamaBaseURL is the address of a default local Ollama install
+	DefaultOllamaBaseURL = "http://localhost:11434"
 )
 
 // Config represents the application configuration
@@ -41,12 +53,33 @@ type Config struct {
 	EnableTools bool `json:"enable_tools"`
 	// GitAutoCommit enables automatic git commits for exports
 	GitAutoCommit bool `json:"git_auto_commit"`
+	// ExportReasoning includes the model's reasoning in exports
+	ExportReasoning bool `json:"export_reasoning,omitempty"`
 	// APIKeys stores API keys (use env vars instead when possible)
 	APIKeys APIKeys `json:"api_keys,omitempty"`
+	// OllamaBaseURL is the address of the local Ollama server
+	OllamaBaseURL string `json:"ollama_base_url,omitempty"`
+	// ModelCacheTTLHours is how long fetched model lists are cached (default 24)
+	ModelCacheTTLHours int `json:"model_cache_ttl_hours,omitempty"`
+	// TrashRetentionDays is how long deleted sessions are kept in the trash
+	// before they are purged (default 30, -1 keeps them until purged by hand)
+	TrashRetentionDays int `json:"trash_retention_days,omitempty"`
+	// Endpoints declares OpenAI-compatible providers. Entries override the
+	// built-in Groq and OpenRouter endpoints with the same name.
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+	// Budgets limits spending per provider, keyed by provider name
+	Budgets map[string]Budget `json:"budgets,omitempty"`
+	// Fallbacks maps chain names to ordered provider/model lists, e.g.
+	// "anthropic/claude-sonnet-4 -> openai/gpt-4o"
+	Fallbacks map[string]string `json:"fallbacks,omitempty"`
+	// Middleware lists the middleware wrapped around every provider call,
+	// outermost first: "logging" and "redact"
+	Middleware []string `json:"middleware,omitempty"`
 
 	// Runtime-only fields (not persisted)
-	configPath string
-	mu         sync.RWMutex
+	configPath     string
+	placeholderKey string
+	mu             sync.RWMutex
 }
 
 // APIKeys holds API keys for various providers
@@ -54,10 +87,62 @@ type Config struct {
 type APIKeys struct {
 	OpenAI     string `json:"openai,omitempty"`
 	Anthropic  string `json:"anthropic,omitempty"`
+	Gemini     string `json:"gemini,omitempty"`
 	Groq       string `json:"groq,omitempty"`
 	OpenRouter string `json:"openrouter,omitempty"`
 }
 
+// Endpoint describes a named OpenAI-compatible API endpoint
+type Endpoint struct {
+	// Name is the provider name used in /model and /connect
+	Name string `json:"name"`
+	// BaseURL is the API root, e.g. https://api.groq.com/openai/v1
+	BaseURL string `json:"base_url"`
+	// APIKeyEnv names the environment variable holding the API key.
+	// Leave empty for local servers that need no key.
+	APIKeyEnv string `json:"api_key_env,omitempty"`
+	// Headers are extra HTTP headers sent with every request
+	Headers map[string]string `json:"headers,omitempty"`
+	// Models lists the models offered in /model
+	Models []string `json:"models,omitempty"`
+}
+
+// Budget is a spending limit for one provider, in US dollars
+type Budget struct {
+	// Soft shows a warning once spending reaches it
+	Soft float64 `json:"soft,omitempty"`
+	// Hard blocks sending until the user confirms an override
+	Hard float64 `json:"hard,omitempty"`
+	// Period is "day" or "month" (the default)
+	Period string `json:"period,omitempty"`
+}
+
+// PeriodStart returns the start of the budget period containing now
+func (b Budget) PeriodStart(now time.Time) time.Time {
+	y, m, d := now.Date()
+	if b.Period == "day" {
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	}
+	return time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+}
+
+// DefaultEndpoints are the OpenAI-compatible providers available out of the box
+var DefaultEndpoints = []Endpoint{
+	{
+		Name:      "groq",
+		BaseURL:   "https://api.groq.com/openai/v1",
+		APIKeyEnv: EnvGroqKey,
+		Models:    []string{"llama-3.3-70b-versatile", "llama-3.1-8b-instant", "mixtral-8x7b-32768"},
+	},
+	{
+		Name:      "openrouter",
+		BaseURL:   "https://openrouter.ai/api/v1",
+		APIKeyEnv: EnvOpenRouterKey,
+		Headers:   map[string]string{"X-Title": "ChatUI"},
+		Models:    []string{"openai/gpt-4o", "anthropic/claude-sonnet-4", "google/gemini-2.5-flash", "meta-llama/llama-3.3-70b-instruct"},
+	},
+}
+
 // DefaultConfig returns a config with sensible defaults
 func DefaultConfig() *Config {
 	return &Config{
@@ -97,6 +182,15 @@ func GetDBPath() (string, error) {
 	return filepath.Join(dir, DefaultDBFile), nil
 }
 
+// GetCacheDir returns the cache directory path
+func GetCacheDir() (string, error) {
+	dir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, DefaultCacheDir), nil
+}
+
 // GetExportPath returns the export directory path
 func (c *Config) GetExportPath() (string, error) {
 	if c.ExportPath != "" {
@@ -154,6 +248,9 @@ func (c *Config) applyEnvOverrides() {
 	if key := os.Getenv(EnvAnthropicKey); key != "" {
 		c.APIKeys.Anthropic = key
 	}
+	if key := os.Getenv(EnvGeminiKey); key != "" {
+		c.APIKeys.Gemini = key
+	}
 	if key := os.Getenv(EnvGroqKey); key != "" {
 		c.APIKeys.Groq = key
 	}
@@ -177,12 +274,20 @@ func (c *Config) Save() error {
 
 	// Create config without runtime fields
 	toSave := &Config{
-		DefaultProvider: c.DefaultProvider,
-		DefaultModel:    c.DefaultModel,
-		ExportPath:      c.ExportPath,
-		EnableTools:     c.EnableTools,
-		GitAutoCommit:   c.GitAutoCommit,
-		APIKeys:         c.APIKeys,
+		DefaultProvider:    c.DefaultProvider,
+		DefaultModel:       c.DefaultModel,
+		ExportPath:         c.ExportPath,
+		EnableTools:        c.EnableTools,
+		GitAutoCommit:      c.GitAutoCommit,
+		ExportReasoning:    c.ExportReasoning,
+		APIKeys:            c.APIKeys,
+		OllamaBaseURL:      c.OllamaBaseURL,
+		ModelCacheTTLHours: c.ModelCacheTTLHours,
+		TrashRetentionDays: c.TrashRetentionDays,
+		Endpoints:          c.Endpoints,
+		Budgets:            c.Budgets,
+		Fallbacks:          c.Fallbacks,
+		Middleware:         c.Middleware,
 	}
 
 	data, err := json.MarshalIndent(toSave, "", "  ")
@@ -204,6 +309,23 @@ func (c *Config) GetAPIKey(provider string) string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
+	if key := c.apiKey(provider); key != "" {
+		return key
+	}
+	return c.placeholderKey
+}
+
+// SetPlaceholderKey sets a key returned for providers that have none, so
+// requests can be replayed from a recording without real keys. It is never
+// saved.
+func (c *Config) SetPlaceholderKey(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.placeholderKey = key
+}
+
+// apiKey looks up a provider's real API key; the caller holds the lock
+func (c *Config) apiKey(provider string) string {
 	switch provider {
 	case "openai":
 		if key := os.Getenv(EnvOpenAIKey); key != "" {
@@ -215,6 +337,11 @@ func (c *Config) GetAPIKey(provider string) string {
 			return key
 		}
 		return c.APIKeys.Anthropic
+	case "gemini":
+		if key := os.Getenv(EnvGeminiKey); key != "" {
+			return key
+		}
+		return c.APIKeys.Gemini
 	case "groq":
 		if key := os.Getenv(EnvGroqKey); key != "" {
 			return key
@@ -226,10 +353,55 @@ func (c *Config) GetAPIKey(provider string) string {
 		}
 		return c.APIKeys.OpenRouter
 	default:
+		// Custom endpoints read their key from the configured variable
+		if ep, ok := c.findEndpoint(provider); ok && ep.APIKeyEnv != "" {
+			return os.Getenv(ep.APIKeyEnv)
+		}
 		return ""
 	}
 }
 
+// GetEndpoints returns the built-in endpoints merged with those declared in
+// the config file
+func (c *Config) GetEndpoints() []Endpoint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	endpoints := make([]Endpoint, 0, len(DefaultEndpoints)+len(c.Endpoints))
+	for _, ep := range DefaultEndpoints {
+		if override, ok := c.findEndpoint(ep.Name); ok {
+			ep = override
+		}
+		endpoints = append(endpoints, ep)
+	}
+	for _, ep := range c.Endpoints {
+		if !isDefaultEndpoint(ep.Name) {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	return endpoints
+}
+
+// findEndpoint looks up a configured endpoint by name; the caller must hold c.mu
+func (c *Config) findEndpoint(name string) (Endpoint, bool) {
+	for _, ep := range c.Endpoints {
+		if ep.Name == name {
+			return ep, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+// isDefaultEndpoint reports whether name is one of DefaultEndpoints
+func isDefaultEndpoint(name string) bool {
+	for _, ep := range DefaultEndpoints {
+		if ep.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // SetAPIKey sets the API key for the specified provider
 // Pass persist=true to save to config file, false to keep in memory only
 func (c *Config) SetAPIKey(provider, key string, persist bool) error {
@@ -241,6 +413,8 @@ func (c *Config) SetAPIKey(provider, key string, persist bool) error {
 		c.APIKeys.OpenAI = key
 	case "anthropic":
 		c.APIKeys.Anthropic = key
+	case "gemini":
+		c.APIKeys.Gemini = key
 	case "groq":
 		c.APIKeys.Groq = key
 	case "openrouter":
@@ -263,6 +437,74 @@ func (c *Config) HasAPIKey(provider string) bool {
 	return c.GetAPIKey(provider) != ""
 }
 
+// GetOllamaBaseURL returns the Ollama server address. OLLAMA_HOST takes
+// precedence over the config file and may omit the scheme, as with the
+// Ollama CLI.
+func (c *Config) GetOllamaBaseURL() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	url := c.OllamaBaseURL
+	if host := os.Getenv(EnvOllamaHost); host != "" {
+		url = host
+	}
+	if url == "" {
+		return DefaultOllamaBaseURL
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "http://" + url
+	}
+	return strings.TrimRight(url, "/")
+}
+
+// GetBudget returns the spending budget for a provider, if one is set
+func (c *Config) GetBudget(provider string) (Budget, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	b, ok := c.Budgets[provider]
+	if !ok || (b.Soft <= 0 && b.Hard <= 0) {
+		return Budget{}, false
+	}
+	return b, true
+}
+
+// GetTrashRetention returns how long deleted sessions are kept in the trash,
+// or 0 when they are kept until purged by hand
+func (c *Config) GetTrashRetention() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	switch {
+	case c.TrashRetentionDays < 0:
+		return 0
+	case c.TrashRetentionDays == 0:
+		return DefaultTrashRetentionDays * 24 * time.Hour
+	default:
+		return time.Duration(c.TrashRetentionDays) * 24 * time.Hour
+	}
+}
+
+// GetFallbacks returns a copy of the configured fallback chains
+func (c *Config) GetFallbacks() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	chains := make(map[string]string, len(c.Fallbacks))
+	for name, chain := range c.Fallbacks {
+		chains[name] = chain
+	}
+	return chains
+}
+
+// GetMiddleware returns a copy of the configured middleware names
+func (c *Config) GetMiddleware() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]string(nil), c.Middleware...)
+}
+
 // SetDefaultProvider updates the default provider
 func (c *Config) SetDefaultProvider(provider string) {
 	c.mu.Lock()
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -144,6 +146,14 @@ func TestEnvOverrides(t *testing.T) {
 	if key := cfg.GetAPIKey("anthropic"); key != "config-anthropic-key" {
 		t.Errorf("expected Anthropic key from config 'config-anthropic-key', got '%s'", key)
 	}
+
+	// Gemini keys are read from GEMINI_API_KEY
+	oldGeminiKey := os.Getenv(EnvGeminiKey)
+	os.Setenv(EnvGeminiKey, "env-gemini-key")
+	defer os.Setenv(EnvGeminiKey, oldGeminiKey)
+	if key := cfg.GetAPIKey("gemini"); key != "env-gemini-key" {
+		t.Errorf("expected Gemini key from env 'env-gemini-key', got '%s'", key)
+	}
 }
 
 func TestSaveConfig(t *testing.T) {
@@ -161,6 +171,7 @@ func TestSaveConfig(t *testing.T) {
 	cfg.DefaultProvider = "anthropic"
 	cfg.DefaultModel = "claude-3-opus-20240229"
 	cfg.EnableTools = true
+	cfg.Middleware = []string{"logging", "redact"}
 
 	// Save
 	if err := cfg.Save(); err != nil {
@@ -182,6 +193,9 @@ func TestSaveConfig(t *testing.T) {
 	if !cfg2.EnableTools {
 		t.Error("expected EnableTools to be true")
 	}
+	if got := cfg2.GetMiddleware(); strings.Join(got, ",") != "logging,redact" {
+		t.Errorf("expected middleware [logging redact], got %v", got)
+	}
 }
 
 func TestSetAPIKey(t *testing.T) {
@@ -322,3 +336,96 @@ func TestConfigFilePermissions(t *testing.T) {
 		t.Errorf("expected config file permissions 0600, got %o", filePerm)
 	}
 }
+
+func TestGetOllamaBaseURL(t *testing.T) {
+	oldHost := os.Getenv(EnvOllamaHost)
+	os.Unsetenv(EnvOllamaHost)
+	defer os.Setenv(EnvOllamaHost, oldHost)
+
+	cfg := DefaultConfig()
+	if url := cfg.GetOllamaBaseURL(); url != DefaultOllamaBaseURL {
+		t.Errorf("expected default URL, got '%s'", url)
+	}
+
+	cfg.OllamaBaseURL = "http://gpu-box:11434/"
+	if url := cfg.GetOllamaBaseURL(); url != "http://gpu-box:11434" {
+		t.Errorf("expected config URL, got '%s'", url)
+	}
+
+	// OLLAMA_HOST wins and may omit the scheme
+	os.Setenv(EnvOllamaHost, "127.0.0.1:8080")
+	if url := cfg.GetOllamaBaseURL(); url != "http://127.0.0.1:8080" {
+		t.Errorf("expected env URL with scheme, got '%s'", url)
+	}
+}
+
+func TestGetEndpoints(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Endpoints = []Endpoint{
+		{Name: "groq", BaseURL: "https://groq.example.com/v1", APIKeyEnv: EnvGroqKey},
+		{Name: "vllm", BaseURL: "http://localhost:8000/v1", APIKeyEnv: "VLLM_TEST_KEY"},
+	}
+
+	endpoints := cfg.GetEndpoints()
+	if len(endpoints) != 3 {
+		t.Fatalf("expected 3 endpoints, got %d", len(endpoints))
+	}
+	if endpoints[0].Name != "groq" || endpoints[0].BaseURL != "https://groq.example.com/v1" {
+		t.Errorf("expected groq override, got %+v", endpoints[0])
+	}
+	if endpoints[1].Name != "openrouter" {
+		t.Errorf("expected built-in openrouter, got %+v", endpoints[1])
+	}
+	if endpoints[2].Name != "vllm" {
+		t.Errorf("expected custom vllm endpoint, got %+v", endpoints[2])
+	}
+
+	// Custom endpoints read their key from the configured variable
+	os.Setenv("VLLM_TEST_KEY", "vllm-key")
+	defer os.Unsetenv("VLLM_TEST_KEY")
+	if key := cfg.GetAPIKey("vllm"); key != "vllm-key" {
+		t.Errorf("expected key from VLLM_TEST_KEY, got '%s'", key)
+	}
+}
+
+func TestGetBudget(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Budgets = map[string]Budget{
+		"openai":    {Soft: 5, Hard: 10},
+		"anthropic": {Period: "day"},
+	}
+
+	if b, ok := cfg.GetBudget("openai"); !ok || b.Hard != 10 {
+		t.Errorf("expected openai budget, got %+v (ok=%v)", b, ok)
+	}
+	// A budget without limits is no budget
+	if _, ok := cfg.GetBudget("anthropic"); ok {
+		t.Error("expected no budget for anthropic")
+	}
+	if _, ok := cfg.GetBudget("gemini"); ok {
+		t.Error("expected no budget for gemini")
+	}
+
+	now := time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)
+	if start := (Budget{}).PeriodStart(now); !start.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected month start: %v", start)
+	}
+	if start := (Budget{Period: "day"}).PeriodStart(now); !start.Equal(time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected day start: %v", start)
+	}
+}
+
+func TestGetTrashRetention(t *testing.T) {
+	cfg := DefaultConfig()
+	if got := cfg.GetTrashRetention(); got != DefaultTrashRetentionDays*24*time.Hour {
+		t.Errorf("expected default retention, got %v", got)
+	}
+	cfg.TrashRetentionDays = 7
+	if got := cfg.GetTrashRetention(); got != 7*24*time.Hour {
+		t.Errorf("expected 7 days, got %v", got)
+	}
+	cfg.TrashRetentionDays = -1
+	if got := cfg.GetTrashRetention(); got != 0 {
+		t.Errorf("expected no automatic purge, got %v", got)
+	}
+}
@@ -15,8 +15,9 @@ import (
 
 // Exporter handles exporting sessions to files
 type Exporter struct {
-	exportPath    string
-	gitAutoCommit bool
+	exportPath       string
+	gitAutoCommit    bool
+	includeReasoning bool
 }
 
 // New creates a new Exporter
@@ -27,6 +28,12 @@ func New(exportPath string, gitAutoCommit bool) *Exporter {
 	}
 }
 
+// SetIncludeReasoning sets whether exports include the model's reasoning
+// above each reply. It is left out by default.
+func (e *Exporter) SetIncludeReasoning(include bool) {
+	e.includeReasoning = include
+}
+
 // ExportSession exports a session and its messages to a Markdown file
 func (e *Exporter) ExportSession(session *store.Session, messages []*store.Message) (string, error) {
 	// Ensure export directory exists
@@ -109,23 +116,61 @@ func (e *Exporter) generateMarkdown(session *store.Session, messages []*store.Me
 		case store.RoleAssistant:
 			sb.WriteString("### 🤖 Assistant\n\n")
 		case store.RoleTool:
-			sb.WriteString("### 🔧 Tool\n\n")
+			sb.WriteString(fmt.Sprintf("### 🔧 Tool: %s\n\n", msg.ToolName))
 		default:
 			sb.WriteString(fmt.Sprintf("### %s\n\n", msg.Role))
 		}
 
-		// Timestamp
-		sb.WriteString(fmt.Sprintf("*%s*\n\n", msg.CreatedAt.Format("2006-01-02 15:04:05")))
+		// Timestamp, plus how the reply was generated
+		timestamp := msg.CreatedAt.Format("2006-01-02 15:04:05")
+		if !msg.Meta.IsZero() {
+			timestamp += " · " + sanitize.Sanitize(msg.Meta.String())
+		}
+		sb.WriteString(fmt.Sprintf("*%s*\n\n", timestamp))
+
+		// Tool call arguments
+		if msg.Role == store.RoleTool && msg.ToolArguments != "" {
+			sb.WriteString(fmt.Sprintf("Arguments: `%s`\n\n", sanitize.Sanitize(msg.ToolArguments)))
+		}
+
+		// Reasoning, collapsed where the Markdown viewer supports it
+		if e.includeReasoning && msg.Reasoning != "" {
+			sb.WriteString("<details>\n<summary>Thinking</summary>\n\n")
+			sb.WriteString(sanitize.Sanitize(msg.Reasoning))
+			sb.WriteString("\n\n</details>\n\n")
+		}
+
+		// Content (sanitized), with cited spans linked to their sources
+		content := store.AnnotateCitations(msg.Content, msg.Citations, func(n int, c store.Citation) string {
+			return fmt.Sprintf("[[%d]](%s)", n, markdownURL(c.URI))
+		})
+		sb.WriteString(sanitize.Sanitize(content))
+		sb.WriteString("\n\n")
 
-		// Content (sanitized)
-		content := sanitize.Sanitize(msg.Content)
-		sb.WriteString(content)
-		sb.WriteString("\n\n---\n\n")
+		if len(msg.Citations) > 0 {
+			sb.WriteString("**Sources:**\n\n")
+			for i, c := range msg.Citations {
+				sb.WriteString(fmt.Sprintf("%d. [%s](%s)\n", i+1,
+					markdownLinkText(sanitize.Sanitize(c.Label())), markdownURL(sanitize.Sanitize(c.URI))))
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString("---\n\n")
 	}
 
 	return sb.String()
 }
 
+// markdownLinkText escapes the brackets in a link's text
+func markdownLinkText(s string) string {
+	return strings.NewReplacer("[", "\\[", "]", "\\]").Replace(s)
+}
+
+// markdownURL escapes the characters that would end a link's URL early
+func markdownURL(s string) string {
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(s)
+}
+
 // ExportSessionAsText exports a session as plain text
 func (e *Exporter) ExportSessionAsText(session *store.Session, messages []*store.Message) (string, error) {
 	// Ensure export directory exists
@@ -161,14 +206,30 @@ func (e *Exporter) ExportSessionAsText(session *store.Session, messages []*store
 		case store.RoleAssistant:
 			role = "ASSISTANT"
 		case store.RoleTool:
-			role = "TOOL"
+			role = "TOOL " + msg.ToolName
 		default:
 			role = string(msg.Role)
 		}
 
 		sb.WriteString(fmt.Sprintf("[%s] %s\n", role, msg.CreatedAt.Format("15:04:05")))
-		sb.WriteString(sanitize.Sanitize(msg.Content))
-		sb.WriteString("\n\n")
+		if !msg.Meta.IsZero() {
+			sb.WriteString(fmt.Sprintf("(%s)\n", sanitize.Sanitize(msg.Meta.String())))
+		}
+		if e.includeReasoning && msg.Reasoning != "" {
+			sb.WriteString("[THINKING]\n")
+			sb.WriteString(sanitize.Sanitize(msg.Reasoning))
+			sb.WriteString("\n[/THINKING]\n")
+		}
+		sb.WriteString(sanitize.Sanitize(store.AnnotateCitations(msg.Content, msg.Citations,
+			func(n int, _ store.Citation) string { return fmt.Sprintf("[%d]", n) })))
+		sb.WriteString("\n")
+		if len(msg.Citations) > 0 {
+			sb.WriteString("Sources:\n")
+			for i, c := range msg.Citations {
+				sb.WriteString(fmt.Sprintf("[%d] %s <%s>\n", i+1, sanitize.Sanitize(c.Label()), sanitize.Sanitize(c.URI)))
+			}
+		}
+		sb.WriteString("\n")
 	}
 
 	// Write file
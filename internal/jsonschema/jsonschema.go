@@ -0,0 +1,460 @@
+// Package jsonschema validates JSON documents against a practical subset of
+// JSON Schema: type, enum, const, properties, required,
+// additionalProperties, items, string and number bounds, pattern, anyOf,
+// oneOf, allOf, not, and local $ref to #/$defs or #/definitions. Unknown
+// keywords are ignored.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxErrors limits how many problems Validate reports
+const maxErrors = 20
+
+// Schema is a parsed JSON Schema
+type Schema struct {
+	root map[string]interface{}
+	raw  json.RawMessage
+}
+
+// Compile parses a JSON Schema document. The root must be an object.
+func Compile(data []byte) (*Schema, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	if err := checkPatterns(root); err != nil {
+		return nil, err
+	}
+	return &Schema{root: root, raw: json.RawMessage(data)}, nil
+}
+
+// Raw returns the schema document as given to Compile
+func (s *Schema) Raw() json.RawMessage {
+	return s.raw
+}
+
+// Type returns the schema's top-level type, or "" when it has none
+func (s *Schema) Type() string {
+	t, _ := s.root["type"].(string)
+	return t
+}
+
+// Validate checks a JSON document against the schema and returns the
+// problems found, e.g. `$.name: required property missing`. An empty result
+// means the document is valid.
+func (s *Schema) Validate(doc []byte) []string {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return []string{"reply is not valid JSON: " + err.Error()}
+	}
+	if dec.More() {
+		return []string{"reply has content after the JSON value"}
+	}
+
+	v := &validator{root: s.root, resolving: make(map[string]bool)}
+	v.validate(s.root, value, "$")
+	return v.errors
+}
+
+type validator struct {
+	root   map[string]interface{}
+	errors []string
+	// resolving holds the $refs being followed, keyed by the ref and the
+	// path of the value. Meeting one again at the same path means the
+	// schema refers to itself without descending into the value.
+	resolving map[string]bool
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	if len(v.errors) < maxErrors {
+		v.errors = append(v.errors, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validator) validate(schema map[string]interface{}, value interface{}, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		key := ref + " " + path
+		if v.resolving[key] {
+			v.fail(path, "circular $ref %q", ref)
+			return
+		}
+		target, err := v.resolve(ref)
+		if err != nil {
+			v.fail(path, "%v", err)
+			return
+		}
+		v.resolving[key] = true
+		v.validate(target, value, path)
+		delete(v.resolving, key)
+		return
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		v.fail(path, "expected %s, got %s", describeType(t), typeOf(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !containsValue(enum, value) {
+		v.fail(path, "value must be one of %s", formatValues(enum))
+	}
+	if c, ok := schema["const"]; ok && !equalValues(c, value) {
+		v.fail(path, "value must be %s", formatValue(c))
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(schema, val, path)
+	case []interface{}:
+		v.validateArray(schema, val, path)
+	case string:
+		v.validateString(schema, val, path)
+	case json.Number:
+		v.validateNumber(schema, val, path)
+	}
+
+	v.validateCombinators(schema, value, path)
+}
+
+func (v *validator) validateObject(schema map[string]interface{}, obj map[string]interface{}, path string) {
+	properties, _ := schema["properties"].(map[string]interface{})
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, present := obj[name]; !present {
+				v.fail(path, "required property %q is missing", name)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		childPath := path + "." + name
+		if prop, ok := properties[name].(map[string]interface{}); ok {
+			v.validate(prop, obj[name], childPath)
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				v.fail(path, "property %q is not allowed", name)
+			}
+		case map[string]interface{}:
+			v.validate(extra, obj[name], childPath)
+		}
+	}
+
+	if min, ok := intKeyword(schema, "minProperties"); ok && len(obj) < min {
+		v.fail(path, "expected at least %d properties", min)
+	}
+	if max, ok := intKeyword(schema, "maxProperties"); ok && len(obj) > max {
+		v.fail(path, "expected at most %d properties", max)
+	}
+}
+
+func (v *validator) validateArray(schema map[string]interface{}, arr []interface{}, path string) {
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range arr {
+			v.validate(items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+	if min, ok := intKeyword(schema, "minItems"); ok && len(arr) < min {
+		v.fail(path, "expected at least %d items, got %d", min, len(arr))
+	}
+	if max, ok := intKeyword(schema, "maxItems"); ok && len(arr) > max {
+		v.fail(path, "expected at most %d items, got %d", max, len(arr))
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if equalValues(arr[i], arr[j]) {
+					v.fail(path, "items %d and %d are equal", i, j)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) validateString(schema map[string]interface{}, s, path string) {
+	length := utf8.RuneCountInString(s)
+	if min, ok := intKeyword(schema, "minLength"); ok && length < min {
+		v.fail(path, "expected at least %d characters", min)
+	}
+	if max, ok := intKeyword(schema, "maxLength"); ok && length > max {
+		v.fail(path, "expected at most %d characters", max)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(s) {
+			v.fail(path, "value does not match pattern %q", pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(schema map[string]interface{}, n json.Number, path string) {
+	f, err := n.Float64()
+	if err != nil {
+		v.fail(path, "invalid number %s", n)
+		return
+	}
+	if min, ok := floatKeyword(schema, "minimum"); ok && f < min {
+		v.fail(path, "value %s is less than the minimum %g", n, min)
+	}
+	if max, ok := floatKeyword(schema, "maximum"); ok && f > max {
+		v.fail(path, "value %s is greater than the maximum %g", n, max)
+	}
+	if min, ok := floatKeyword(schema, "exclusiveMinimum"); ok && f <= min {
+		v.fail(path, "value %s must be greater than %g", n, min)
+	}
+	if max, ok := floatKeyword(schema, "exclusiveMaximum"); ok && f >= max {
+		v.fail(path, "value %s must be less than %g", n, max)
+	}
+	if m, ok := floatKeyword(schema, "multipleOf"); ok && m > 0 {
+		if q := f / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(path, "value %s is not a multiple of %g", n, m)
+		}
+	}
+}
+
+func (v *validator) validateCombinators(schema map[string]interface{}, value interface{}, path string) {
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if s, ok := sub.(map[string]interface{}); ok {
+				v.validate(s, value, path)
+			}
+		}
+	}
+	if any, ok := schema["anyOf"].([]interface{}); ok && v.countMatches(any, value, path) == 0 {
+		v.fail(path, "value does not match any of the allowed schemas")
+	}
+	if one, ok := schema["oneOf"].([]interface{}); ok {
+		if n := v.countMatches(one, value, path); n != 1 {
+			v.fail(path, "value must match exactly one schema, matched %d", n)
+		}
+	}
+	if not, ok := schema["not"].(map[string]interface{}); ok && v.matches(not, value, path) {
+		v.fail(path, "value matches a disallowed schema")
+	}
+}
+
+// countMatches returns how many of the schemas value matches
+func (v *validator) countMatches(schemas []interface{}, value interface{}, path string) int {
+	n := 0
+	for _, sub := range schemas {
+		if s, ok := sub.(map[string]interface{}); ok && v.matches(s, value, path) {
+			n++
+		}
+	}
+	return n
+}
+
+// matches reports whether value matches schema without recording errors
+func (v *validator) matches(schema map[string]interface{}, value interface{}, path string) bool {
+	sub := &validator{root: v.root, resolving: v.resolving}
+	sub.validate(schema, value, path)
+	return len(sub.errors) == 0
+}
+
+// resolve follows a local reference such as "#/$defs/address"
+func (v *validator) resolve(ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported $ref %q: only local references are supported", ref)
+	}
+	var node interface{} = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		node = obj[part]
+	}
+	target, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+	return target, nil
+}
+
+// checkPatterns reports the first invalid regular expression in a schema
+func checkPatterns(node interface{}) error {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if pattern, ok := n["pattern"].(string); ok {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("invalid pattern %q in schema: %w", pattern, err)
+			}
+		}
+		for key, child := range n {
+			if key == "enum" || key == "const" || key == "default" || key == "examples" {
+				continue
+			}
+			if err := checkPatterns(child); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, child := range n {
+			if err := checkPatterns(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchesType reports whether value has the type (or one of the types) t
+func matchesType(t interface{}, value interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return matchesTypeName(t, value)
+	case []interface{}:
+		for _, name := range t {
+			if s, ok := name.(string); ok && matchesTypeName(s, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTypeName(name string, value interface{}) bool {
+	switch name {
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	default:
+		return typeOf(value) == name
+	}
+}
+
+// typeOf returns the JSON type name of a decoded value
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func describeType(t interface{}) string {
+	if names, ok := t.([]interface{}); ok {
+		parts := make([]string, 0, len(names))
+		for _, name := range names {
+			parts = append(parts, fmt.Sprint(name))
+		}
+		return strings.Join(parts, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if equalValues(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalValues compares JSON values, treating equal numbers as equal however
+// they were written
+func equalValues(a, b interface{}) bool {
+	an, aNum := toFloat(a)
+	bn, bNum := toFloat(b)
+	if aNum || bNum {
+		return aNum && bNum && an == bn
+	}
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// normalize converts json.Number values to float64 so decoded documents and
+// schema values compare equal
+func normalize(v interface{}) interface{} {
+	switch n := v.(type) {
+	case json.Number:
+		f, _ := n.Float64()
+		return f
+	case []interface{}:
+		out := make([]interface{}, len(n))
+		for i, item := range n {
+			out[i] = normalize(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(n))
+		for k, item := range n {
+			out[k] = normalize(item)
+		}
+		return out
+	}
+	return v
+}
+
+func formatValue(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func formatValues(values []interface{}) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		parts = append(parts, formatValue(v))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func intKeyword(schema map[string]interface{}, key string) (int, bool) {
+	f, ok := schema[key].(float64)
+	return int(f), ok
+}
+
+func floatKeyword(schema map[string]interface{}, key string) (float64, bool) {
+	f, ok := schema[key].(float64)
+	return f, ok
+}
@@ -0,0 +1,116 @@
+package jsonschema
+
+import (
+	"strings"
+	"testing"
+)
+
+const personSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"age": {"type": "integer", "minimum": 0},
+		"role": {"enum": ["admin", "user"]},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+		"address": {"$ref": "#/$defs/address"}
+	},
+	"required": ["name", "age"],
+	"additionalProperties": false,
+	"$defs": {
+		"address": {
+			"type": "object",
+			"properties": {"zip": {"type": "string", "pattern": "^[0-9]{5}$"}},
+			"required": ["zip"]
+		}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	schema, err := Compile([]byte(personSchema))
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if schema.Type() != "object" {
+		t.Errorf("expected object schema, got '%s'", schema.Type())
+	}
+
+	valid := `{"name": "Ada", "age": 36, "role": "admin", "tags": ["x"], "address": {"zip": "12345"}}`
+	if errs := schema.Validate([]byte(valid)); len(errs) != 0 {
+		t.Errorf("expected valid document, got %v", errs)
+	}
+
+	tests := []struct {
+		doc  string
+		want string
+	}{
+		{`{"age": 1}`, `$: required property "name" is missing`},
+		{`{"name": "Ada", "age": 1.5}`, "$.age: expected integer, got number"},
+		{`{"name": "Ada", "age": -1}`, "$.age: value -1 is less than the minimum 0"},
+		{`{"name": "Ada", "age": 1, "role": "root"}`, `$.role: value must be one of "admin", "user"`},
+		{`{"name": "Ada", "age": 1, "tags": ["a", "b", "c"]}`, "$.tags: expected at most 2 items, got 3"},
+		{`{"name": "Ada", "age": 1, "tags": [1]}`, "$.tags[0]: expected string, got number"},
+		{`{"name": "Ada", "age": 1, "extra": true}`, `$: property "extra" is not allowed`},
+		{`{"name": "Ada", "age": 1, "address": {"zip": "abc"}}`, "$.address.zip: value does not match pattern"},
+		{`{"name": "", "age": 1}`, "$.name: expected at least 1 characters"},
+		{`[1, 2]`, "$: expected object, got array"},
+		{`{"name": "Ada"`, "reply is not valid JSON"},
+		{`{"name": "Ada", "age": 1} trailing`, "reply has content after the JSON value"},
+	}
+	for _, tt := range tests {
+		errs := schema.Validate([]byte(tt.doc))
+		if len(errs) == 0 || !strings.Contains(strings.Join(errs, "\n"), tt.want) {
+			t.Errorf("validating %s: expected error containing %q, got %v", tt.doc, tt.want, errs)
+		}
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	schema, err := Compile([]byte(`{"oneOf": [{"type": "string"}, {"type": "integer", "maximum": 10}]}`))
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	for _, doc := range []string{`"text"`, `5`} {
+		if errs := schema.Validate([]byte(doc)); len(errs) != 0 {
+			t.Errorf("expected %s to be valid, got %v", doc, errs)
+		}
+	}
+	if errs := schema.Validate([]byte(`50`)); len(errs) == 0 {
+		t.Error("expected 50 to match no schema")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, schema := range []string{`not json`, `[]`, `{"pattern": "("}`} {
+		if _, err := Compile([]byte(schema)); err == nil {
+			t.Errorf("expected error compiling %s", schema)
+		}
+	}
+}
+
+func TestCircularRef(t *testing.T) {
+	for _, raw := range []string{
+		`{"$defs": {"a": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}`,
+		`{"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"allOf": [{"$ref": "#/$defs/a"}]}}, "$ref": "#/$defs/a"}`,
+	} {
+		schema, err := Compile([]byte(raw))
+		if err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		errs := schema.Validate([]byte(`{"x": 1}`))
+		if len(errs) == 0 || !strings.Contains(errs[0], "circular $ref") {
+			t.Errorf("expected circular $ref error for %s, got %v", raw, errs)
+		}
+	}
+
+	// A recursive schema is fine as long as each step descends into the value
+	schema, err := Compile([]byte(`{
+		"$defs": {"node": {"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/node"}}}}},
+		"$ref": "#/$defs/node"
+	}`))
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if errs := schema.Validate([]byte(`{"children": [{"children": [{}]}]}`)); len(errs) != 0 {
+		t.Errorf("expected recursive document to be valid, got %v", errs)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,9 +13,10 @@ import (
 )
 
 const (
-	anthropicBaseURL      = "https://api.anthropic.com/v1"
-	anthropicChatEndpoint = "/messages"
-	anthropicAPIVersion   = "2023-06-01"
+	anthropicBaseURL        = "https://api.anthropic.com/v1"
+	anthropicChatEndpoint   = "/messages"
+	anthropicModelsEndpoint = "/models"
+	anthropicAPIVersion     = "2023-06-01"
 )
 
 // Anthropic implements the Provider interface for Anthropic's API
@@ -54,35 +56,186 @@ func (a *Anthropic) SupportsStreaming() bool {
 
 // anthropicRequest is the request format for Anthropic's messages API
 type anthropicRequest struct {
-	Model       string             `json:"model"`
-	Messages    []anthropicMessage `json:"messages"`
-	System      string             `json:"system,omitempty"`
-	MaxTokens   int                `json:"max_tokens"`
-	Temperature float64            `json:"temperature,omitempty"`
-	Stream      bool               `json:"stream,omitempty"`
+	Model       string               `json:"model"`
+	Messages    []anthropicMessage   `json:"messages"`
+	System      interface{}          `json:"system,omitempty"` // A string, or text blocks
+	MaxTokens   int                  `json:"max_tokens"`
+	Temperature *float64             `json:"temperature,omitempty"`
+	TopP        *float64             `json:"top_p,omitempty"`
+	Stop        []string             `json:"stop_sequences,omitempty"`
+	Stream      bool                 `json:"stream,omitempty"`
+	Tools       []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Thinking    *anthropicThinking   `json:"thinking,omitempty"`
+}
+
+// anthropicThinking enables extended thinking
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+// anthropicMinThinkingBudget is the smallest thinking budget Anthropic accepts
+const anthropicMinThinkingBudget = 1024
+
+// anthropicThinkingModel reports whether a model supports extended thinking,
+// which started with Claude 3.7
+func anthropicThinkingModel(model string) bool {
+	if strings.HasPrefix(model, "claude-3-7") {
+		return true
+	}
+	for _, prefix := range []string{"claude-3", "claude-2", "claude-instant"} {
+		if strings.HasPrefix(model, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// thinking returns the thinking settings for a request, or nil when it
+// can't think: the model doesn't support it, JSON mode forces a tool call,
+// or the request continues a tool use turn whose thinking wasn't kept
+func (a *Anthropic) thinking(req ChatRequest) *anthropicThinking {
+	if req.Reasoning == nil || req.ResponseSchema != nil || !anthropicThinkingModel(req.Model) {
+		return nil
+	}
+	if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == RoleTool {
+		return nil
+	}
+	budget := req.Reasoning.budget()
+	if budget < anthropicMinThinkingBudget {
+		budget = anthropicMinThinkingBudget
+	}
+	return &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+}
+
+// anthropicToolChoice forces a particular tool
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// anthropicSystem returns the system prompt for a request: nil when there is
+// none, a plain string for a single uncached prompt, and text blocks otherwise
+func anthropicSystem(blocks []anthropicContentBlock) interface{} {
+	switch {
+	case len(blocks) == 0:
+		return nil
+	case len(blocks) == 1 && blocks[0].CacheControl == nil:
+		return blocks[0].Text
+	default:
+		return blocks
+	}
+}
+
+// anthropicJSONTool is the tool Anthropic is forced to call for structured
+// output; its input is the JSON reply
+const anthropicJSONTool = "json_response"
+
+// anthropicJSONSchema returns the tool input schema for a response schema.
+// Tool inputs must be objects, so other schemas are wrapped in a "value"
+// property and wrapped is true.
+func anthropicJSONSchema(schema json.RawMessage) (input json.RawMessage, wrapped bool) {
+	var top struct {
+		Type interface{} `json:"type"`
+	}
+	if json.Unmarshal(schema, &top) == nil && top.Type == "object" {
+		return schema, false
+	}
+	input, _ = json.Marshal(map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]json.RawMessage{"value": schema},
+		"required":   []string{"value"},
+	})
+	return input, true
+}
+
+// anthropicJSONReply returns the JSON reply from the forced tool's input,
+// unwrapping it when the schema was wrapped
+func anthropicJSONReply(input json.RawMessage, wrapped bool) string {
+	if !wrapped {
+		return string(input)
+	}
+	var v struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if json.Unmarshal(input, &v) != nil || v.Value == nil {
+		return string(input)
+	}
+	return string(v.Value)
 }
 
 type anthropicMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+// anthropicContentBlock is a single block of message content. The fields
+// used depend on Type: "text", "thinking", "tool_use" or "tool_result".
+type anthropicContentBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Thinking  string                `json:"thinking,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+	Source    *anthropicImageSource `json:"source,omitempty"`
+
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+// anthropicCacheControl marks the end of a cacheable prompt prefix
+type anthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+// anthropicMaxBreakpoints is the most cache_control blocks a request may have
+const anthropicMaxBreakpoints = 4
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
 }
 
 // anthropicResponse is the response format from Anthropic's messages API
 type anthropicResponse struct {
-	ID           string `json:"id"`
-	Type         string `json:"type"`
-	Role         string `json:"role"`
-	Model        string `json:"model"`
-	Content      []struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
-	} `json:"content"`
-	StopReason string `json:"stop_reason"`
-	Usage      struct {
-		InputTokens  int `json:"input_tokens"`
-		OutputTokens int `json:"output_tokens"`
-	} `json:"usage"`
-	Error *anthropicError `json:"error,omitempty"`
+	ID         string                  `json:"id"`
+	Type       string                  `json:"type"`
+	Role       string                  `json:"role"`
+	Model      string                  `json:"model"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      anthropicUsage          `json:"usage"`
+	Error      *anthropicError         `json:"error,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// usage converts the reported token counts. Anthropic counts cached prompt
+// tokens apart from input_tokens, so they are added to the prompt tokens.
+func (u anthropicUsage) usage() Usage {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	return Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+	}
 }
 
 type anthropicError struct {
@@ -94,67 +247,109 @@ type anthropicError struct {
 type anthropicStreamEvent struct {
 	Type         string `json:"type"`
 	Index        int    `json:"index,omitempty"`
-	ContentBlock *struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
-	} `json:"content_block,omitempty"`
-	Delta *struct {
-		Type string `json:"type"`
-		Text string `json:"text,omitempty"`
+	ContentBlock *anthropicContentBlock `json:"content_block,omitempty"`
+	Delta        *struct {
+		Type        string `json:"type"`
+		Text        string `json:"text,omitempty"`
+		Thinking    string `json:"thinking,omitempty"`
+		PartialJSON string `json:"partial_json,omitempty"`
+		StopReason  string `json:"stop_reason,omitempty"`
 	} `json:"delta,omitempty"`
 	Message *anthropicResponse `json:"message,omitempty"`
+	Usage   *anthropicUsage    `json:"usage,omitempty"` // Cumulative output tokens on message_delta
+	Error   *anthropicError    `json:"error,omitempty"`
 }
 
-// Models returns available Anthropic models
+// Models returns available Anthropic models, falling back to the static list
+// when they can't be fetched
 func (a *Anthropic) Models(ctx context.Context) ([]string, error) {
-	// Return static list as Anthropic doesn't have a models endpoint
-	models := make([]string, 0, len(DefaultModels["anthropic"]))
-	for _, m := range DefaultModels["anthropic"] {
-		models = append(models, m.ID)
-	}
-	return models, nil
+	models, err := a.ListModels(ctx)
+	return modelsOrStatic("anthropic", models, err)
 }
 
-// Send sends a chat request and returns the complete response
-func (a *Anthropic) Send(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+// anthropicModelsResponse is the response format of the models endpoint
+type anthropicModelsResponse struct {
+	Data []struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"display_name"`
+	} `json:"data"`
+}
+
+// ListModels fetches the models available to the API key
+func (a *Anthropic) ListModels(ctx context.Context) ([]ModelInfo, error) {
 	if a.apiKey == "" {
-		return ChatResponse{}, ErrNoAPIKey
+		return nil, ErrNoAPIKey
 	}
 
-	// Extract system message and convert to Anthropic format
-	var systemPrompt string
-	messages := make([]anthropicMessage, 0, len(req.Messages))
-	for _, m := range req.Messages {
-		if m.Role == RoleSystem {
-			systemPrompt = m.Content
-			continue
-		}
-		// Anthropic only accepts "user" and "assistant" roles
-		role := string(m.Role)
-		if role == "tool" {
-			role = "user" // Map tool responses to user
-		}
-		messages = append(messages, anthropicMessage{
-			Role:    role,
-			Content: m.Content,
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", a.baseURL+anthropicModelsEndpoint+"?limit=1000", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("x-api-key", a.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicAPIVersion)
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, anthropicAPIError(resp, respBody)
+	}
+
+	var modelsResp anthropicModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	models := make([]ModelInfo, 0, len(modelsResp.Data))
+	for _, m := range modelsResp.Data {
+		models = append(models, ModelInfo{
+			ID:        m.ID,
+			Name:      m.DisplayName,
+			Provider:  "anthropic",
+			MaxTokens: 200000,
 		})
 	}
+	return mergeModels("anthropic", models), nil
+}
 
-	// Ensure max_tokens is set (required by Anthropic)
-	maxTokens := req.MaxTokens
-	if maxTokens == 0 {
-		maxTokens = 4096
+// UnsupportedParams returns the parameters the Messages API doesn't accept.
+// Thinking requires the default temperature and top_p.
+func (a *Anthropic) UnsupportedParams(req ChatRequest) []string {
+	var unsupported []string
+	if req.Reasoning != nil {
+		switch {
+		case req.ResponseSchema != nil || !anthropicThinkingModel(req.Model):
+			unsupported = append(unsupported, "reasoning")
+		default:
+			if req.Temperature != nil {
+				unsupported = append(unsupported, "temperature")
+			}
+			if req.TopP != nil {
+				unsupported = append(unsupported, "top_p")
+			}
+		}
 	}
+	if req.Seed != nil {
+		unsupported = append(unsupported, "seed")
+	}
+	if req.FrequencyPenalty != nil {
+		unsupported = append(unsupported, "frequency_penalty")
+	}
+	return unsupported
+}
 
-	anthropicReq := anthropicRequest{
-		Model:       req.Model,
-		Messages:    messages,
-		System:      systemPrompt,
-		MaxTokens:   maxTokens,
-		Temperature: req.Temperature,
-		Stream:      false,
+// Send sends a chat request and returns the complete response
+func (a *Anthropic) Send(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	if a.apiKey == "" {
+		return ChatResponse{}, ErrNoAPIKey
 	}
 
+	anthropicReq := a.buildRequest(req, false)
+
 	body, err := json.Marshal(anthropicReq)
 	if err != nil {
 		return ChatResponse{}, fmt.Errorf("failed to marshal request: %w", err)
@@ -183,18 +378,8 @@ func (a *Anthropic) Send(ctx context.Context, req ChatRequest) (ChatResponse, er
 		return ChatResponse{}, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		return ChatResponse{}, ErrRateLimited
-	}
-
 	if resp.StatusCode != http.StatusOK {
-		var errResp struct {
-			Error anthropicError `json:"error"`
-		}
-		if err := json.Unmarshal(respBody, &errResp); err == nil {
-			return ChatResponse{}, fmt.Errorf("API error: %s", errResp.Error.Message)
-		}
-		return ChatResponse{}, fmt.Errorf("API error: status %d", resp.StatusCode)
+		return ChatResponse{}, anthropicAPIError(resp, respBody)
 	}
 
 	var anthropicResp anthropicResponse
@@ -206,73 +391,56 @@ func (a *Anthropic) Send(ctx context.Context, req ChatRequest) (ChatResponse, er
 		return ChatResponse{}, ErrInvalidResponse
 	}
 
-	// Extract text content
-	var content strings.Builder
+	// Extract text content and tool calls. In JSON mode the forced tool's
+	// input is the reply.
+	var content, reasoning strings.Builder
+	var toolCalls []ToolCall
+	stopReason := anthropicResp.StopReason
 	for _, c := range anthropicResp.Content {
-		if c.Type == "text" {
+		switch {
+		case c.Type == "thinking":
+			reasoning.WriteString(c.Thinking)
+		case c.Type == "text" && req.ResponseSchema == nil:
 			content.WriteString(c.Text)
+		case c.Type == "tool_use" && req.ResponseSchema != nil && c.Name == anthropicJSONTool:
+			_, wrapped := anthropicJSONSchema(req.ResponseSchema.Schema)
+			content.WriteString(anthropicJSONReply(c.Input, wrapped))
+			stopReason = "end_turn"
+		case c.Type == "tool_use":
+			toolCalls = append(toolCalls, ToolCall{
+				ID:        c.ID,
+				Name:      c.Name,
+				Arguments: string(c.Input),
+			})
 		}
 	}
 
 	return ChatResponse{
 		Content:      content.String(),
 		Model:        anthropicResp.Model,
-		FinishReason: anthropicResp.StopReason,
-		Usage: Usage{
-			PromptTokens:     anthropicResp.Usage.InputTokens,
-			CompletionTokens: anthropicResp.Usage.OutputTokens,
-			TotalTokens:      anthropicResp.Usage.InputTokens + anthropicResp.Usage.OutputTokens,
-		},
+		FinishReason: stopReason,
+		Usage:        anthropicResp.Usage.usage(),
+		ToolCalls:    toolCalls,
+		Reasoning:    reasoning.String(),
 	}, nil
 }
 
 // Stream sends a chat request and streams the response
-func (a *Anthropic) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string)) error {
+func (a *Anthropic) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (ChatResponse, error) {
 	if a.apiKey == "" {
-		return ErrNoAPIKey
-	}
-
-	// Extract system message and convert to Anthropic format
-	var systemPrompt string
-	messages := make([]anthropicMessage, 0, len(req.Messages))
-	for _, m := range req.Messages {
-		if m.Role == RoleSystem {
-			systemPrompt = m.Content
-			continue
-		}
-		role := string(m.Role)
-		if role == "tool" {
-			role = "user"
-		}
-		messages = append(messages, anthropicMessage{
-			Role:    role,
-			Content: m.Content,
-		})
-	}
-
-	// Ensure max_tokens is set
-	maxTokens := req.MaxTokens
-	if maxTokens == 0 {
-		maxTokens = 4096
+		return ChatResponse{}, ErrNoAPIKey
 	}
 
-	anthropicReq := anthropicRequest{
-		Model:       req.Model,
-		Messages:    messages,
-		System:      systemPrompt,
-		MaxTokens:   maxTokens,
-		Temperature: req.Temperature,
-		Stream:      true,
-	}
+	anthropicReq := a.buildRequest(req, true)
 
 	body, err := json.Marshal(anthropicReq)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return ChatResponse{}, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+anthropicChatEndpoint, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return ChatResponse{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
@@ -283,33 +451,40 @@ func (a *Anthropic) Stream(ctx context.Context, req ChatRequest, onDelta func(de
 	resp, err := a.client.Do(httpReq)
 	if err != nil {
 		if ctx.Err() != nil {
-			return ErrContextCanceled
+			return ChatResponse{}, ErrContextCanceled
 		}
-		return fmt.Errorf("request failed: %w", err)
+		return ChatResponse{}, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		return ErrRateLimited
-	}
-
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		var errResp struct {
-			Error anthropicError `json:"error"`
-		}
-		if err := json.Unmarshal(respBody, &errResp); err == nil {
-			return fmt.Errorf("API error: %s", errResp.Error.Message)
-		}
-		return fmt.Errorf("API error: status %d", resp.StatusCode)
+		return ChatResponse{}, anthropicAPIError(resp, respBody)
 	}
 
 	// Parse SSE stream
+	var content, reasoning strings.Builder
+	onReasoning := reasoningDelta(ctx)
+	result := ChatResponse{Model: req.Model}
+
+	// Tool use blocks stream their input as JSON fragments keyed by block index
+	toolCalls := make(map[int]*ToolCall)
+	var toolOrder []int
+
+	// In JSON mode the forced tool's input is the reply. It streams as it
+	// arrives unless the schema was wrapped, when it is unwrapped at the end.
+	jsonIndex := -1
+	var jsonInput strings.Builder
+	wrapped := false
+	if req.ResponseSchema != nil {
+		_, wrapped = anthropicJSONSchema(req.ResponseSchema.Schema)
+	}
+
 	scanner := bufio.NewScanner(resp.Body)
 	for scanner.Scan() {
 		select {
 		case <-ctx.Done():
-			return ErrContextCanceled
+			return ChatResponse{}, ErrContextCanceled
 		default:
 		}
 
@@ -341,20 +516,226 @@ func (a *Anthropic) Stream(ctx context.Context, req ChatRequest, onDelta func(de
 			continue
 		}
 
-		// Handle content_block_delta events
-		if event.Type == "content_block_delta" && event.Delta != nil && event.Delta.Type == "text_delta" {
-			onDelta(event.Delta.Text)
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				if event.Message.Model != "" {
+					result.Model = event.Message.Model
+				}
+				result.Usage = event.Message.Usage.usage()
+			}
+		case "content_block_start":
+			if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
+				if req.ResponseSchema != nil && event.ContentBlock.Name == anthropicJSONTool {
+					jsonIndex = event.Index
+					continue
+				}
+				toolCalls[event.Index] = &ToolCall{ID: event.ContentBlock.ID, Name: event.ContentBlock.Name}
+				toolOrder = append(toolOrder, event.Index)
+			}
+		case "content_block_delta":
+			if event.Delta == nil {
+				continue
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				if req.ResponseSchema != nil {
+					continue
+				}
+				content.WriteString(event.Delta.Text)
+				onDelta(event.Delta.Text)
+			case "thinking_delta":
+				reasoning.WriteString(event.Delta.Thinking)
+				onReasoning(event.Delta.Thinking)
+			case "input_json_delta":
+				if event.Index == jsonIndex {
+					jsonInput.WriteString(event.Delta.PartialJSON)
+					if !wrapped && event.Delta.PartialJSON != "" {
+						content.WriteString(event.Delta.PartialJSON)
+						onDelta(event.Delta.PartialJSON)
+					}
+					continue
+				}
+				if tc, ok := toolCalls[event.Index]; ok {
+					tc.Arguments += event.Delta.PartialJSON
+				}
+			}
+		case "message_delta":
+			if event.Delta != nil && event.Delta.StopReason != "" {
+				result.FinishReason = event.Delta.StopReason
+			}
+			if event.Usage != nil {
+				result.Usage.CompletionTokens = event.Usage.OutputTokens
+			}
+		case "error":
+			// Errors such as overloaded_error can arrive after a 200 response
+			if event.Error != nil {
+				return ChatResponse{}, newStreamError("anthropic", event.Error.Type, event.Error.Message)
+			}
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("stream error: %w", err)
+		return ChatResponse{}, fmt.Errorf("stream error: %w", err)
 	}
 
-	return nil
+	if jsonIndex >= 0 {
+		if wrapped {
+			reply := anthropicJSONReply(json.RawMessage(jsonInput.String()), true)
+			content.WriteString(reply)
+			onDelta(reply)
+		}
+		result.FinishReason = "end_turn"
+	}
+	result.Content = content.String()
+	result.Reasoning = reasoning.String()
+	result.Usage.TotalTokens = result.Usage.PromptTokens + result.Usage.CompletionTokens
+	for _, idx := range toolOrder {
+		result.ToolCalls = append(result.ToolCalls, *toolCalls[idx])
+	}
+	return result, nil
 }
 
-// SetAPIKey updates the API key
-func (a *Anthropic) SetAPIKey(key string) {
-	a.apiKey = key
+// buildRequest constructs an Anthropic API request from a ChatRequest
+func (a *Anthropic) buildRequest(req ChatRequest, stream bool) anthropicRequest {
+	// System messages become system text blocks. Messages marked as cache
+	// breakpoints get cache_control on their last block, up to the limit.
+	var system []anthropicContentBlock
+	breakpoints := 0
+	cacheControl := func(m Message) *anthropicCacheControl {
+		if !m.CacheBreakpoint || breakpoints >= anthropicMaxBreakpoints {
+			return nil
+		}
+		breakpoints++
+		return &anthropicCacheControl{Type: "ephemeral"}
+	}
+
+	messages := make([]anthropicMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		if m.Role == RoleSystem {
+			system = append(system, anthropicContentBlock{
+				Type:         "text",
+				Text:         m.Text(),
+				CacheControl: cacheControl(m),
+			})
+			continue
+		}
+
+		// Anthropic only accepts "user" and "assistant" roles;
+		// tool results are sent back as user content blocks
+		role := string(m.Role)
+		var blocks []anthropicContentBlock
+		if m.Role == RoleTool {
+			role = "user"
+			blocks = append(blocks, anthropicContentBlock{
+				Type:      "tool_result",
+				ToolUseID: m.ToolCallID,
+				Content:   m.Content,
+			})
+		} else {
+			for _, part := range m.ContentParts() {
+				switch part.Type {
+				case PartText:
+					if part.Text != "" {
+						blocks = append(blocks, anthropicContentBlock{Type: "text", Text: part.Text})
+					}
+				case PartImage:
+					blocks = append(blocks, anthropicContentBlock{
+						Type: "image",
+						Source: &anthropicImageSource{
+							Type:      "base64",
+							MediaType: part.MIMEType,
+							Data:      base64.StdEncoding.EncodeToString(part.Data),
+						},
+					})
+				}
+			}
+		}
+		for _, tc := range m.ToolCalls {
+			blocks = append(blocks, anthropicContentBlock{
+				Type:  "tool_use",
+				ID:    tc.ID,
+				Name:  tc.Name,
+				Input: toolArguments(tc),
+			})
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		blocks[len(blocks)-1].CacheControl = cacheControl(m)
+
+		// Merge consecutive turns from the same role, which is required
+		// for several tool results answering a single assistant turn
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			messages[n-1].Content = append(messages[n-1].Content, blocks...)
+			continue
+		}
+		messages = append(messages, anthropicMessage{
+			Role:    role,
+			Content: blocks,
+		})
+	}
+
+	// Ensure max_tokens is set (required by Anthropic)
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = 4096
+	}
+
+	anthropicReq := anthropicRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		System:      anthropicSystem(system),
+		MaxTokens:   maxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stop:        req.Stop,
+		Stream:      stream,
+	}
+
+	// Thinking needs the default sampling and a max_tokens above its budget
+	if thinking := a.thinking(req); thinking != nil {
+		anthropicReq.Thinking = thinking
+		anthropicReq.Temperature = nil
+		anthropicReq.TopP = nil
+		if anthropicReq.MaxTokens <= thinking.BudgetTokens {
+			anthropicReq.MaxTokens = thinking.BudgetTokens + maxTokens
+		}
+	}
+
+	if req.ResponseSchema != nil {
+		input, _ := anthropicJSONSchema(req.ResponseSchema.Schema)
+		anthropicReq.Tools = append(anthropicReq.Tools, anthropicTool{
+			Name:        anthropicJSONTool,
+			Description: "Reply with a JSON document matching the schema " + req.ResponseSchema.name(),
+			InputSchema: input,
+		})
+		anthropicReq.ToolChoice = &anthropicToolChoice{Type: "tool", Name: anthropicJSONTool}
+	}
+
+	for _, t := range req.Tools {
+		schema := t.Parameters
+		if len(schema) == 0 {
+			// input_schema is required even for tools without arguments
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		anthropicReq.Tools = append(anthropicReq.Tools, anthropicTool{
+			Name:        t.Name,
+			Description: t.Description,
+			InputSchema: schema,
+		})
+	}
+
+	return anthropicReq
+}
+
+// anthropicAPIError converts an error response into an Error
+func anthropicAPIError(resp *http.Response, body []byte) error {
+	var errResp struct {
+		Error anthropicError `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errResp); err == nil {
+		return newAPIError("anthropic", resp, errResp.Error.Type, errResp.Error.Message)
+	}
+	return newAPIError("anthropic", resp, "", "")
 }
@@ -0,0 +1,136 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is a failed API call, carrying what the provider told us about it
+type Error struct {
+	// Provider is the name of the provider that returned the error
+	Provider string
+	// StatusCode is the HTTP status, or 0 for errors reported mid-stream
+	StatusCode int
+	// Code is the provider's error type, e.g. "overloaded_error" or
+	// "RESOURCE_EXHAUSTED"
+	Code string
+	// Message is the provider's human-readable message
+	Message string
+	// Retryable is true if the same request may succeed later
+	Retryable bool
+	// RetryAfter is the delay requested by the provider, if any
+	RetryAfter time.Duration
+}
+
+// Error formats the error for display
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Provider)
+	b.WriteString(" API error")
+	if e.StatusCode != 0 {
+		b.WriteString(fmt.Sprintf(" (status %d", e.StatusCode))
+		if e.Code != "" {
+			b.WriteString(", " + e.Code)
+		}
+		b.WriteString(")")
+	} else if e.Code != "" {
+		b.WriteString(" (" + e.Code + ")")
+	}
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	return b.String()
+}
+
+// Is lets errors.Is match rate limit errors against ErrRateLimited
+func (e *Error) Is(target error) bool {
+	return target == ErrRateLimited && e.StatusCode == http.StatusTooManyRequests
+}
+
+// Reason returns a short description of the failure, e.g. "overloaded"
+func (e *Error) Reason() string {
+	switch {
+	case e.StatusCode == 529 || strings.Contains(strings.ToLower(e.Code), "overloaded"):
+		return "overloaded"
+	case e.StatusCode == http.StatusTooManyRequests || e.Code == "RESOURCE_EXHAUSTED":
+		return "rate limited"
+	case e.StatusCode >= 500:
+		return "server error"
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return "authentication failed"
+	default:
+		return "request failed"
+	}
+}
+
+// newAPIError builds an Error from an HTTP response and the code and message
+// parsed from its body
+func newAPIError(provider string, resp *http.Response, code, message string) *Error {
+	e := &Error{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Code:       code,
+		Message:    message,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+	e.Retryable = isRetryableStatus(resp.StatusCode) || isRetryableCode(code)
+	return e
+}
+
+// newStreamError builds an Error for a failure reported inside a stream
+func newStreamError(provider, code, message string) *Error {
+	return &Error{
+		Provider:  provider,
+		Code:      code,
+		Message:   message,
+		Retryable: isRetryableCode(code),
+	}
+}
+
+// isRetryableStatus reports whether an HTTP status indicates a transient failure
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, 529:
+		return true
+	}
+	return status >= 500 && status != http.StatusNotImplemented
+}
+
+// isRetryableCode reports whether a provider error type indicates a
+// transient failure
+func isRetryableCode(code string) bool {
+	switch code {
+	case "overloaded_error", "rate_limit_error", "api_error", // Anthropic
+		"rate_limit_exceeded", "server_error", // OpenAI
+		"RESOURCE_EXHAUSTED", "UNAVAILABLE", "INTERNAL": // Gemini
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an
+// HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// IsRetryable reports whether err is a provider error worth retrying
+func IsRetryable(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Retryable
+}
@@ -0,0 +1,210 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FallbackProviderName is the registry name of the fallback provider. Its
+// models are the configured chain names, so "/model fallback/default" selects
+// the chain called "default".
+const FallbackProviderName = "fallback"
+
+// Target is one provider and model in a fallback chain
+type Target struct {
+	Provider string
+	Model    string
+}
+
+// String formats the target as "provider/model"
+func (t Target) String() string {
+	return t.Provider + "/" + t.Model
+}
+
+// ParseChain parses an ordered fallback chain such as
+// "anthropic/claude-sonnet-4 -> openai/gpt-4o". Models may themselves contain
+// slashes (e.g. "openrouter/openai/gpt-4o").
+func ParseChain(chain string) ([]Target, error) {
+	var targets []Target
+	for _, item := range strings.Split(chain, "->") {
+		item = strings.TrimSpace(item)
+		parts := strings.SplitN(item, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid fallback target %q, expected provider/model", item)
+		}
+		targets = append(targets, Target{Provider: parts[0], Model: parts[1]})
+	}
+	return targets, nil
+}
+
+// FallbackNotice describes a switch to the next target in a chain
+type FallbackNotice struct {
+	From Target
+	To   Target
+	Err  error
+}
+
+// String formats the notice for the status bar, e.g.
+// "anthropic overloaded, falling back to openai/gpt-4o"
+func (n FallbackNotice) String() string {
+	reason := "failed"
+	var apiErr *Error
+	if errors.As(n.Err, &apiErr) {
+		reason = apiErr.Reason()
+	} else if errors.Is(n.Err, ErrNoAPIKey) {
+		reason = "has no API key"
+	} else if errors.Is(n.Err, ErrOverBudget) {
+		reason = "is over budget"
+	}
+	return fmt.Sprintf("%s %s, falling back to %s", n.From.Provider, reason, n.To)
+}
+
+type fallbackNoticeKey struct{}
+
+// WithFallbackNotice returns a context that reports fallbacks made while
+// serving a request to fn
+func WithFallbackNotice(ctx context.Context, fn func(FallbackNotice)) context.Context {
+	return context.WithValue(ctx, fallbackNoticeKey{}, fn)
+}
+
+// Fallback is a provider that tries the targets of a chain in order, moving
+// to the next target when one fails with a retryable error, has no API key
+// or is over budget. The answering provider is reported in
+// ChatResponse.Provider. Targets are not retried; callers should not retry
+// the chain either, as that would call every target again.
+type Fallback struct {
+	registry *Registry
+	chains   map[string][]Target
+	settings Settings
+}
+
+// NewFallback creates a fallback provider over the providers in registry.
+// chains maps chain names to their ordered targets.
+func NewFallback(registry *Registry, chains map[string][]Target) *Fallback {
+	return &Fallback{
+		registry: registry,
+		chains:   chains,
+	}
+}
+
+// Factory returns a Factory that builds the fallback provider with settings.
+// Targets are built per request with their own API keys and the other
+// settings passed on.
+func (f *Fallback) Factory() Factory {
+	return func(s Settings) Provider {
+		built := *f
+		built.settings = Settings{Search: s.Search, Budget: s.Budget}
+		return &built
+	}
+}
+
+// Name returns the provider identifier
+func (f *Fallback) Name() string {
+	return FallbackProviderName
+}
+
+// Models returns the names of the configured chains
+func (f *Fallback) Models(ctx context.Context) ([]string, error) {
+	return sortedChainNames(f.chains), nil
+}
+
+// SupportsStreaming returns true; targets that can't stream deliver their
+// whole answer as one delta
+func (f *Fallback) SupportsStreaming() bool {
+	return true
+}
+
+// Keyless returns true as each target checks its own API key
+func (f *Fallback) Keyless() bool {
+	return true
+}
+
+// Send sends the request to each target in turn until one answers
+func (f *Fallback) Send(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	return f.run(ctx, req, func(p Provider, req ChatRequest) (ChatResponse, bool, error) {
+		resp, err := p.Send(ctx, req)
+		return resp, false, err
+	})
+}
+
+// Stream streams the request from each target in turn until one answers. A
+// target that fails after streaming part of its answer is not replaced, as
+// the caller has already shown that part.
+func (f *Fallback) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (ChatResponse, error) {
+	return f.run(ctx, req, func(p Provider, req ChatRequest) (ChatResponse, bool, error) {
+		if !p.SupportsStreaming() {
+			resp, err := p.Send(ctx, req)
+			if err == nil {
+				onDelta(resp.Content)
+			}
+			return resp, false, err
+		}
+		streamed := false
+		resp, err := p.Stream(ctx, req, func(delta string) {
+			streamed = true
+			onDelta(delta)
+		})
+		return resp, streamed, err
+	})
+}
+
+// run calls try for each target of the chain named by req.Model
+func (f *Fallback) run(ctx context.Context, req ChatRequest, try func(Provider, ChatRequest) (ChatResponse, bool, error)) (ChatResponse, error) {
+	targets, ok := f.chains[req.Model]
+	if !ok || len(targets) == 0 {
+		return ChatResponse{}, fmt.Errorf("unknown fallback chain: %s", req.Model)
+	}
+	notify, _ := ctx.Value(fallbackNoticeKey{}).(func(FallbackNotice))
+
+	var lastErr error
+	for i, target := range targets {
+		p, ok := f.registry.build(target.Provider, f.settings)
+		if !ok {
+			lastErr = fmt.Errorf("unknown provider: %s", target.Provider)
+			continue
+		}
+
+		var resp ChatResponse
+		var streamed bool
+		var err error
+		if f.settings.Budget != nil {
+			err = f.settings.Budget(target.Provider)
+		}
+		if err == nil {
+			targetReq := req
+			targetReq.Model = target.Model
+			resp, streamed, err = try(p, targetReq)
+		}
+		resp.Provider = target.Provider
+		if resp.Model == "" {
+			resp.Model = target.Model
+		}
+		if err == nil {
+			return resp, nil
+		}
+
+		lastErr = err
+		if streamed || !(IsRetryable(err) || errors.Is(err, ErrNoAPIKey) || errors.Is(err, ErrOverBudget)) {
+			// The response still names the target, so what it was billed
+			// for can be recorded
+			return resp, err
+		}
+		if notify != nil && i+1 < len(targets) {
+			notify(FallbackNotice{From: target, To: targets[i+1], Err: err})
+		}
+	}
+	return ChatResponse{}, lastErr
+}
+
+// sortedChainNames returns the chain names in a stable order
+func sortedChainNames(chains map[string][]Target) []string {
+	names := make([]string, 0, len(chains))
+	for name := range chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,32 +18,39 @@ const (
 
 // Gemini implements the Provider interface for Google's Gemini API
 type Gemini struct {
-	apiKey        string
-	baseURL       string
-	client        *http.Client
-	enableSearch  bool // Enable Google Search grounding
-	enableThought bool // Enable thinking/reasoning mode
+	apiKey       string
+	baseURL      string
+	client       *http.Client
+	enableSearch bool // Enable Google Search grounding
 }
 
 // NewGemini creates a new Gemini provider
 func NewGemini(apiKey string) *Gemini {
 	return &Gemini{
-		apiKey:        apiKey,
-		baseURL:       geminiBaseURL,
-		client:        &http.Client{},
-		enableSearch:  false,
-		enableThought: false,
+		apiKey:       apiKey,
+		baseURL:      geminiBaseURL,
+		client:       &http.Client{},
+		enableSearch: false,
 	}
 }
 
-// NewGeminiWithOptions creates a new Gemini provider with options
-func NewGeminiWithOptions(apiKey string, enableSearch, enableThought bool) *Gemini {
+// NewGeminiWithClient creates a new Gemini provider with a custom HTTP client
+func NewGeminiWithClient(apiKey string, client *http.Client) *Gemini {
 	return &Gemini{
-		apiKey:        apiKey,
-		baseURL:       geminiBaseURL,
-		client:        &http.Client{},
-		enableSearch:  enableSearch,
-		enableThought: enableThought,
+		apiKey:  apiKey,
+		baseURL: geminiBaseURL,
+		client:  client,
+	}
+}
+
+// NewGeminiWithSettings creates a Gemini provider from factory settings with
+// a custom HTTP client. Search grounding follows s.Search.
+func NewGeminiWithSettings(s Settings, client *http.Client) *Gemini {
+	return &Gemini{
+		apiKey:       s.APIKey,
+		baseURL:      geminiBaseURL,
+		client:       client,
+		enableSearch: s.Search,
 	}
 }
 
@@ -56,16 +64,6 @@ func (g *Gemini) SupportsStreaming() bool {
 	return true
 }
 
-// SetSearchEnabled enables or disables Google Search grounding
-func (g *Gemini) SetSearchEnabled(enabled bool) {
-	g.enableSearch = enabled
-}
-
-// SetThinkingEnabled enables or disables thinking mode
-func (g *Gemini) SetThinkingEnabled(enabled bool) {
-	g.enableThought = enabled
-}
-
 // Gemini API request/response types
 type geminiRequest struct {
 	Contents          []geminiContent        `json:"contents"`
@@ -80,27 +78,55 @@ type geminiContent struct {
 }
 
 type geminiPart struct {
-	Text    string           `json:"text,omitempty"`
-	Thought *geminiThought   `json:"thought,omitempty"`
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"` // Text is a thought summary
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+	InlineData       *geminiInlineData       `json:"inlineData,omitempty"`
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"` // Base64-encoded bytes
 }
 
-type geminiThought struct {
-	Text string `json:"text"`
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
 }
 
 type geminiGenerationConfig struct {
-	Temperature       float64 `json:"temperature,omitempty"`
-	MaxOutputTokens   int     `json:"maxOutputTokens,omitempty"`
-	ThinkingConfig    *geminiThinkingConfig `json:"thinkingConfig,omitempty"`
+	Temperature      *float64              `json:"temperature,omitempty"`
+	TopP             *float64              `json:"topP,omitempty"`
+	MaxOutputTokens  int                   `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string              `json:"stopSequences,omitempty"`
+	Seed             *int64                `json:"seed,omitempty"`
+	FrequencyPenalty *float64              `json:"frequencyPenalty,omitempty"`
+	ResponseMIMEType string                `json:"responseMimeType,omitempty"`
+	ResponseSchema   json.RawMessage       `json:"responseSchema,omitempty"`
+	ThinkingConfig   *geminiThinkingConfig `json:"thinkingConfig,omitempty"`
 }
 
 type geminiThinkingConfig struct {
-	ThinkingBudget int    `json:"thinkingBudget,omitempty"` // Token budget for thinking (Gemini 2.x)
-	ThinkingLevel  string `json:"thinkingLevel,omitempty"`  // Thinking level: "low", "medium", "high" (Gemini 3.x)
+	ThinkingBudget  int    `json:"thinkingBudget,omitempty"`  // Token budget for thinking (Gemini 2.x)
+	ThinkingLevel   string `json:"thinkingLevel,omitempty"`   // Thinking level: "low", "medium", "high" (Gemini 3.x)
+	IncludeThoughts bool   `json:"includeThoughts,omitempty"` // Return thought summaries
 }
 
 type geminiTool struct {
-	GoogleSearch *geminiGoogleSearch `json:"googleSearch,omitempty"`
+	GoogleSearch         *geminiGoogleSearch         `json:"googleSearch,omitempty"`
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations,omitempty"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
 }
 
 type geminiGoogleSearch struct {
@@ -129,13 +155,71 @@ type geminiGroundingMetadata struct {
 			Title string `json:"title"`
 		} `json:"web,omitempty"`
 	} `json:"groundingChunks,omitempty"`
+	// GroundingSupports link parts of the answer to the chunks backing them
+	GroundingSupports []struct {
+		Segment struct {
+			StartIndex int    `json:"startIndex"`
+			EndIndex   int    `json:"endIndex"`
+			Text       string `json:"text"`
+		} `json:"segment"`
+		GroundingChunkIndices []int `json:"groundingChunkIndices"`
+	} `json:"groundingSupports,omitempty"`
+}
+
+// citations converts grounding metadata into citations of content. Segment
+// offsets count bytes within a single part, so a segment whose offsets don't
+// match content is located by its text instead.
+func (meta *geminiGroundingMetadata) citations(content string) []Citation {
+	if meta == nil {
+		return nil
+	}
+
+	var citations []Citation
+	index := make(map[int]int) // Chunk index to citation index
+	for i, chunk := range meta.GroundingChunks {
+		if chunk.Web == nil || chunk.Web.URI == "" {
+			continue
+		}
+		index[i] = len(citations)
+		citations = append(citations, Citation{Title: chunk.Web.Title, URI: chunk.Web.URI})
+	}
+
+	for _, support := range meta.GroundingSupports {
+		seg := support.Segment
+		span, ok := CitationSpan{Start: seg.StartIndex, End: seg.EndIndex, Text: seg.Text}.Locate(content)
+		if !ok {
+			continue
+		}
+		for _, i := range support.GroundingChunkIndices {
+			if c, ok := index[i]; ok {
+				citations[c].Spans = append(citations[c].Spans, span)
+			}
+		}
+	}
+	return citations
 }
 
 type geminiUsageMetadata struct {
-	PromptTokenCount     int `json:"promptTokenCount"`
-	CandidatesTokenCount int `json:"candidatesTokenCount"`
-	TotalTokenCount      int `json:"totalTokenCount"`
-	ThoughtsTokenCount   int `json:"thoughtsTokenCount,omitempty"`
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount,omitempty"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount,omitempty"`
+}
+
+// usage converts the reported token counts. Gemini counts thoughts apart
+// from the candidates, so they are added to the completion tokens.
+func (m *geminiUsageMetadata) usage() Usage {
+	if m == nil {
+		return Usage{}
+	}
+	return Usage{
+		PromptTokens:     m.PromptTokenCount,
+		CompletionTokens: m.CandidatesTokenCount + m.ThoughtsTokenCount,
+		TotalTokens:      m.TotalTokenCount,
+		ThinkingTokens:   m.ThoughtsTokenCount,
+		CacheReadTokens:  m.CachedContentTokenCount,
+	}
 }
 
 type geminiError struct {
@@ -144,13 +228,76 @@ type geminiError struct {
 	Status  string `json:"status"`
 }
 
-// Models returns available Gemini models
+// Models returns available Gemini models, falling back to the static list
+// when they can't be fetched
 func (g *Gemini) Models(ctx context.Context) ([]string, error) {
-	models := make([]string, 0, len(DefaultModels["gemini"]))
-	for _, m := range DefaultModels["gemini"] {
-		models = append(models, m.ID)
+	models, err := g.ListModels(ctx)
+	return modelsOrStatic("gemini", models, err)
+}
+
+// geminiModelsResponse is the response format of the models endpoint
+type geminiModelsResponse struct {
+	Models []struct {
+		Name                       string   `json:"name"` // "models/gemini-2.0-flash"
+		DisplayName                string   `json:"displayName"`
+		Description                string   `json:"description"`
+		InputTokenLimit            int      `json:"inputTokenLimit"`
+		SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+	} `json:"models"`
+}
+
+// ListModels fetches the models that support content generation
+func (g *Gemini) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	if g.apiKey == "" {
+		return nil, ErrNoAPIKey
+	}
+
+	endpoint := fmt.Sprintf("%s/models?pageSize=1000&key=%s", g.baseURL, g.apiKey)
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	return models, nil
+
+	resp, err := g.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, geminiAPIError(resp, respBody)
+	}
+
+	var modelsResp geminiModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	var models []ModelInfo
+	for _, m := range modelsResp.Models {
+		if !containsString(m.SupportedGenerationMethods, "generateContent") {
+			continue
+		}
+		models = append(models, ModelInfo{
+			ID:          strings.TrimPrefix(m.Name, "models/"),
+			Name:        m.DisplayName,
+			Provider:    "gemini",
+			MaxTokens:   m.InputTokenLimit,
+			Description: m.Description,
+		})
+	}
+	return mergeModels("gemini", models), nil
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
 
 // Send sends a chat request and returns the complete response
@@ -189,16 +336,8 @@ func (g *Gemini) Send(ctx context.Context, req ChatRequest) (ChatResponse, error
 		return ChatResponse{}, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		return ChatResponse{}, ErrRateLimited
-	}
-
 	if resp.StatusCode != http.StatusOK {
-		var errResp geminiResponse
-		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error != nil {
-			return ChatResponse{}, fmt.Errorf("API error: %s", errResp.Error.Message)
-		}
-		return ChatResponse{}, fmt.Errorf("API error: status %d", resp.StatusCode)
+		return ChatResponse{}, geminiAPIError(resp, respBody)
 	}
 
 	var geminiResp geminiResponse
@@ -210,73 +349,50 @@ func (g *Gemini) Send(ctx context.Context, req ChatRequest) (ChatResponse, error
 		return ChatResponse{}, ErrInvalidResponse
 	}
 
-	// Extract text content and any thinking content
-	var content strings.Builder
-	var hasThinking bool
+	// Extract text content, thought summaries and function calls
+	var content, reasoning strings.Builder
+	var toolCalls []ToolCall
 
 	for _, part := range geminiResp.Candidates[0].Content.Parts {
-		if part.Thought != nil {
-			if !hasThinking {
-				content.WriteString("<thinking>\n")
-				hasThinking = true
-			}
-			content.WriteString(part.Thought.Text)
-			content.WriteString("\n")
-		} else if part.Text != "" {
-			if hasThinking {
-				content.WriteString("</thinking>\n\n")
-				hasThinking = false
-			}
+		switch {
+		case part.FunctionCall != nil:
+			toolCalls = append(toolCalls, geminiToolCall(part.FunctionCall, len(toolCalls)))
+		case part.Thought:
+			reasoning.WriteString(part.Text)
+		default:
 			content.WriteString(part.Text)
 		}
 	}
-	if hasThinking {
-		content.WriteString("</thinking>\n\n")
-	}
-
-	// Append grounding information if available
-	if meta := geminiResp.Candidates[0].GroundingMetadata; meta != nil && len(meta.GroundingChunks) > 0 {
-		content.WriteString("\n\n---\n**Sources:**\n")
-		for _, chunk := range meta.GroundingChunks {
-			if chunk.Web != nil {
-				content.WriteString(fmt.Sprintf("- [%s](%s)\n", chunk.Web.Title, chunk.Web.URI))
-			}
-		}
-	}
-
-	usage := Usage{}
-	if geminiResp.UsageMetadata != nil {
-		usage.PromptTokens = geminiResp.UsageMetadata.PromptTokenCount
-		usage.CompletionTokens = geminiResp.UsageMetadata.CandidatesTokenCount
-		usage.TotalTokens = geminiResp.UsageMetadata.TotalTokenCount
-	}
 
 	return ChatResponse{
 		Content:      content.String(),
 		Model:        req.Model,
 		FinishReason: geminiResp.Candidates[0].FinishReason,
-		Usage:        usage,
+		Usage:        geminiResp.UsageMetadata.usage(),
+		ToolCalls:    toolCalls,
+		Reasoning:    reasoning.String(),
+		Citations:    geminiResp.Candidates[0].GroundingMetadata.citations(content.String()),
 	}, nil
 }
 
 // Stream sends a chat request and streams the response
-func (g *Gemini) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string)) error {
+func (g *Gemini) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (ChatResponse, error) {
 	if g.apiKey == "" {
-		return ErrNoAPIKey
+		return ChatResponse{}, ErrNoAPIKey
 	}
 
 	geminiReq := g.buildRequest(req)
 
 	body, err := json.Marshal(geminiReq)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return ChatResponse{}, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	endpoint := fmt.Sprintf("%s/models/%s:streamGenerateContent?key=%s&alt=sse", g.baseURL, req.Model, g.apiKey)
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return ChatResponse{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
@@ -285,37 +401,37 @@ func (g *Gemini) Stream(ctx context.Context, req ChatRequest, onDelta func(delta
 	resp, err := g.client.Do(httpReq)
 	if err != nil {
 		if ctx.Err() != nil {
-			return ErrContextCanceled
+			return ChatResponse{}, ErrContextCanceled
 		}
-		return fmt.Errorf("request failed: %w", err)
+		return ChatResponse{}, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		return ErrRateLimited
-	}
-
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		var errResp geminiResponse
-		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error != nil {
-			return fmt.Errorf("API error: %s", errResp.Error.Message)
-		}
-		return fmt.Errorf("API error: status %d", resp.StatusCode)
+		return ChatResponse{}, geminiAPIError(resp, respBody)
 	}
 
+	// Everything passed to the caller is also collected for the final response
+	var content strings.Builder
+	result := ChatResponse{Model: req.Model}
+	emit := func(delta string) {
+		content.WriteString(delta)
+		onDelta(delta)
+	}
+
+	// Thought summaries are collected and reported apart from the answer
+	var reasoning strings.Builder
+	onReasoning := reasoningDelta(ctx)
+
 	// Parse SSE stream
 	scanner := bufio.NewScanner(resp.Body)
-	var inThinking bool
-	var groundingChunks []struct {
-		Title string
-		URI   string
-	}
+	var grounding *geminiGroundingMetadata
 
 	for scanner.Scan() {
 		select {
 		case <-ctx.Done():
-			return ErrContextCanceled
+			return ChatResponse{}, ErrContextCanceled
 		default:
 		}
 
@@ -338,56 +454,44 @@ func (g *Gemini) Stream(ctx context.Context, req ChatRequest, onDelta func(delta
 			continue // Skip malformed chunks
 		}
 
+		// Each chunk carries the running totals
+		if streamResp.UsageMetadata != nil {
+			result.Usage = streamResp.UsageMetadata.usage()
+		}
+
 		if len(streamResp.Candidates) > 0 {
 			candidate := streamResp.Candidates[0]
+			if candidate.FinishReason != "" {
+				result.FinishReason = candidate.FinishReason
+			}
 
-			// Collect grounding metadata
-			if meta := candidate.GroundingMetadata; meta != nil {
-				for _, chunk := range meta.GroundingChunks {
-					if chunk.Web != nil {
-						groundingChunks = append(groundingChunks, struct {
-							Title string
-							URI   string
-						}{Title: chunk.Web.Title, URI: chunk.Web.URI})
-					}
-				}
+			// Grounding metadata arrives with the last chunks and covers
+			// the whole answer
+			if candidate.GroundingMetadata != nil {
+				grounding = candidate.GroundingMetadata
 			}
 
 			for _, part := range candidate.Content.Parts {
-				if part.Thought != nil {
-					if !inThinking {
-						onDelta("<thinking>\n")
-						inThinking = true
-					}
-					onDelta(part.Thought.Text)
+				if part.FunctionCall != nil {
+					result.ToolCalls = append(result.ToolCalls, geminiToolCall(part.FunctionCall, len(result.ToolCalls)))
+				} else if part.Thought {
+					reasoning.WriteString(part.Text)
+					onReasoning(part.Text)
 				} else if part.Text != "" {
-					if inThinking {
-						onDelta("\n</thinking>\n\n")
-						inThinking = false
-					}
-					onDelta(part.Text)
+					emit(part.Text)
 				}
 			}
 		}
 	}
 
-	if inThinking {
-		onDelta("\n</thinking>\n\n")
-	}
-
-	// Append sources at the end if we have grounding data
-	if len(groundingChunks) > 0 {
-		onDelta("\n\n---\n**Sources:**\n")
-		for _, chunk := range groundingChunks {
-			onDelta(fmt.Sprintf("- [%s](%s)\n", chunk.Title, chunk.URI))
-		}
-	}
-
 	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("stream error: %w", err)
+		return ChatResponse{}, fmt.Errorf("stream error: %w", err)
 	}
 
-	return nil
+	result.Content = content.String()
+	result.Reasoning = reasoning.String()
+	result.Citations = grounding.citations(result.Content)
+	return result, nil
 }
 
 // buildRequest constructs a Gemini API request from a ChatRequest
@@ -402,14 +506,54 @@ func (g *Gemini) buildRequest(req ChatRequest) geminiRequest {
 		} else if msg.Role == RoleSystem {
 			// System messages become systemInstruction
 			systemInstruction = &geminiContent{
-				Parts: []geminiPart{{Text: msg.Content}},
+				Parts: []geminiPart{{Text: msg.Text()}},
 			}
 			continue
 		}
 
+		var parts []geminiPart
+		if msg.Role == RoleTool {
+			parts = append(parts, geminiPart{
+				FunctionResponse: &geminiFunctionResponse{
+					Name:     msg.Name,
+					Response: geminiToolResult(msg.Content),
+				},
+			})
+		} else {
+			for _, part := range msg.ContentParts() {
+				switch part.Type {
+				case PartText:
+					if part.Text != "" {
+						parts = append(parts, geminiPart{Text: part.Text})
+					}
+				case PartImage:
+					parts = append(parts, geminiPart{
+						InlineData: &geminiInlineData{
+							MimeType: part.MIMEType,
+							Data:     base64.StdEncoding.EncodeToString(part.Data),
+						},
+					})
+				}
+			}
+		}
+		for _, tc := range msg.ToolCalls {
+			parts = append(parts, geminiPart{
+				FunctionCall: &geminiFunctionCall{Name: tc.Name, Args: toolArguments(tc)},
+			})
+		}
+		if len(parts) == 0 {
+			continue
+		}
+
+		// Merge consecutive turns from the same role so that all function
+		// responses for one model turn are sent together
+		if n := len(contents); n > 0 && contents[n-1].Role == role {
+			contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+			continue
+		}
 		contents = append(contents, geminiContent{
-			Role: role,
-			Parts: []geminiPart{{Text: msg.Content}},
+			Role:  role,
+			Parts: parts,
 		})
 	}
 
@@ -419,30 +563,40 @@ func (g *Gemini) buildRequest(req ChatRequest) geminiRequest {
 	}
 
 	// Add generation config
-	config := &geminiGenerationConfig{}
-	if req.Temperature > 0 {
-		config.Temperature = req.Temperature
+	config := &geminiGenerationConfig{
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		MaxOutputTokens:  req.MaxTokens,
+		StopSequences:    req.Stop,
+		Seed:             req.Seed,
+		FrequencyPenalty: req.FrequencyPenalty,
 	}
-	if req.MaxTokens > 0 {
-		config.MaxOutputTokens = req.MaxTokens
+	if req.ResponseSchema != nil {
+		config.ResponseMIMEType = "application/json"
+		config.ResponseSchema = geminiSchema(req.ResponseSchema.Schema)
 	}
 
 	// Enable thinking mode for supported models
-	if g.enableThought && isThinkingModel(req.Model) {
+	reasoning := req.Reasoning
+	if reasoning != nil && isThinkingModel(req.Model) {
 		if isGemini3Model(req.Model) {
 			// Gemini 3 uses thinking_level parameter
 			config.ThinkingConfig = &geminiThinkingConfig{
-				ThinkingLevel: "medium", // Options: "low", "medium", "high"
+				ThinkingLevel:   reasoning.effort(),
+				IncludeThoughts: true,
 			}
 		} else {
 			// Gemini 2.x uses thinkingBudget parameter
 			config.ThinkingConfig = &geminiThinkingConfig{
-				ThinkingBudget: 8192, // Default thinking budget
+				ThinkingBudget:  reasoning.budget(),
+				IncludeThoughts: true,
 			}
 		}
 	}
 
-	if config.Temperature > 0 || config.MaxOutputTokens > 0 || config.ThinkingConfig != nil {
+	if config.Temperature != nil || config.TopP != nil || config.MaxOutputTokens > 0 ||
+		len(config.StopSequences) > 0 || config.Seed != nil || config.FrequencyPenalty != nil ||
+		config.ResponseMIMEType != "" || config.ThinkingConfig != nil {
 		geminiReq.GenerationConfig = config
 	}
 
@@ -453,9 +607,140 @@ func (g *Gemini) buildRequest(req ChatRequest) geminiRequest {
 		}
 	}
 
+	// Add function declarations
+	if len(req.Tools) > 0 {
+		decls := make([]geminiFunctionDeclaration, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			decls = append(decls, geminiFunctionDeclaration{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			})
+		}
+		geminiReq.Tools = append(geminiReq.Tools, geminiTool{FunctionDeclarations: decls})
+	}
+
 	return geminiReq
 }
 
+// geminiToolCall converts a Gemini function call into a ToolCall. Gemini does
+// not assign call IDs, so one is derived from the call's position.
+func geminiToolCall(fc *geminiFunctionCall, index int) ToolCall {
+	args := string(fc.Args)
+	if args == "" {
+		args = "{}"
+	}
+	return ToolCall{
+		ID:        fmt.Sprintf("call_%d", index),
+		Name:      fc.Name,
+		Arguments: args,
+	}
+}
+
+// geminiToolResult wraps a tool result in the JSON object Gemini expects
+// for a function response. Results that are already JSON objects are
+// passed through unchanged.
+func geminiToolResult(result string) json.RawMessage {
+	trimmed := strings.TrimSpace(result)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	wrapped, _ := json.Marshal(map[string]string{"result": result})
+	return wrapped
+}
+
+// geminiSchemaKeys are the JSON Schema keywords Gemini's responseSchema
+// accepts; it rejects others such as additionalProperties and $schema
+var geminiSchemaKeys = map[string]bool{
+	"type": true, "format": true, "title": true, "description": true, "nullable": true,
+	"enum": true, "items": true, "properties": true, "required": true, "anyOf": true,
+	"minItems": true, "maxItems": true, "minLength": true, "maxLength": true, "pattern": true,
+	"minProperties": true, "maxProperties": true, "minimum": true, "maximum": true,
+	"propertyOrdering": true, "default": true, "example": true,
+}
+
+// geminiSchema converts a JSON Schema to the subset Gemini accepts, inlining
+// local $ref references. The full schema is still enforced by local
+// validation.
+func geminiSchema(schema json.RawMessage) json.RawMessage {
+	var root map[string]interface{}
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return schema
+	}
+	data, err := json.Marshal(cleanGeminiSchema(root, root, 0))
+	if err != nil {
+		return schema
+	}
+	return data
+}
+
+func cleanGeminiSchema(node, root map[string]interface{}, depth int) map[string]interface{} {
+	if ref, ok := node["$ref"].(string); ok && depth < 32 {
+		if target := resolveSchemaRef(root, ref); target != nil {
+			return cleanGeminiSchema(target, root, depth+1)
+		}
+	}
+
+	out := make(map[string]interface{}, len(node))
+	for key, value := range node {
+		if !geminiSchemaKeys[key] {
+			continue
+		}
+		switch key {
+		case "properties":
+			props, _ := value.(map[string]interface{})
+			cleaned := make(map[string]interface{}, len(props))
+			for name, prop := range props {
+				if p, ok := prop.(map[string]interface{}); ok {
+					cleaned[name] = cleanGeminiSchema(p, root, depth+1)
+				}
+			}
+			out[key] = cleaned
+		case "items":
+			if items, ok := value.(map[string]interface{}); ok {
+				out[key] = cleanGeminiSchema(items, root, depth+1)
+			}
+		case "anyOf":
+			options, _ := value.([]interface{})
+			cleaned := make([]interface{}, 0, len(options))
+			for _, option := range options {
+				if o, ok := option.(map[string]interface{}); ok {
+					cleaned = append(cleaned, cleanGeminiSchema(o, root, depth+1))
+				}
+			}
+			out[key] = cleaned
+		default:
+			out[key] = value
+		}
+	}
+	return out
+}
+
+// resolveSchemaRef resolves a local reference such as "#/$defs/item"
+func resolveSchemaRef(root map[string]interface{}, ref string) map[string]interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	var node interface{} = root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = obj[part]
+	}
+	target, _ := node.(map[string]interface{})
+	return target
+}
+
+// UnsupportedParams reports reasoning settings for models that can't think
+func (g *Gemini) UnsupportedParams(req ChatRequest) []string {
+	if req.Reasoning != nil && !isThinkingModel(req.Model) {
+		return []string{"reasoning"}
+	}
+	return nil
+}
+
 // isThinkingModel returns true if the model supports thinking mode
 func isThinkingModel(model string) bool {
 	thinkingModels := []string{
@@ -478,7 +763,11 @@ func isGemini3Model(model string) bool {
 	return strings.Contains(model, "gemini-3")
 }
 
-// SetAPIKey updates the API key
-func (g *Gemini) SetAPIKey(key string) {
-	g.apiKey = key
+// geminiAPIError converts an error response into an Error
+func geminiAPIError(resp *http.Response, body []byte) error {
+	var errResp geminiResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != nil {
+		return newAPIError("gemini", resp, errResp.Error.Status, errResp.Error.Message)
+	}
+	return newAPIError("gemini", resp, "", "")
 }
@@ -0,0 +1,183 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+)
+
+// Middleware wraps a provider to observe or change its calls, e.g. for
+// logging, redaction, metrics or request rewriting. Providers returned by
+// middleware should implement Wrapper so optional interfaces such as Keyless
+// and ModelLister can still be found on the wrapped provider.
+type Middleware func(next Provider) Provider
+
+// Wrapper is implemented by providers that wrap another provider
+type Wrapper interface {
+	Unwrap() Provider
+}
+
+// Unwrap returns the innermost provider beneath any middleware
+func Unwrap(p Provider) Provider {
+	for {
+		w, ok := p.(Wrapper)
+		if !ok {
+			return p
+		}
+		p = w.Unwrap()
+	}
+}
+
+// Chain wraps p in the given middleware. The first middleware is the
+// outermost, so it sees requests first and responses last.
+func Chain(p Provider, middleware ...Middleware) Provider {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		p = middleware[i](p)
+	}
+	return p
+}
+
+// Interceptor holds hooks called around each Send and Stream. Any hook may
+// be nil.
+type Interceptor struct {
+	// Request is called before each call. It may rewrite the request, or
+	// abort the call by returning an error.
+	Request func(ctx context.Context, req *ChatRequest) error
+	// Delta is called for each streamed delta and returns the delta to pass on
+	Delta func(delta string) string
+	// Response is called after each call. It may rewrite the response and
+	// returns the error to pass on.
+	Response func(ctx context.Context, req ChatRequest, resp *ChatResponse, err error) error
+}
+
+// Intercept returns middleware that calls the interceptor's hooks
+func Intercept(hooks Interceptor) Middleware {
+	return func(next Provider) Provider {
+		return &intercepted{Provider: next, hooks: hooks}
+	}
+}
+
+// intercepted is a provider wrapped by Intercept
+type intercepted struct {
+	Provider
+	hooks Interceptor
+}
+
+// Unwrap returns the wrapped provider
+func (p *intercepted) Unwrap() Provider {
+	return p.Provider
+}
+
+// Send calls the hooks around the wrapped provider's Send
+func (p *intercepted) Send(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	if p.hooks.Request != nil {
+		if err := p.hooks.Request(ctx, &req); err != nil {
+			return ChatResponse{}, err
+		}
+	}
+	resp, err := p.Provider.Send(ctx, req)
+	return p.response(ctx, req, resp, err)
+}
+
+// Stream calls the hooks around the wrapped provider's Stream
+func (p *intercepted) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (ChatResponse, error) {
+	if p.hooks.Request != nil {
+		if err := p.hooks.Request(ctx, &req); err != nil {
+			return ChatResponse{}, err
+		}
+	}
+	if p.hooks.Delta != nil {
+		next := onDelta
+		onDelta = func(delta string) {
+			if delta = p.hooks.Delta(delta); delta != "" {
+				next(delta)
+			}
+		}
+	}
+	resp, err := p.Provider.Stream(ctx, req, onDelta)
+	return p.response(ctx, req, resp, err)
+}
+
+// response applies the Response hook
+func (p *intercepted) response(ctx context.Context, req ChatRequest, resp ChatResponse, err error) (ChatResponse, error) {
+	if p.hooks.Response != nil {
+		err = p.hooks.Response(ctx, req, &resp, err)
+	}
+	return resp, err
+}
+
+// Logging returns middleware that logs each request and its outcome. Only
+// metadata is logged, never message content or API keys.
+func Logging(logger *log.Logger) Middleware {
+	return func(next Provider) Provider {
+		name := next.Name()
+		return Intercept(Interceptor{
+			Request: func(ctx context.Context, req *ChatRequest) error {
+				logger.Printf("%s: request model=%s messages=%d tools=%d",
+					name, req.Model, len(req.Messages), len(req.Tools))
+				return nil
+			},
+			Response: func(ctx context.Context, req ChatRequest, resp *ChatResponse, err error) error {
+				if err != nil {
+					logger.Printf("%s: error model=%s: %s", name, req.Model, logSafeError(err))
+					return err
+				}
+				logger.Printf("%s: response model=%s finish=%s prompt_tokens=%d completion_tokens=%d tool_calls=%d",
+					name, resp.Model, resp.FinishReason, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, len(resp.ToolCalls))
+				return nil
+			},
+		})(next)
+	}
+}
+
+// Redact returns middleware that replaces each secret in outgoing message
+// text with "[REDACTED]", so keys pasted into a prompt never reach the
+// provider. Empty secrets are ignored.
+func Redact(secrets ...string) Middleware {
+	var pairs []string
+	for _, secret := range secrets {
+		if secret != "" {
+			pairs = append(pairs, secret, "[REDACTED]")
+		}
+	}
+	replacer := strings.NewReplacer(pairs...)
+	return Intercept(Interceptor{
+		Request: func(ctx context.Context, req *ChatRequest) error {
+			if len(pairs) == 0 {
+				return nil
+			}
+			// Copy the messages so the caller's history is left untouched
+			messages := make([]Message, len(req.Messages))
+			for i, msg := range req.Messages {
+				msg.Content = replacer.Replace(msg.Content)
+				if len(msg.Parts) > 0 {
+					parts := make([]ContentPart, len(msg.Parts))
+					for j, part := range msg.Parts {
+						part.Text = replacer.Replace(part.Text)
+						parts[j] = part
+					}
+					msg.Parts = parts
+				}
+				messages[i] = msg
+			}
+			req.Messages = messages
+			return nil
+		},
+	})
+}
+
+// logSafeError describes an error for logs. Transport errors can quote the
+// request URL, which carries the API key for Gemini, so only API errors are
+// logged in full.
+func logSafeError(err error) string {
+	var apiErr *Error
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.Error()
+	case errors.Is(err, ErrContextCanceled):
+		return "canceled"
+	default:
+		return "request failed"
+	}
+}
@@ -0,0 +1,223 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MockEchoModel always echoes the last user message
+	MockEchoModel = "echo"
+	// MockScriptedModel answers from the script, echoing when no rule matches
+	MockScriptedModel = "scripted"
+)
+
+// MockScript configures the mock provider's answers
+type MockScript struct {
+	// TokenDelayMs is the pause between streamed tokens
+	TokenDelayMs int `json:"token_delay_ms,omitempty"`
+	// Rules are tried in order against the last user message
+	Rules []MockRule `json:"rules"`
+}
+
+// MockRule maps a pattern to a response or an injected failure
+type MockRule struct {
+	// Match is a regular expression matched against the last user message
+	Match string `json:"match"`
+	// Response is the answer to stream
+	Response string `json:"response,omitempty"`
+	// Echo answers with the user's message instead of Response
+	Echo bool `json:"echo,omitempty"`
+	// Status fails the request with this HTTP status, e.g. 429
+	Status int `json:"status,omitempty"`
+	// RetryAfter is the Retry-After, in seconds, reported with Status
+	RetryAfter int `json:"retry_after,omitempty"`
+	// DisconnectAfter drops the stream after this many tokens of Response
+	DisconnectAfter int `json:"disconnect_after,omitempty"`
+	// Times limits the rule to its first n matches; 0 means always
+	Times int `json:"times,omitempty"`
+	// TokenDelayMs overrides the script's delay for this rule
+	TokenDelayMs int `json:"token_delay_ms,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// LoadMockScript reads a mock script from a JSON file
+func LoadMockScript(path string) (MockScript, error) {
+	var script MockScript
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return script, fmt.Errorf("failed to read mock script: %w", err)
+	}
+	if err := json.Unmarshal(data, &script); err != nil {
+		return script, fmt.Errorf("failed to parse mock script: %w", err)
+	}
+	return script, nil
+}
+
+// Mock is a provider that answers locally from a script, for demos,
+// screenshots and UI work. It needs no network and no API key.
+type Mock struct {
+	script MockScript
+
+	mu   sync.Mutex
+	hits []int // Matches per rule, for Times
+}
+
+// NewMock creates a mock provider. An empty script echoes every message.
+func NewMock(script MockScript) (*Mock, error) {
+	for i := range script.Rules {
+		pattern, err := regexp.Compile(script.Rules[i].Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mock rule %d pattern: %w", i+1, err)
+		}
+		script.Rules[i].pattern = pattern
+	}
+	return &Mock{
+		script: script,
+		hits:   make([]int, len(script.Rules)),
+	}, nil
+}
+
+// Name returns the provider identifier
+func (m *Mock) Name() string {
+	return "mock"
+}
+
+// Models returns the mock models
+func (m *Mock) Models(ctx context.Context) ([]string, error) {
+	return []string{MockScriptedModel, MockEchoModel}, nil
+}
+
+// SupportsStreaming returns true; the mock streams token by token
+func (m *Mock) SupportsStreaming() bool {
+	return true
+}
+
+// Keyless returns true as the mock needs no API key
+func (m *Mock) Keyless() bool {
+	return true
+}
+
+// Send returns the whole scripted answer at once
+func (m *Mock) Send(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	return m.Stream(ctx, req, func(string) {})
+}
+
+// Stream streams the scripted answer with the configured token delay
+func (m *Mock) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (ChatResponse, error) {
+	prompt := lastUserText(req.Messages)
+	rule := m.match(req.Model, prompt)
+
+	if rule.Status != 0 {
+		return ChatResponse{}, &Error{
+			Provider:   "mock",
+			StatusCode: rule.Status,
+			Message:    "injected " + http.StatusText(rule.Status),
+			Retryable:  isRetryableStatus(rule.Status),
+			RetryAfter: time.Duration(rule.RetryAfter) * time.Second,
+		}
+	}
+
+	answer := rule.Response
+	if rule.Echo {
+		answer = prompt
+	}
+	delay := time.Duration(m.script.TokenDelayMs) * time.Millisecond
+	if rule.TokenDelayMs > 0 {
+		delay = time.Duration(rule.TokenDelayMs) * time.Millisecond
+	}
+
+	var content strings.Builder
+	tokens := mockTokens(answer)
+	for i, token := range tokens {
+		if rule.DisconnectAfter > 0 && i >= rule.DisconnectAfter {
+			return ChatResponse{}, fmt.Errorf("stream error: %w", io.ErrUnexpectedEOF)
+		}
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ChatResponse{}, ErrContextCanceled
+			case <-timer.C:
+			}
+		} else if ctx.Err() != nil {
+			return ChatResponse{}, ErrContextCanceled
+		}
+		content.WriteString(token)
+		onDelta(token)
+	}
+
+	// Fake usage at roughly four characters per token
+	promptTokens := 0
+	for _, msg := range req.Messages {
+		promptTokens += (len(msg.Text()) + 3) / 4
+	}
+	return ChatResponse{
+		Content:      content.String(),
+		Model:        req.Model,
+		FinishReason: "stop",
+		Usage: Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: len(tokens),
+			TotalTokens:      promptTokens + len(tokens),
+		},
+	}, nil
+}
+
+// match returns the first rule matching the prompt, or an echo rule
+func (m *Mock) match(model, prompt string) MockRule {
+	if model == MockEchoModel {
+		return MockRule{Echo: true}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, rule := range m.script.Rules {
+		if !rule.pattern.MatchString(prompt) {
+			continue
+		}
+		if rule.Times > 0 && m.hits[i] >= rule.Times {
+			continue
+		}
+		m.hits[i]++
+		return rule
+	}
+	return MockRule{Echo: true}
+}
+
+// lastUserText returns the text of the most recent user message
+func lastUserText(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == RoleUser {
+			return messages[i].Text()
+		}
+	}
+	return ""
+}
+
+// mockTokens splits text into word-sized tokens, keeping the whitespace so
+// the tokens join back into the original text
+func mockTokens(text string) []string {
+	var tokens []string
+	start := 0
+	for i, r := range text {
+		if (r == ' ' || r == '\n') && i+1 > start {
+			tokens = append(tokens, text[start:i+1])
+			start = i + 1
+		}
+	}
+	if start < len(text) {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens
+}
@@ -0,0 +1,176 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultModelCacheTTL is how long a cached model list is considered fresh
+const DefaultModelCacheTTL = 24 * time.Hour
+
+// ModelLister is implemented by providers that can list models from their API
+type ModelLister interface {
+	// ListModels fetches the provider's current models. Unlike Models, it
+	// returns an error instead of falling back to the static list.
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+}
+
+// staticModelIDs returns the IDs of the DefaultModels entries for a provider
+func staticModelIDs(provider string) []string {
+	models := make([]string, 0, len(DefaultModels[provider]))
+	for _, m := range DefaultModels[provider] {
+		models = append(models, m.ID)
+	}
+	return models
+}
+
+// modelIDs returns the IDs of the given models
+func modelIDs(models []ModelInfo) []string {
+	ids := make([]string, 0, len(models))
+	for _, m := range models {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+// modelsOrStatic returns the live model IDs, or the static list when listing
+// failed. The error is only returned if there is no static list to fall back to.
+func modelsOrStatic(provider string, live []ModelInfo, err error) ([]string, error) {
+	if err == nil {
+		return modelIDs(live), nil
+	}
+	if static := staticModelIDs(provider); len(static) > 0 {
+		return static, nil
+	}
+	return nil, err
+}
+
+// mergeModels combines a live model list with the DefaultModels metadata.
+// Known models keep their curated order and descriptions and come first;
+// other live models follow, sorted by ID. Models the API no longer lists are
+// dropped.
+func mergeModels(provider string, live []ModelInfo) []ModelInfo {
+	liveByID := make(map[string]ModelInfo, len(live))
+	for _, m := range live {
+		liveByID[m.ID] = m
+	}
+
+	merged := make([]ModelInfo, 0, len(live))
+	for _, known := range DefaultModels[provider] {
+		if _, ok := liveByID[known.ID]; ok {
+			merged = append(merged, known)
+			delete(liveByID, known.ID)
+		}
+	}
+
+	rest := make([]ModelInfo, 0, len(liveByID))
+	for _, m := range liveByID {
+		if m.Provider == "" {
+			m.Provider = provider
+		}
+		if m.Name == "" {
+			m.Name = m.ID
+		}
+		rest = append(rest, m)
+	}
+	sort.Slice(rest, func(i, j int) bool {
+		return rest[i].ID < rest[j].ID
+	})
+
+	return append(merged, rest...)
+}
+
+// ModelCache stores model lists on disk so /model does not hit the network
+// every time it is opened
+type ModelCache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// modelCacheFile is the on-disk format of a cached model list
+type modelCacheFile struct {
+	FetchedAt time.Time   `json:"fetched_at"`
+	Models    []ModelInfo `json:"models"`
+}
+
+// NewModelCache creates a model cache in dir. A ttl of zero uses
+// DefaultModelCacheTTL.
+func NewModelCache(dir string, ttl time.Duration) *ModelCache {
+	if ttl <= 0 {
+		ttl = DefaultModelCacheTTL
+	}
+	return &ModelCache{
+		dir: dir,
+		ttl: ttl,
+		now: time.Now,
+	}
+}
+
+// Models returns the provider's models, using the cached list while it is
+// fresh. When listing fails (e.g. offline) it falls back to a stale cached
+// list, then to the static DefaultModels list.
+func (c *ModelCache) Models(ctx context.Context, p Provider) ([]string, error) {
+	lister, ok := Unwrap(p).(ModelLister)
+	if !ok {
+		return p.Models(ctx)
+	}
+
+	cached, err := c.read(p.Name())
+	if err == nil && c.now().Sub(cached.FetchedAt) < c.ttl {
+		return modelIDs(cached.Models), nil
+	}
+
+	live, listErr := lister.ListModels(ctx)
+	if listErr == nil && len(live) > 0 {
+		// A failed write only costs a refetch next time
+		_ = c.write(p.Name(), live)
+		return modelIDs(live), nil
+	}
+
+	if err == nil && len(cached.Models) > 0 {
+		return modelIDs(cached.Models), nil
+	}
+	if listErr == nil {
+		listErr = ErrInvalidResponse
+	}
+	return modelsOrStatic(p.Name(), nil, listErr)
+}
+
+// path returns the cache file for a provider
+func (c *ModelCache) path(provider string) string {
+	return filepath.Join(c.dir, "models-"+provider+".json")
+}
+
+// read loads a cached model list
+func (c *ModelCache) read(provider string) (modelCacheFile, error) {
+	var cached modelCacheFile
+	data, err := os.ReadFile(c.path(provider))
+	if err != nil {
+		return cached, err
+	}
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return cached, fmt.Errorf("failed to parse model cache: %w", err)
+	}
+	return cached, nil
+}
+
+// write stores a model list with the current time
+func (c *ModelCache) write(provider string, models []ModelInfo) error {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	data, err := json.MarshalIndent(modelCacheFile{FetchedAt: c.now(), Models: models}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal model cache: %w", err)
+	}
+	if err := os.WriteFile(c.path(provider), data, 0600); err != nil {
+		return fmt.Errorf("failed to write model cache: %w", err)
+	}
+	return nil
+}
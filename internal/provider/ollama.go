@@ -0,0 +1,351 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// OllamaDefaultBaseURL is the address of a default local Ollama install
+	OllamaDefaultBaseURL = "http://localhost:11434"
+	ollamaChatEndpoint   = "/api/chat"
+	ollamaTagsEndpoint   = "/api/tags"
+)
+
+// Ollama implements the Provider interface for a local Ollama server.
+// It needs no API key.
+type Ollama struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewOllama creates a new Ollama provider. An empty baseURL uses the
+// default local address.
+func NewOllama(baseURL string) *Ollama {
+	return NewOllamaWithClient(baseURL, &http.Client{})
+}
+
+// NewOllamaWithClient creates a new Ollama provider with a custom HTTP client
+func NewOllamaWithClient(baseURL string, client *http.Client) *Ollama {
+	if baseURL == "" {
+		baseURL = OllamaDefaultBaseURL
+	}
+	return &Ollama{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  client,
+	}
+}
+
+// Name returns the provider identifier
+func (o *Ollama) Name() string {
+	return "ollama"
+}
+
+// SupportsStreaming returns true as Ollama streams NDJSON
+func (o *Ollama) SupportsStreaming() bool {
+	return true
+}
+
+// Keyless returns true as a local Ollama server needs no API key
+func (o *Ollama) Keyless() bool {
+	return true
+}
+
+// ollamaRequest is the request format for Ollama's chat API
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  *ollamaOptions  `json:"options,omitempty"`
+	Tools    []openAITool    `json:"tools,omitempty"`  // Same shape as OpenAI tools
+	Format   json.RawMessage `json:"format,omitempty"` // JSON Schema for structured output
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"` // Base64-encoded images
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"` // A JSON object, not a string
+	} `json:"function"`
+}
+
+type ollamaOptions struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	NumPredict       int      `json:"num_predict,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int64   `json:"seed,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+}
+
+// ollamaResponse is a chat response, or one line of a streamed response
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+	EvalCount       int           `json:"eval_count,omitempty"`
+	Error           string        `json:"error,omitempty"`
+}
+
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// Models returns the models installed on the Ollama server
+func (o *Ollama) Models(ctx context.Context) ([]string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", o.baseURL+ollamaTagsEndpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError("ollama", resp, "", "")
+	}
+
+	var tags ollamaTagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	models := make([]string, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		models = append(models, m.Name)
+	}
+	return models, nil
+}
+
+// UnsupportedParams reports reasoning settings, which aren't sent to Ollama
+func (o *Ollama) UnsupportedParams(req ChatRequest) []string {
+	if req.Reasoning != nil {
+		return []string{"reasoning"}
+	}
+	return nil
+}
+
+// Send sends a chat request and returns the complete response
+func (o *Ollama) Send(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	resp, err := o.post(ctx, o.buildRequest(req, false))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var ollamaResp ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
+		return ChatResponse{}, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if ollamaResp.Error != "" {
+		return ChatResponse{}, newStreamError("ollama", "", ollamaResp.Error)
+	}
+
+	return ChatResponse{
+		Content:      ollamaResp.Message.Content,
+		Model:        ollamaResp.Model,
+		FinishReason: ollamaResp.DoneReason,
+		Usage:        ollamaUsage(ollamaResp),
+		ToolCalls:    ollamaToolCalls(ollamaResp.Message.ToolCalls, 0),
+	}, nil
+}
+
+// Stream sends a chat request and streams the response line by line
+func (o *Ollama) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (ChatResponse, error) {
+	resp, err := o.post(ctx, o.buildRequest(req, true))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var result ChatResponse
+	var content strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		select {
+		case <-ctx.Done():
+			return ChatResponse{}, ErrContextCanceled
+		default:
+		}
+
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk ollamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			continue // Skip malformed lines
+		}
+		if chunk.Error != "" {
+			return ChatResponse{}, newStreamError("ollama", "", chunk.Error)
+		}
+
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+		result.ToolCalls = append(result.ToolCalls, ollamaToolCalls(chunk.Message.ToolCalls, len(result.ToolCalls))...)
+
+		if chunk.Done {
+			result.Model = chunk.Model
+			result.FinishReason = chunk.DoneReason
+			result.Usage = ollamaUsage(chunk)
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return ChatResponse{}, ErrContextCanceled
+		}
+		return ChatResponse{}, fmt.Errorf("stream error: %w", err)
+	}
+
+	result.Content = content.String()
+	return result, nil
+}
+
+// post sends a chat request and returns the successful HTTP response
+func (o *Ollama) post(ctx context.Context, ollamaReq ollamaRequest) (*http.Response, error) {
+	body, err := json.Marshal(ollamaReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+ollamaChatEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ErrContextCanceled
+		}
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		var errResp ollamaResponse
+		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error != "" {
+			return nil, newAPIError("ollama", resp, "", errResp.Error)
+		}
+		return nil, newAPIError("ollama", resp, "", "")
+	}
+
+	return resp, nil
+}
+
+// buildRequest constructs an Ollama API request from a ChatRequest
+func (o *Ollama) buildRequest(req ChatRequest, stream bool) ollamaRequest {
+	messages := make([]ollamaMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		msg := ollamaMessage{
+			Role:    string(m.Role),
+			Content: m.Text(),
+		}
+		if m.Role == RoleTool {
+			msg.ToolName = m.Name
+		}
+		for _, part := range m.Parts {
+			if part.Type == PartImage {
+				msg.Images = append(msg.Images, base64.StdEncoding.EncodeToString(part.Data))
+			}
+		}
+		for _, tc := range m.ToolCalls {
+			var call ollamaToolCall
+			call.Function.Name = tc.Name
+			call.Function.Arguments = toolArguments(tc)
+			msg.ToolCalls = append(msg.ToolCalls, call)
+		}
+		messages = append(messages, msg)
+	}
+
+	ollamaReq := ollamaRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Stream:   stream,
+	}
+	if req.ResponseSchema != nil {
+		ollamaReq.Format = req.ResponseSchema.Schema
+	}
+
+	options := &ollamaOptions{
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		NumPredict:       req.MaxTokens,
+		Stop:             req.Stop,
+		Seed:             req.Seed,
+		FrequencyPenalty: req.FrequencyPenalty,
+	}
+	if options.Temperature != nil || options.TopP != nil || options.NumPredict > 0 ||
+		len(options.Stop) > 0 || options.Seed != nil || options.FrequencyPenalty != nil {
+		ollamaReq.Options = options
+	}
+
+	for _, t := range req.Tools {
+		ollamaReq.Tools = append(ollamaReq.Tools, openAITool{
+			Type: "function",
+			Function: openAIFunctionDecl{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
+	}
+
+	return ollamaReq
+}
+
+// ollamaUsage extracts token counts from a final response
+func ollamaUsage(resp ollamaResponse) Usage {
+	return Usage{
+		PromptTokens:     resp.PromptEvalCount,
+		CompletionTokens: resp.EvalCount,
+		TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+	}
+}
+
+// ollamaToolCalls converts Ollama tool calls, which carry no IDs, assigning
+// sequential IDs starting at offset
+func ollamaToolCalls(calls []ollamaToolCall, offset int) []ToolCall {
+	var result []ToolCall
+	for i, tc := range calls {
+		args := string(tc.Function.Arguments)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		result = append(result, ToolCall{
+			ID:        fmt.Sprintf("call_%d", offset+i),
+			Name:      tc.Function.Name,
+			Arguments: args,
+		})
+	}
+	return result
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,11 +18,32 @@ const (
 	openAIModelsEndpoint = "/models"
 )
 
-// OpenAI implements the Provider interface for OpenAI's API
+// OpenAI implements the Provider interface for OpenAI's API. The same
+// implementation serves any OpenAI-compatible endpoint (see NewOpenAICompatible).
 type OpenAI struct {
 	apiKey  string
 	baseURL string
 	client  *http.Client
+
+	// Settings for OpenAI-compatible endpoints
+	name    string            // Provider name; "openai" when empty
+	headers map[string]string // Extra headers sent with every request
+	models  []string          // Model list; DefaultModels when empty
+	keyless bool              // True if the endpoint needs no API key
+}
+
+// OpenAICompatibleConfig describes a named OpenAI-compatible endpoint such as
+// Groq, OpenRouter, vLLM or LM Studio
+type OpenAICompatibleConfig struct {
+	Name    string
+	BaseURL string
+	APIKey  string
+	Headers map[string]string
+	Models  []string
+	// Keyless marks local servers that accept requests without an API key
+	Keyless bool
+	// Client is the HTTP client to use; a default client when nil
+	Client *http.Client
 }
 
 // NewOpenAI creates a new OpenAI provider
@@ -42,11 +64,36 @@ func NewOpenAIWithClient(apiKey string, client *http.Client) *OpenAI {
 	}
 }
 
+// NewOpenAICompatible creates a provider for an OpenAI-compatible endpoint
+func NewOpenAICompatible(cfg OpenAICompatibleConfig) *OpenAI {
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &OpenAI{
+		apiKey:  cfg.APIKey,
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		client:  client,
+		name:    cfg.Name,
+		headers: cfg.Headers,
+		models:  cfg.Models,
+		keyless: cfg.Keyless,
+	}
+}
+
 // Name returns the provider identifier
 func (o *OpenAI) Name() string {
+	if o.name != "" {
+		return o.name
+	}
 	return "openai"
 }
 
+// Keyless returns true for endpoints configured without an API key
+func (o *OpenAI) Keyless() bool {
+	return o.keyless
+}
+
 // SupportsStreaming returns true as OpenAI supports streaming
 func (o *OpenAI) SupportsStreaming() bool {
 	return true
@@ -54,16 +101,88 @@ func (o *OpenAI) SupportsStreaming() bool {
 
 // openAIRequest is the request format for OpenAI's chat API
 type openAIRequest struct {
-	Model       string          `json:"model"`
-	Messages    []openAIMessage `json:"messages"`
-	MaxTokens   int             `json:"max_tokens,omitempty"`
-	Temperature float64         `json:"temperature,omitempty"`
-	Stream      bool            `json:"stream,omitempty"`
+	Model               string                 `json:"model"`
+	Messages            []openAIRequestMessage `json:"messages"`
+	MaxTokens           int                    `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                    `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64               `json:"temperature,omitempty"`
+	TopP                *float64               `json:"top_p,omitempty"`
+	Stop                []string               `json:"stop,omitempty"`
+	Seed                *int64                 `json:"seed,omitempty"`
+	FreqPenalty         *float64               `json:"frequency_penalty,omitempty"`
+	ReasoningEffort     string                 `json:"reasoning_effort,omitempty"`
+	Stream              bool                   `json:"stream,omitempty"`
+	StreamOptions       *openAIStreamOptions   `json:"stream_options,omitempty"`
+	Tools               []openAITool           `json:"tools,omitempty"`
+	ResponseFormat      *openAIResponseFormat  `json:"response_format,omitempty"`
+}
+
+// openAIResponseFormat requests structured output
+type openAIResponseFormat struct {
+	Type       string                `json:"type"`
+	JSONSchema *openAIJSONSchemaSpec `json:"json_schema,omitempty"`
+}
+
+type openAIJSONSchemaSpec struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+// openAIStreamOptions asks for a final chunk carrying the token usage
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type openAIMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+	// ReasoningContent is returned by compatible endpoints such as DeepSeek
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+}
+
+// openAIRequestMessage is a message as sent to the API, where content may
+// be a list of parts
+type openAIRequestMessage struct {
+	Role string `json:"role"`
+	// Content is a string, or []openAIContentPart for multimodal messages
+	Content    interface{}      `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAITool struct {
+	Type     string             `json:"type"`
+	Function openAIFunctionDecl `json:"function"`
+}
+
+type openAIFunctionDecl struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type openAIToolCall struct {
+	Index    *int               `json:"index,omitempty"` // Only set in stream deltas
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type,omitempty"`
+	Function openAIFunctionCall `json:"function"`
+}
+
+type openAIFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
 }
 
 // openAIResponse is the response format from OpenAI's chat API
@@ -77,14 +196,39 @@ type openAIResponse struct {
 		Message      openAIMessage `json:"message"`
 		FinishReason string        `json:"finish_reason"`
 	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage openAIUsage  `json:"usage"`
 	Error *openAIError `json:"error,omitempty"`
 }
 
+type openAIUsage struct {
+	PromptTokens            int `json:"prompt_tokens"`
+	CompletionTokens        int `json:"completion_tokens"`
+	TotalTokens             int `json:"total_tokens"`
+	CompletionTokensDetails *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details,omitempty"`
+	PromptTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details,omitempty"`
+}
+
+// usage converts the reported token counts
+func (u openAIUsage) usage() Usage {
+	usage := Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if u.CompletionTokensDetails != nil {
+		usage.ThinkingTokens = u.CompletionTokensDetails.ReasoningTokens
+	}
+	// OpenAI caches long prompts automatically
+	if u.PromptTokensDetails != nil {
+		usage.CacheReadTokens = u.PromptTokensDetails.CachedTokens
+	}
+	return usage
+}
+
 type openAIError struct {
 	Message string `json:"message"`
 	Type    string `json:"type"`
@@ -100,45 +244,137 @@ type openAIStreamResponse struct {
 	Choices []struct {
 		Index int `json:"index"`
 		Delta struct {
-			Role    string `json:"role,omitempty"`
-			Content string `json:"content,omitempty"`
+			Role             string           `json:"role,omitempty"`
+			Content          string           `json:"content,omitempty"`
+			ReasoningContent string           `json:"reasoning_content,omitempty"`
+			ToolCalls        []openAIToolCall `json:"tool_calls,omitempty"`
 		} `json:"delta"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
+	// Usage is only set on the final chunk, which has no choices
+	Usage *openAIUsage `json:"usage,omitempty"`
 }
 
-// Models returns available OpenAI models
+// Models returns available OpenAI models, falling back to the static list
+// when they can't be fetched
 func (o *OpenAI) Models(ctx context.Context) ([]string, error) {
-	// Return static list for now to avoid unnecessary API calls
-	models := make([]string, 0, len(DefaultModels["openai"]))
-	for _, m := range DefaultModels["openai"] {
-		models = append(models, m.ID)
+	models, err := o.ListModels(ctx)
+	return modelsOrStatic(o.Name(), models, err)
+}
+
+// openAIModelsResponse is the response format of the models endpoint
+type openAIModelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// ListModels fetches the models offered by the endpoint. Endpoints declared
+// with a model list return that list without a request.
+func (o *OpenAI) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	if len(o.models) > 0 {
+		models := make([]ModelInfo, 0, len(o.models))
+		for _, id := range o.models {
+			models = append(models, ModelInfo{ID: id, Name: id, Provider: o.Name()})
+		}
+		return mergeModels(o.Name(), models), nil
 	}
-	return models, nil
+
+	if o.apiKey == "" && !o.keyless {
+		return nil, ErrNoAPIKey
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", o.baseURL+openAIModelsEndpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	o.setHeaders(httpReq)
+
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, o.apiError(resp, respBody)
+	}
+
+	var modelsResp openAIModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	var models []ModelInfo
+	for _, m := range modelsResp.Data {
+		// OpenAI's own list includes embedding, audio and image models
+		if o.Name() == "openai" && !isOpenAIChatModel(m.ID) {
+			continue
+		}
+		models = append(models, ModelInfo{ID: m.ID, Name: m.ID, Provider: o.Name()})
+	}
+	return mergeModels(o.Name(), models), nil
 }
 
-// Send sends a chat request and returns the complete response
-func (o *OpenAI) Send(ctx context.Context, req ChatRequest) (ChatResponse, error) {
-	if o.apiKey == "" {
-		return ChatResponse{}, ErrNoAPIKey
+// isOpenAIChatModel reports whether an OpenAI model ID is usable with the
+// chat completions endpoint
+func isOpenAIChatModel(id string) bool {
+	if !strings.HasPrefix(id, "gpt-") && !strings.HasPrefix(id, "chatgpt-") &&
+		!strings.HasPrefix(id, "o1") && !strings.HasPrefix(id, "o3") && !strings.HasPrefix(id, "o4") {
+		return false
 	}
+	for _, skip := range []string{"audio", "realtime", "transcribe", "tts", "image", "search", "instruct"} {
+		if strings.Contains(id, skip) {
+			return false
+		}
+	}
+	return true
+}
 
-	// Convert to OpenAI format
-	messages := make([]openAIMessage, len(req.Messages))
-	for i, m := range req.Messages {
-		messages[i] = openAIMessage{
-			Role:    string(m.Role),
-			Content: m.Content,
+// isOpenAIReasoningModel reports whether a model is an OpenAI reasoning
+// model (o-series or GPT-5), which only accepts default sampling
+func isOpenAIReasoningModel(model string) bool {
+	for _, prefix := range []string{"o1", "o3", "o4"} {
+		if strings.HasPrefix(model, prefix) {
+			return true
 		}
 	}
+	return strings.HasPrefix(model, "gpt-5") && !strings.Contains(model, "chat")
+}
 
-	openAIReq := openAIRequest{
-		Model:       req.Model,
-		Messages:    messages,
-		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
-		Stream:      false,
+// UnsupportedParams returns the sampling parameters dropped for reasoning
+// models, and reasoning for other models
+func (o *OpenAI) UnsupportedParams(req ChatRequest) []string {
+	if !isOpenAIReasoningModel(req.Model) {
+		if req.Reasoning != nil {
+			return []string{"reasoning"}
+		}
+		return nil
+	}
+	var unsupported []string
+	if req.Temperature != nil {
+		unsupported = append(unsupported, "temperature")
+	}
+	if req.TopP != nil {
+		unsupported = append(unsupported, "top_p")
+	}
+	if len(req.Stop) > 0 {
+		unsupported = append(unsupported, "stop")
+	}
+	if req.FrequencyPenalty != nil {
+		unsupported = append(unsupported, "frequency_penalty")
 	}
+	return unsupported
+}
+
+// Send sends a chat request and returns the complete response
+func (o *OpenAI) Send(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	if o.apiKey == "" && !o.keyless {
+		return ChatResponse{}, ErrNoAPIKey
+	}
+
+	openAIReq := o.buildRequest(req, false)
 
 	body, err := json.Marshal(openAIReq)
 	if err != nil {
@@ -150,8 +386,7 @@ func (o *OpenAI) Send(ctx context.Context, req ChatRequest) (ChatResponse, error
 		return ChatResponse{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	o.setHeaders(httpReq)
 
 	resp, err := o.client.Do(httpReq)
 	if err != nil {
@@ -167,16 +402,8 @@ func (o *OpenAI) Send(ctx context.Context, req ChatRequest) (ChatResponse, error
 		return ChatResponse{}, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		return ChatResponse{}, ErrRateLimited
-	}
-
 	if resp.StatusCode != http.StatusOK {
-		var errResp openAIResponse
-		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error != nil {
-			return ChatResponse{}, fmt.Errorf("API error: %s", errResp.Error.Message)
-		}
-		return ChatResponse{}, fmt.Errorf("API error: status %d", resp.StatusCode)
+		return ChatResponse{}, o.apiError(resp, respBody)
 	}
 
 	var openAIResp openAIResponse
@@ -188,83 +415,71 @@ func (o *OpenAI) Send(ctx context.Context, req ChatRequest) (ChatResponse, error
 		return ChatResponse{}, ErrInvalidResponse
 	}
 
+	var toolCalls []ToolCall
+	for _, tc := range openAIResp.Choices[0].Message.ToolCalls {
+		toolCalls = append(toolCalls, ToolCall{
+			ID:        tc.ID,
+			Name:      tc.Function.Name,
+			Arguments: tc.Function.Arguments,
+		})
+	}
+
 	return ChatResponse{
 		Content:      openAIResp.Choices[0].Message.Content,
 		Model:        openAIResp.Model,
 		FinishReason: openAIResp.Choices[0].FinishReason,
-		Usage: Usage{
-			PromptTokens:     openAIResp.Usage.PromptTokens,
-			CompletionTokens: openAIResp.Usage.CompletionTokens,
-			TotalTokens:      openAIResp.Usage.TotalTokens,
-		},
+		Usage:        openAIResp.Usage.usage(),
+		ToolCalls:    toolCalls,
+		Reasoning:    openAIResp.Choices[0].Message.ReasoningContent,
 	}, nil
 }
 
 // Stream sends a chat request and streams the response
-func (o *OpenAI) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string)) error {
-	if o.apiKey == "" {
-		return ErrNoAPIKey
-	}
-
-	// Convert to OpenAI format
-	messages := make([]openAIMessage, len(req.Messages))
-	for i, m := range req.Messages {
-		messages[i] = openAIMessage{
-			Role:    string(m.Role),
-			Content: m.Content,
-		}
+func (o *OpenAI) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (ChatResponse, error) {
+	if o.apiKey == "" && !o.keyless {
+		return ChatResponse{}, ErrNoAPIKey
 	}
 
-	openAIReq := openAIRequest{
-		Model:       req.Model,
-		Messages:    messages,
-		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
-		Stream:      true,
-	}
+	openAIReq := o.buildRequest(req, true)
 
 	body, err := json.Marshal(openAIReq)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return ChatResponse{}, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+openAIChatEndpoint, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return ChatResponse{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	o.setHeaders(httpReq)
 	httpReq.Header.Set("Accept", "text/event-stream")
 
 	resp, err := o.client.Do(httpReq)
 	if err != nil {
 		if ctx.Err() != nil {
-			return ErrContextCanceled
+			return ChatResponse{}, ErrContextCanceled
 		}
-		return fmt.Errorf("request failed: %w", err)
+		return ChatResponse{}, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		return ErrRateLimited
-	}
-
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		var errResp openAIResponse
-		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error != nil {
-			return fmt.Errorf("API error: %s", errResp.Error.Message)
-		}
-		return fmt.Errorf("API error: status %d", resp.StatusCode)
+		return ChatResponse{}, o.apiError(resp, respBody)
 	}
 
 	// Parse SSE stream
+	var content, reasoning strings.Builder
+	var toolCalls []ToolCall
+	onReasoning := reasoningDelta(ctx)
+	result := ChatResponse{Model: req.Model}
+
 	scanner := bufio.NewScanner(resp.Body)
 	for scanner.Scan() {
 		select {
 		case <-ctx.Done():
-			return ErrContextCanceled
+			return ChatResponse{}, ErrContextCanceled
 		default:
 		}
 
@@ -292,19 +507,171 @@ func (o *OpenAI) Stream(ctx context.Context, req ChatRequest, onDelta func(delta
 			continue // Skip malformed chunks
 		}
 
-		if len(streamResp.Choices) > 0 && streamResp.Choices[0].Delta.Content != "" {
-			onDelta(streamResp.Choices[0].Delta.Content)
+		if streamResp.Model != "" {
+			result.Model = streamResp.Model
+		}
+		if streamResp.Usage != nil {
+			result.Usage = streamResp.Usage.usage()
+		}
+		if len(streamResp.Choices) == 0 {
+			continue
+		}
+
+		choice := streamResp.Choices[0]
+		if choice.Delta.ReasoningContent != "" {
+			reasoning.WriteString(choice.Delta.ReasoningContent)
+			onReasoning(choice.Delta.ReasoningContent)
+		}
+		if choice.Delta.Content != "" {
+			content.WriteString(choice.Delta.Content)
+			onDelta(choice.Delta.Content)
+		}
+		if choice.FinishReason != "" {
+			result.FinishReason = choice.FinishReason
+		}
+
+		// Tool call arguments arrive in fragments keyed by index
+		for _, tc := range choice.Delta.ToolCalls {
+			idx := len(toolCalls)
+			if tc.Index != nil {
+				idx = *tc.Index
+			}
+			for len(toolCalls) <= idx {
+				toolCalls = append(toolCalls, ToolCall{})
+			}
+			if tc.ID != "" {
+				toolCalls[idx].ID = tc.ID
+			}
+			if tc.Function.Name != "" {
+				toolCalls[idx].Name = tc.Function.Name
+			}
+			toolCalls[idx].Arguments += tc.Function.Arguments
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("stream error: %w", err)
+		return ChatResponse{}, fmt.Errorf("stream error: %w", err)
 	}
 
-	return nil
+	result.Content = content.String()
+	result.Reasoning = reasoning.String()
+	result.ToolCalls = toolCalls
+	return result, nil
 }
 
-// SetAPIKey updates the API key
-func (o *OpenAI) SetAPIKey(key string) {
-	o.apiKey = key
+// buildRequest constructs an OpenAI API request from a ChatRequest
+func (o *OpenAI) buildRequest(req ChatRequest, stream bool) openAIRequest {
+	messages := make([]openAIRequestMessage, len(req.Messages))
+	for i, m := range req.Messages {
+		msg := openAIRequestMessage{
+			Role:       string(m.Role),
+			Content:    openAIContent(m),
+			ToolCallID: m.ToolCallID,
+		}
+		for _, tc := range m.ToolCalls {
+			msg.ToolCalls = append(msg.ToolCalls, openAIToolCall{
+				ID:   tc.ID,
+				Type: "function",
+				Function: openAIFunctionCall{
+					Name:      tc.Name,
+					Arguments: string(toolArguments(tc)),
+				},
+			})
+		}
+		messages[i] = msg
+	}
+
+	openAIReq := openAIRequest{
+		Model:     req.Model,
+		Messages:  messages,
+		MaxTokens: req.MaxTokens,
+		Seed:      req.Seed,
+		Stream:    stream,
+	}
+	// Reasoning models reject the sampling parameters and max_tokens, which
+	// they replace with max_completion_tokens
+	if isOpenAIReasoningModel(req.Model) {
+		openAIReq.MaxTokens = 0
+		openAIReq.MaxCompletionTokens = req.MaxTokens
+		if req.Reasoning != nil {
+			openAIReq.ReasoningEffort = req.Reasoning.effort()
+		}
+	} else {
+		openAIReq.Temperature = req.Temperature
+		openAIReq.TopP = req.TopP
+		openAIReq.Stop = req.Stop
+		openAIReq.FreqPenalty = req.FrequencyPenalty
+	}
+	if stream {
+		openAIReq.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	if req.ResponseSchema != nil {
+		openAIReq.ResponseFormat = &openAIResponseFormat{
+			Type: "json_schema",
+			JSONSchema: &openAIJSONSchemaSpec{
+				Name:   req.ResponseSchema.name(),
+				Schema: req.ResponseSchema.Schema,
+			},
+		}
+	}
+
+	for _, t := range req.Tools {
+		openAIReq.Tools = append(openAIReq.Tools, openAITool{
+			Type: "function",
+			Function: openAIFunctionDecl{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
+	}
+
+	return openAIReq
+}
+
+// openAIContent encodes message content, using content parts with inline
+// data URLs when the message carries images
+func openAIContent(m Message) interface{} {
+	if !m.HasImages() {
+		return m.Text()
+	}
+
+	parts := make([]openAIContentPart, 0, len(m.Parts))
+	for _, part := range m.Parts {
+		switch part.Type {
+		case PartText:
+			parts = append(parts, openAIContentPart{Type: "text", Text: part.Text})
+		case PartImage:
+			url := "data:" + part.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(part.Data)
+			parts = append(parts, openAIContentPart{
+				Type:     "image_url",
+				ImageURL: &openAIImageURL{URL: url},
+			})
+		}
+	}
+	return parts
+}
+
+// apiError converts an error response into an Error
+func (o *OpenAI) apiError(resp *http.Response, body []byte) error {
+	var errResp openAIResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != nil {
+		code := errResp.Error.Code
+		if code == "" {
+			code = errResp.Error.Type
+		}
+		return newAPIError(o.Name(), resp, code, errResp.Error.Message)
+	}
+	return newAPIError(o.Name(), resp, "", "")
+}
+
+// setHeaders sets the JSON, auth and any configured extra headers
+func (o *OpenAI) setHeaders(httpReq *http.Request) {
+	httpReq.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+	for k, v := range o.headers {
+		httpReq.Header.Set(k, v)
+	}
 }
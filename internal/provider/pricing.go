@@ -0,0 +1,93 @@
+package provider
+
+import "strings"
+
+// Pricing is the price of a model in US dollars per million tokens
+type Pricing struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+	// CacheRead and CacheWrite price prompt tokens read from and written to
+	// the prompt cache; zero means the input price
+	CacheRead  float64 `json:"cache_read,omitempty"`
+	CacheWrite float64 `json:"cache_write,omitempty"`
+}
+
+// Cost returns the price of a request with the given usage. Thinking tokens
+// are part of the completion tokens and billed as output.
+func (p Pricing) Cost(usage Usage) float64 {
+	uncached := usage.PromptTokens - usage.CacheReadTokens - usage.CacheWriteTokens
+	if uncached < 0 {
+		uncached = 0
+	}
+	return (float64(uncached)*p.Input +
+		float64(usage.CacheReadTokens)*orPrice(p.CacheRead, p.Input) +
+		float64(usage.CacheWriteTokens)*orPrice(p.CacheWrite, p.Input) +
+		float64(usage.CompletionTokens)*p.Output) / 1e6
+}
+
+// CacheSavings returns how much cheaper the cached prompt tokens in usage
+// were than uncached input. Cache writes cost extra, so it can be negative.
+func (p Pricing) CacheSavings(usage Usage) float64 {
+	return (float64(usage.CacheReadTokens)*(p.Input-orPrice(p.CacheRead, p.Input)) -
+		float64(usage.CacheWriteTokens)*(orPrice(p.CacheWrite, p.Input)-p.Input)) / 1e6
+}
+
+// orPrice returns price, or fallback when price is unset
+func orPrice(price, fallback float64) float64 {
+	if price == 0 {
+		return fallback
+	}
+	return price
+}
+
+// DefaultPricing lists list prices for the DefaultModels, by provider and
+// model ID. Local models are free and have no entry.
+var DefaultPricing = map[string]map[string]Pricing{
+	"openai": {
+		"gpt-4o":        {Input: 2.50, Output: 10.00, CacheRead: 1.25},
+		"gpt-4o-mini":   {Input: 0.15, Output: 0.60, CacheRead: 0.075},
+		"gpt-4-turbo":   {Input: 10.00, Output: 30.00},
+		"gpt-3.5-turbo": {Input: 0.50, Output: 1.50},
+	},
+	"anthropic": {
+		"claude-sonnet-4":   {Input: 3.00, Output: 15.00, CacheRead: 0.30, CacheWrite: 3.75},
+		"claude-3-5-sonnet": {Input: 3.00, Output: 15.00, CacheRead: 0.30, CacheWrite: 3.75},
+		"claude-3-5-haiku":  {Input: 0.80, Output: 4.00, CacheRead: 0.08, CacheWrite: 1.00},
+		"claude-3-opus":     {Input: 15.00, Output: 75.00, CacheRead: 1.50, CacheWrite: 18.75},
+	},
+	"gemini": {
+		"gemini-3-pro":     {Input: 2.00, Output: 12.00},
+		"gemini-3-flash":   {Input: 0.50, Output: 3.00},
+		"gemini-2.5-pro":   {Input: 1.25, Output: 10.00},
+		"gemini-2.5-flash": {Input: 0.30, Output: 2.50},
+		"gemini-2.0-flash": {Input: 0.10, Output: 0.40},
+		"gemini-1.5-pro":   {Input: 1.25, Output: 5.00},
+		"gemini-1.5-flash": {Input: 0.075, Output: 0.30},
+	},
+}
+
+// LookupPricing returns the pricing for a model. Entries match model IDs by
+// prefix so dated and preview versions (e.g. "gpt-4o-2024-08-06") are
+// covered; the longest matching entry wins.
+func LookupPricing(provider, model string) (Pricing, bool) {
+	var best string
+	for id := range DefaultPricing[provider] {
+		if strings.HasPrefix(model, id) && len(id) > len(best) {
+			best = id
+		}
+	}
+	if best == "" {
+		return Pricing{}, false
+	}
+	return DefaultPricing[provider][best], true
+}
+
+// Cost returns the price of a request to a model, or 0 when its pricing is
+// unknown
+func Cost(provider, model string, usage Usage) float64 {
+	pricing, ok := LookupPricing(provider, model)
+	if !ok {
+		return 0
+	}
+	return pricing.Cost(usage)
+}
@@ -3,7 +3,9 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"strings"
 )
 
 // Common errors
@@ -13,6 +15,7 @@ var (
 	ErrStreamClosed    = errors.New("stream closed unexpectedly")
 	ErrRateLimited     = errors.New("rate limited by provider")
 	ErrContextCanceled = errors.New("context canceled")
+	ErrOverBudget      = errors.New("hard budget is spent")
 )
 
 // Role represents the role of a message sender
@@ -29,6 +32,114 @@ const (
 type Message struct {
 	Role    Role   `json:"role"`
 	Content string `json:"content"`
+
+	// Parts holds ordered multimodal content (text and images). When set it
+	// takes precedence over Content.
+	Parts []ContentPart `json:"parts,omitempty"`
+
+	// ToolCalls holds the tool invocations requested by an assistant message
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID links a tool result message to the call it answers
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	// Name is the name of the tool that produced a tool result message
+	Name string `json:"name,omitempty"`
+
+	// CacheBreakpoint marks the end of a prefix that stays the same across
+	// requests, such as the system prompt, so providers with prompt caching
+	// can cache everything up to and including this message
+	CacheBreakpoint bool `json:"cache_breakpoint,omitempty"`
+}
+
+// PartType identifies the kind of content held by a ContentPart
+type PartType string
+
+const (
+	PartText  PartType = "text"
+	PartImage PartType = "image"
+)
+
+// ContentPart is a single piece of message content
+type ContentPart struct {
+	Type PartType `json:"type"`
+	Text string   `json:"text,omitempty"`
+	// MIMEType and Data hold the raw bytes of an image part
+	MIMEType string `json:"mime_type,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+}
+
+// TextPart creates a text content part
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: PartText, Text: text}
+}
+
+// ImagePart creates an image content part from raw image bytes
+func ImagePart(mimeType string, data []byte) ContentPart {
+	return ContentPart{Type: PartImage, MIMEType: mimeType, Data: data}
+}
+
+// ContentParts returns the message content as parts, treating a plain
+// Content string as a single text part
+func (m Message) ContentParts() []ContentPart {
+	if len(m.Parts) > 0 {
+		return m.Parts
+	}
+	if m.Content == "" {
+		return nil
+	}
+	return []ContentPart{TextPart(m.Content)}
+}
+
+// HasImages reports whether the message contains any image parts
+func (m Message) HasImages() bool {
+	for _, part := range m.Parts {
+		if part.Type == PartImage {
+			return true
+		}
+	}
+	return false
+}
+
+// Text returns the concatenated text of the message, ignoring images
+func (m Message) Text() string {
+	if len(m.Parts) == 0 {
+		return m.Content
+	}
+	var texts []string
+	for _, part := range m.Parts {
+		if part.Type == PartText && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// SupportedImageTypes lists the image MIME types accepted by all providers
+var SupportedImageTypes = []string{"image/png", "image/jpeg", "image/webp"}
+
+// IsSupportedImageType reports whether mimeType can be sent as an image part
+func IsSupportedImageType(mimeType string) bool {
+	for _, t := range SupportedImageTypes {
+		if t == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+// Tool describes a function the model may call
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is a JSON Schema object describing the arguments
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a request from the model to invoke a tool
+type ToolCall struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Arguments is the JSON-encoded argument object
+	Arguments string `json:"arguments"`
 }
 
 // ChatRequest represents a request to an AI provider
@@ -36,16 +147,89 @@ type ChatRequest struct {
 	Model       string    `json:"model"`
 	Messages    []Message `json:"messages"`
 	MaxTokens   int       `json:"max_tokens,omitempty"`
-	Temperature float64   `json:"temperature,omitempty"`
+	Temperature *float64  `json:"temperature,omitempty"`
 	Stream      bool      `json:"stream,omitempty"`
+	Tools       []Tool    `json:"tools,omitempty"`
+
+	// Optional sampling parameters; nil or empty leaves the provider's
+	// default. Providers ignore those they don't support (see ParamChecker).
+	TopP             *float64 `json:"top_p,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int64   `json:"seed,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+
+	// ResponseSchema, when set, asks for a reply that is a single JSON
+	// document matching the schema
+	ResponseSchema *ResponseSchema `json:"response_schema,omitempty"`
+
+	// Reasoning, when set, asks reasoning models to think before answering.
+	// Models that can't are sent the request without it.
+	Reasoning *Reasoning `json:"reasoning,omitempty"`
+}
+
+// ResponseSchema describes the JSON reply wanted by a request
+type ResponseSchema struct {
+	// Name identifies the schema to providers that need one; it defaults to
+	// "response"
+	Name string `json:"name,omitempty"`
+	// Schema is a JSON Schema document
+	Schema json.RawMessage `json:"schema"`
+}
+
+// name returns the schema name sent to providers
+func (s *ResponseSchema) name() string {
+	if s.Name == "" {
+		return "response"
+	}
+	return s.Name
 }
 
 // ChatResponse represents a response from an AI provider
 type ChatResponse struct {
-	Content      string `json:"content"`
-	Model        string `json:"model"`
-	FinishReason string `json:"finish_reason,omitempty"`
-	Usage        Usage  `json:"usage,omitempty"`
+	Content      string     `json:"content"`
+	Model        string     `json:"model"`
+	FinishReason string     `json:"finish_reason,omitempty"`
+	Usage        Usage      `json:"usage,omitempty"`
+	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
+	// Reasoning is the model's thinking, where the provider returns it. It
+	// is never part of Content.
+	Reasoning string `json:"reasoning,omitempty"`
+	// Citations are the sources a grounded answer is based on
+	Citations []Citation `json:"citations,omitempty"`
+	// Provider is set by wrappers such as Fallback to the provider that
+	// actually answered
+	Provider string `json:"provider,omitempty"`
+}
+
+// Citation is a source that an answer is grounded in
+type Citation struct {
+	Title string `json:"title,omitempty"`
+	URI   string `json:"uri"`
+	// Spans are the parts of the answer the source supports
+	Spans []CitationSpan `json:"spans,omitempty"`
+}
+
+// CitationSpan is a part of the answer, as a byte range of Content
+type CitationSpan struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text,omitempty"`
+}
+
+// Locate checks the span's offsets against content. Offsets that are out of
+// range or don't match the span's text are replaced by those of the first
+// occurrence of the text. It reports false when the span can't be found.
+func (s CitationSpan) Locate(content string) (CitationSpan, bool) {
+	if s.Start >= 0 && s.Start < s.End && s.End <= len(content) &&
+		(s.Text == "" || content[s.Start:s.End] == s.Text) {
+		return s, true
+	}
+	start := strings.Index(content, s.Text)
+	if s.Text == "" || start < 0 {
+		return s, false
+	}
+	s.Start, s.End = start, start+len(s.Text)
+	return s, true
 }
 
 // Usage represents token usage information
@@ -53,6 +237,13 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// ThinkingTokens is the part of CompletionTokens spent on reasoning,
+	// where the provider reports it
+	ThinkingTokens int `json:"thinking_tokens,omitempty"`
+	// CacheReadTokens and CacheWriteTokens are the parts of PromptTokens
+	// read from and written to the provider's prompt cache
+	CacheReadTokens  int `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
 }
 
 // Provider defines the interface that all AI providers must implement
@@ -68,52 +259,60 @@ type Provider interface {
 	Send(ctx context.Context, req ChatRequest) (ChatResponse, error)
 
 	// Stream sends a chat request and calls onDelta for each token received
-	// This enables real-time streaming of responses
-	Stream(ctx context.Context, req ChatRequest, onDelta func(delta string)) error
+	// This enables real-time streaming of responses. The returned response
+	// aggregates the streamed content and any tool calls.
+	Stream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (ChatResponse, error)
 
 	// SupportsStreaming returns true if the provider supports streaming
 	SupportsStreaming() bool
 }
 
-// ModelInfo contains information about a specific model
-type ModelInfo struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Provider    string `json:"provider"`
-	MaxTokens   int    `json:"max_tokens"`
-	Description string `json:"description,omitempty"`
-}
-
-// Registry holds registered providers
-type Registry struct {
-	providers map[string]Provider
+// Keyless is implemented by providers that need no API key, such as local
+// model servers
+type Keyless interface {
+	Keyless() bool
 }
 
-// NewRegistry creates a new provider registry
-func NewRegistry() *Registry {
-	return &Registry{
-		providers: make(map[string]Provider),
+// RequiresAPIKey reports whether a provider needs an API key to send requests
+func RequiresAPIKey(p Provider) bool {
+	if k, ok := Unwrap(p).(Keyless); ok {
+		return !k.Keyless()
 	}
+	return true
 }
 
-// Register adds a provider to the registry
-func (r *Registry) Register(p Provider) {
-	r.providers[p.Name()] = p
+// ParamChecker is implemented by providers that ignore some sampling
+// parameters for some models
+type ParamChecker interface {
+	// UnsupportedParams returns the names of the parameters set on req that
+	// the provider won't send for req.Model, e.g. "seed" or "top_p"
+	UnsupportedParams(req ChatRequest) []string
 }
 
-// Get retrieves a provider by name
-func (r *Registry) Get(name string) (Provider, bool) {
-	p, ok := r.providers[name]
-	return p, ok
+// UnsupportedParams returns the parameters set on req that p ignores
+func UnsupportedParams(p Provider, req ChatRequest) []string {
+	if c, ok := Unwrap(p).(ParamChecker); ok {
+		return c.UnsupportedParams(req)
+	}
+	return nil
 }
 
-// List returns all registered provider names
-func (r *Registry) List() []string {
-	names := make([]string, 0, len(r.providers))
-	for name := range r.providers {
-		names = append(names, name)
+// toolArguments returns a tool call's arguments as a JSON object, defaulting
+// to an empty object when the model sent none
+func toolArguments(call ToolCall) json.RawMessage {
+	if call.Arguments == "" {
+		return json.RawMessage("{}")
 	}
-	return names
+	return json.RawMessage(call.Arguments)
+}
+
+// ModelInfo contains information about a specific model
+type ModelInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Provider    string `json:"provider"`
+	MaxTokens   int    `json:"max_tokens"`
+	Description string `json:"description,omitempty"`
 }
 
 // DefaultModels returns commonly used models for each provider
@@ -3,10 +3,15 @@ package provider
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestOpenAISend(t *testing.T) {
@@ -53,11 +58,7 @@ func TestOpenAISend(t *testing.T) {
 					FinishReason: "stop",
 				},
 			},
-			Usage: struct {
-				PromptTokens     int `json:"prompt_tokens"`
-				CompletionTokens int `json:"completion_tokens"`
-				TotalTokens      int `json:"total_tokens"`
-			}{
+			Usage: openAIUsage{
 				PromptTokens:     10,
 				CompletionTokens: 20,
 				TotalTokens:      30,
@@ -133,7 +134,7 @@ func TestOpenAIStream(t *testing.T) {
 	provider.baseURL = server.URL
 
 	var received strings.Builder
-	err := provider.Stream(context.Background(), ChatRequest{
+	_, err := provider.Stream(context.Background(), ChatRequest{
 		Model:    "gpt-4o",
 		Messages: []Message{{Role: RoleUser, Content: "Hi"}},
 	}, func(delta string) {
@@ -176,7 +177,7 @@ func TestOpenAIRateLimited(t *testing.T) {
 		Messages: []Message{{Role: RoleUser, Content: "Hi"}},
 	})
 
-	if err != ErrRateLimited {
+	if !errors.Is(err, ErrRateLimited) {
 		t.Errorf("expected ErrRateLimited, got %v", err)
 	}
 }
@@ -220,17 +221,11 @@ func TestAnthropicSend(t *testing.T) {
 			Type:  "message",
 			Role:  "assistant",
 			Model: "claude-3-5-sonnet-20241022",
-			Content: []struct {
-				Type string `json:"type"`
-				Text string `json:"text"`
-			}{
+			Content: []anthropicContentBlock{
 				{Type: "text", Text: "Hello! I'm Claude."},
 			},
 			StopReason: "end_turn",
-			Usage: struct {
-				InputTokens  int `json:"input_tokens"`
-				OutputTokens int `json:"output_tokens"`
-			}{
+			Usage: anthropicUsage{
 				InputTokens:  15,
 				OutputTokens: 25,
 			},
@@ -294,7 +289,7 @@ func TestAnthropicStream(t *testing.T) {
 	provider.baseURL = server.URL
 
 	var received strings.Builder
-	err := provider.Stream(context.Background(), ChatRequest{
+	_, err := provider.Stream(context.Background(), ChatRequest{
 		Model:    "claude-3-5-sonnet-20241022",
 		Messages: []Message{{Role: RoleUser, Content: "Hi"}},
 	}, func(delta string) {
@@ -363,6 +358,89 @@ func TestProviderRegistry(t *testing.T) {
 	}
 }
 
+func TestRegistryFactory(t *testing.T) {
+	registry := NewRegistry()
+	keys := map[string]string{"openai": "key1"}
+	var keysMu sync.Mutex
+	registry.SetKeyResolver(func(name string) string {
+		keysMu.Lock()
+		defer keysMu.Unlock()
+		return keys[name]
+	})
+	registry.RegisterFactory("openai", func(s Settings) Provider {
+		return NewOpenAI(s.APIKey)
+	})
+
+	// Each build is a new instance with the key configured at that moment
+	first, _ := registry.Get("openai")
+	keysMu.Lock()
+	keys["openai"] = "key2"
+	keysMu.Unlock()
+	second, _ := registry.Get("openai")
+	if Unwrap(first) == Unwrap(second) {
+		t.Error("expected a new provider instance per build")
+	}
+	if key := Unwrap(first).(*OpenAI).apiKey; key != "key1" {
+		t.Errorf("expected first build to keep key1, got '%s'", key)
+	}
+	if key := Unwrap(second).(*OpenAI).apiKey; key != "key2" {
+		t.Errorf("expected second build to use key2, got '%s'", key)
+	}
+	explicit, _ := registry.Build("openai", Settings{APIKey: "key3"})
+	if key := Unwrap(explicit).(*OpenAI).apiKey; key != "key3" {
+		t.Errorf("expected explicit key3, got '%s'", key)
+	}
+
+	// Fallback targets are built with their own keys and the caller's other
+	// settings
+	mock, err := NewMock(MockScript{})
+	if err != nil {
+		t.Fatalf("NewMock failed: %v", err)
+	}
+	var built []Settings
+	registry.RegisterFactory(mock.Name(), func(s Settings) Provider {
+		built = append(built, s)
+		return mock
+	})
+	keysMu.Lock()
+	keys[mock.Name()] = "mock-key"
+	keysMu.Unlock()
+	fallback := NewFallback(registry, map[string][]Target{"default": {{Provider: mock.Name(), Model: MockEchoModel}}})
+	registry.RegisterFactory(fallback.Name(), fallback.Factory())
+	p, ok := registry.Build(FallbackProviderName, Settings{APIKey: "fallback-key", Search: true})
+	if !ok {
+		t.Fatal("expected to build the fallback provider")
+	}
+	if _, err := p.Send(context.Background(), ChatRequest{
+		Model:    "default",
+		Messages: []Message{{Role: RoleUser, Content: "hi"}},
+	}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if len(built) != 1 || built[0].APIKey != "mock-key" || !built[0].Search {
+		t.Errorf("expected target built with mock-key and search, got %+v", built)
+	}
+
+	// Concurrent use of the registry is safe (run with -race)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if p, ok := registry.Build("openai", Settings{Search: true}); !ok || p.Name() != "openai" {
+				t.Error("expected to build openai concurrently")
+			}
+			registry.List()
+		}()
+		go func() {
+			defer wg.Done()
+			registry.Register(NewOllama(""))
+			registry.SetKeyResolver(func(string) string { return "key" })
+		}()
+	}
+	wg.Wait()
+}
+
 func TestProviderModels(t *testing.T) {
 	ctx := context.Background()
 
@@ -450,3 +528,1294 @@ func TestAPIErrorHandling(t *testing.T) {
 		t.Errorf("expected error message to contain 'Invalid model', got: %v", err)
 	}
 }
+
+func TestOpenAIStreamToolCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Tools) != 1 || req.Tools[0].Function.Name != "current_time" {
+			t.Errorf("expected current_time tool in request, got %+v", req.Tools)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := []string{
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"current_time","arguments":""}}]},"index":0}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"zone\":"}}]},"index":0}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"UTC\"}"}}]},"index":0,"finish_reason":"tool_calls"}]}`,
+		}
+		for _, chunk := range chunks {
+			w.Write([]byte("data: " + chunk + "\n\n"))
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	provider := NewOpenAI("test-key")
+	provider.baseURL = server.URL
+
+	resp, err := provider.Stream(context.Background(), ChatRequest{
+		Model:    "gpt-4o",
+		Messages: []Message{{Role: RoleUser, Content: "What time is it?"}},
+		Tools:    []Tool{{Name: "current_time", Description: "Current time"}},
+	}, func(delta string) {})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+
+	if len(resp.ToolCalls) != 1 {
+		t.Fatalf("expected 1 tool call, got %d", len(resp.ToolCalls))
+	}
+	call := resp.ToolCalls[0]
+	if call.ID != "call_1" || call.Name != "current_time" || call.Arguments != `{"zone":"UTC"}` {
+		t.Errorf("unexpected tool call: %+v", call)
+	}
+	if resp.FinishReason != "tool_calls" {
+		t.Errorf("expected finish_reason 'tool_calls', got '%s'", resp.FinishReason)
+	}
+}
+
+func TestAnthropicToolUse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+
+		// user, assistant(tool_use x2), user(tool_result x2)
+		if len(req.Messages) != 3 {
+			t.Fatalf("expected 3 messages, got %d", len(req.Messages))
+		}
+		if blocks := req.Messages[1].Content; len(blocks) != 2 || blocks[0].Type != "tool_use" {
+			t.Errorf("expected 2 tool_use blocks, got %+v", blocks)
+		}
+		results := req.Messages[2]
+		if results.Role != "user" || len(results.Content) != 2 || results.Content[1].ToolUseID != "toolu_2" {
+			t.Errorf("expected merged tool results, got %+v", results)
+		}
+		if len(req.Tools) != 1 || len(req.Tools[0].InputSchema) == 0 {
+			t.Errorf("expected tool with input schema, got %+v", req.Tools)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"model":"claude-3-5-sonnet-20241022","stop_reason":"tool_use","content":[` +
+			`{"type":"text","text":"Checking."},` +
+			`{"type":"tool_use","id":"toolu_3","name":"current_time","input":{}}]}`))
+	}))
+	defer server.Close()
+
+	provider := NewAnthropic("test-key")
+	provider.baseURL = server.URL
+
+	resp, err := provider.Send(context.Background(), ChatRequest{
+		Model: "claude-3-5-sonnet-20241022",
+		Messages: []Message{
+			{Role: RoleUser, Content: "Time?"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{
+				{ID: "toolu_1", Name: "current_time"},
+				{ID: "toolu_2", Name: "current_time", Arguments: `{"zone":"UTC"}`},
+			}},
+			{Role: RoleTool, ToolCallID: "toolu_1", Name: "current_time", Content: "12:00"},
+			{Role: RoleTool, ToolCallID: "toolu_2", Name: "current_time", Content: "10:00"},
+		},
+		Tools: []Tool{{Name: "current_time"}},
+	})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	if resp.Content != "Checking." {
+		t.Errorf("expected 'Checking.', got '%s'", resp.Content)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "toolu_3" || resp.ToolCalls[0].Arguments != "{}" {
+		t.Errorf("unexpected tool calls: %+v", resp.ToolCalls)
+	}
+}
+
+func TestGeminiFunctionDeclarations(t *testing.T) {
+	g := NewGemini("test-key")
+	req := g.buildRequest(ChatRequest{
+		Model: "gemini-2.0-flash",
+		Messages: []Message{
+			{Role: RoleUser, Content: "Time?"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_0", Name: "current_time"}}},
+			{Role: RoleTool, ToolCallID: "call_0", Name: "current_time", Content: "12:00"},
+		},
+		Tools: []Tool{{Name: "current_time", Description: "Current time"}},
+	})
+
+	if len(req.Tools) != 1 || len(req.Tools[0].FunctionDeclarations) != 1 {
+		t.Fatalf("expected one function declaration, got %+v", req.Tools)
+	}
+	if len(req.Contents) != 3 {
+		t.Fatalf("expected 3 contents, got %d", len(req.Contents))
+	}
+	call := req.Contents[1].Parts[0].FunctionCall
+	if req.Contents[1].Role != "model" || call == nil || call.Name != "current_time" {
+		t.Errorf("expected model function call, got %+v", req.Contents[1])
+	}
+	resp := req.Contents[2].Parts[0].FunctionResponse
+	if resp == nil || resp.Name != "current_time" || string(resp.Response) != `{"result":"12:00"}` {
+		t.Errorf("unexpected function response: %+v", resp)
+	}
+}
+
+func TestImageParts(t *testing.T) {
+	msg := Message{
+		Role: RoleUser,
+		Parts: []ContentPart{
+			TextPart("What is in this image?"),
+			ImagePart("image/png", []byte{0x89, 'P', 'N', 'G'}),
+		},
+	}
+	req := ChatRequest{Model: "test-model", Messages: []Message{msg}}
+
+	// OpenAI uses image_url parts with a data URL
+	openAIReq := NewOpenAI("test-key").buildRequest(req, false)
+	parts, ok := openAIReq.Messages[0].Content.([]openAIContentPart)
+	if !ok || len(parts) != 2 {
+		t.Fatalf("expected 2 OpenAI content parts, got %#v", openAIReq.Messages[0].Content)
+	}
+	if parts[1].ImageURL == nil || parts[1].ImageURL.URL != "data:image/png;base64,iVBORw==" {
+		t.Errorf("unexpected OpenAI image part: %+v", parts[1])
+	}
+
+	// Anthropic uses base64 image blocks
+	anthropicReq := NewAnthropic("test-key").buildRequest(req, false)
+	blocks := anthropicReq.Messages[0].Content
+	if len(blocks) != 2 || blocks[1].Type != "image" || blocks[1].Source == nil {
+		t.Fatalf("expected text and image blocks, got %+v", blocks)
+	}
+	if blocks[1].Source.MediaType != "image/png" || blocks[1].Source.Data != "iVBORw==" {
+		t.Errorf("unexpected Anthropic image source: %+v", blocks[1].Source)
+	}
+
+	// Gemini uses inlineData parts
+	geminiReq := NewGemini("test-key").buildRequest(req)
+	geminiParts := geminiReq.Contents[0].Parts
+	if len(geminiParts) != 2 || geminiParts[1].InlineData == nil {
+		t.Fatalf("expected text and inline data parts, got %+v", geminiParts)
+	}
+	if geminiParts[1].InlineData.MimeType != "image/png" || geminiParts[1].InlineData.Data != "iVBORw==" {
+		t.Errorf("unexpected Gemini inline data: %+v", geminiParts[1].InlineData)
+	}
+
+	// Text-only messages keep plain string content for OpenAI
+	textReq := NewOpenAI("test-key").buildRequest(ChatRequest{
+		Messages: []Message{{Role: RoleUser, Content: "Hello"}},
+	}, false)
+	if content, ok := textReq.Messages[0].Content.(string); !ok || content != "Hello" {
+		t.Errorf("expected string content, got %#v", textReq.Messages[0].Content)
+	}
+}
+
+func TestGenerationParams(t *testing.T) {
+	temperature, topP, penalty := 0.0, 0.9, 0.5
+	seed := int64(7)
+	req := ChatRequest{
+		Model:            "gpt-4o",
+		Messages:         []Message{{Role: RoleUser, Content: "Hi"}},
+		MaxTokens:        100,
+		Temperature:      &temperature,
+		TopP:             &topP,
+		Stop:             []string{"END"},
+		Seed:             &seed,
+		FrequencyPenalty: &penalty,
+	}
+
+	// A zero temperature is still sent
+	openAI := NewOpenAI("test-key")
+	body, _ := json.Marshal(openAI.buildRequest(req, false))
+	for _, want := range []string{`"temperature":0`, `"top_p":0.9`, `"stop":["END"]`, `"seed":7`, `"frequency_penalty":0.5`} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected %s in OpenAI request: %s", want, body)
+		}
+	}
+	if unsupported := UnsupportedParams(openAI, req); len(unsupported) != 0 {
+		t.Errorf("expected gpt-4o to support all parameters, got %v", unsupported)
+	}
+
+	// Reasoning models only get the parameters they accept
+	reasoningReq := req
+	reasoningReq.Model = "o3-mini"
+	openAIReq := openAI.buildRequest(reasoningReq, false)
+	if openAIReq.Temperature != nil || openAIReq.TopP != nil || openAIReq.Stop != nil || openAIReq.FreqPenalty != nil {
+		t.Errorf("expected sampling parameters dropped for o3-mini: %+v", openAIReq)
+	}
+	if openAIReq.Seed == nil || openAIReq.MaxCompletionTokens != 100 {
+		t.Error("expected seed and max_tokens (as max_completion_tokens) kept for o3-mini")
+	}
+	if unsupported := UnsupportedParams(openAI, reasoningReq); len(unsupported) != 4 {
+		t.Errorf("expected 4 unsupported parameters for o3-mini, got %v", unsupported)
+	}
+
+	// Anthropic maps stop sequences and has no seed or frequency penalty
+	anthropic := NewAnthropic("test-key")
+	anthropicReq := anthropic.buildRequest(req, false)
+	if len(anthropicReq.Stop) != 1 || anthropicReq.TopP == nil || anthropicReq.MaxTokens != 100 {
+		t.Errorf("unexpected Anthropic parameters: %+v", anthropicReq)
+	}
+	unsupported := UnsupportedParams(Chain(anthropic, Intercept(Interceptor{})), req)
+	if strings.Join(unsupported, ",") != "seed,frequency_penalty" {
+		t.Errorf("expected seed and frequency_penalty unsupported, got %v", unsupported)
+	}
+
+	// Gemini and Ollama take every parameter
+	config := NewGemini("test-key").buildRequest(req).GenerationConfig
+	if config == nil || config.Temperature == nil || len(config.StopSequences) != 1 || config.Seed == nil {
+		t.Errorf("unexpected Gemini generation config: %+v", config)
+	}
+	options := NewOllama("").buildRequest(req, false).Options
+	if options == nil || options.TopP == nil || options.NumPredict != 100 || options.FrequencyPenalty == nil {
+		t.Errorf("unexpected Ollama options: %+v", options)
+	}
+	if NewOllama("").buildRequest(ChatRequest{Model: "llama3"}, false).Options != nil {
+		t.Error("expected no Ollama options without parameters")
+	}
+}
+
+func TestReasoning(t *testing.T) {
+	temperature := 0.2
+	req := ChatRequest{
+		Model:       "claude-sonnet-4",
+		Messages:    []Message{{Role: RoleUser, Content: "Hi"}},
+		Temperature: &temperature,
+		Reasoning:   &Reasoning{Effort: ReasoningHigh},
+	}
+
+	// Anthropic thinks with a budget below max_tokens and default sampling
+	anthropic := NewAnthropic("test-key")
+	anthropicReq := anthropic.buildRequest(req, false)
+	if anthropicReq.Thinking == nil || anthropicReq.Thinking.BudgetTokens != 24576 {
+		t.Fatalf("expected a 24576 token thinking budget, got %+v", anthropicReq.Thinking)
+	}
+	if anthropicReq.MaxTokens <= 24576 || anthropicReq.Temperature != nil {
+		t.Errorf("unexpected max_tokens %d or temperature with thinking", anthropicReq.MaxTokens)
+	}
+	if got := UnsupportedParams(anthropic, req); strings.Join(got, ",") != "temperature" {
+		t.Errorf("expected temperature unsupported with thinking, got %v", got)
+	}
+	for _, r := range []ChatRequest{
+		{Model: "claude-3-5-sonnet-20241022", Reasoning: req.Reasoning},
+		{Model: "claude-sonnet-4", Reasoning: req.Reasoning, ResponseSchema: &ResponseSchema{Schema: json.RawMessage(`{}`)}},
+		{Model: "claude-sonnet-4", Reasoning: req.Reasoning, Messages: []Message{{Role: RoleTool, ToolCallID: "1"}}},
+	} {
+		if anthropic.buildRequest(r, false).Thinking != nil {
+			t.Errorf("expected no thinking for %s with %d messages", r.Model, len(r.Messages))
+		}
+	}
+
+	// OpenAI reasoning models take an effort and max_completion_tokens
+	openAI := NewOpenAI("test-key")
+	openAIReq := openAI.buildRequest(ChatRequest{Model: "o3", MaxTokens: 500, Reasoning: &Reasoning{BudgetTokens: 4000}}, false)
+	if openAIReq.ReasoningEffort != ReasoningMedium || openAIReq.MaxCompletionTokens != 500 || openAIReq.MaxTokens != 0 {
+		t.Errorf("unexpected OpenAI reasoning request: %+v", openAIReq)
+	}
+	if got := UnsupportedParams(openAI, ChatRequest{Model: "gpt-4o", Reasoning: req.Reasoning}); len(got) != 1 || got[0] != "reasoning" {
+		t.Errorf("expected reasoning unsupported for gpt-4o, got %v", got)
+	}
+
+	// Gemini 2.5 takes a budget and Gemini 3 a level
+	gemini := NewGemini("test-key")
+	config := gemini.buildRequest(ChatRequest{Model: "gemini-2.5-flash", Reasoning: &Reasoning{Effort: ReasoningLow}}).GenerationConfig
+	if config == nil || config.ThinkingConfig == nil || config.ThinkingConfig.ThinkingBudget != 2048 {
+		t.Errorf("unexpected Gemini 2.5 thinking config: %+v", config)
+	}
+	config = gemini.buildRequest(ChatRequest{Model: "gemini-3-pro-preview", Reasoning: &Reasoning{BudgetTokens: 30000}}).GenerationConfig
+	if config == nil || config.ThinkingConfig == nil || config.ThinkingConfig.ThinkingLevel != ReasoningHigh {
+		t.Errorf("unexpected Gemini 3 thinking config: %+v", config)
+	}
+
+	// Streamed thinking is reported apart from the answer
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Let me see."}}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hello"}}`,
+		} {
+			w.Write([]byte("data: " + event + "\n\n"))
+		}
+	}))
+	defer server.Close()
+	anthropic.baseURL = server.URL
+
+	var thinking, answer strings.Builder
+	ctx := WithReasoningDelta(context.Background(), func(delta string) {
+		thinking.WriteString(delta)
+	})
+	resp, err := anthropic.Stream(ctx, req, func(delta string) {
+		answer.WriteString(delta)
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if resp.Content != "Hello" || answer.String() != "Hello" {
+		t.Errorf("expected answer 'Hello', got %q (streamed %q)", resp.Content, answer.String())
+	}
+	if resp.Reasoning != "Let me see." || thinking.String() != "Let me see." {
+		t.Errorf("expected reasoning 'Let me see.', got %q (streamed %q)", resp.Reasoning, thinking.String())
+	}
+
+	// Gemini thought summaries are parts marked as thoughts
+	geminiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[` +
+			`{"text":"Thinking it over.","thought":true},{"text":"Hello"}]},"finishReason":"STOP"}]}`))
+	}))
+	defer geminiServer.Close()
+	gemini.baseURL = geminiServer.URL
+
+	resp, err = gemini.Send(context.Background(), ChatRequest{Model: "gemini-2.5-flash", Reasoning: req.Reasoning})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if resp.Content != "Hello" || resp.Reasoning != "Thinking it over." {
+		t.Errorf("expected thought apart from answer, got %q / %q", resp.Content, resp.Reasoning)
+	}
+}
+
+func TestGeminiCitations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"candidates":[{"content":{"parts":[{"text":"Go 1.22 shipped in 2024. "}]}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"candidates":[{"content":{"parts":[{"text":"It added range over ints."}]},"finishReason":"STOP",` +
+			`"groundingMetadata":{"groundingChunks":[{"web":{"uri":"https://go.dev/blog","title":"go.dev"}},{"web":{"uri":"https://example.com","title":"example"}}],` +
+			`"groundingSupports":[{"segment":{"endIndex":24,"text":"Go 1.22 shipped in 2024."},"groundingChunkIndices":[0,1]},` +
+			`{"segment":{"startIndex":0,"endIndex":25,"text":"It added range over ints."},"groundingChunkIndices":[0]}]}}]}` + "\n\n"))
+	}))
+	defer server.Close()
+
+	gemini := NewGemini("test-key")
+	gemini.baseURL = server.URL
+	resp, err := gemini.Stream(context.Background(), ChatRequest{Model: "gemini-2.5-flash"}, func(string) {})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if resp.Content != "Go 1.22 shipped in 2024. It added range over ints." {
+		t.Errorf("expected sources left out of the content, got %q", resp.Content)
+	}
+	if len(resp.Citations) != 2 || resp.Citations[0].URI != "https://go.dev/blog" || resp.Citations[1].Title != "example" {
+		t.Fatalf("unexpected citations: %+v", resp.Citations)
+	}
+
+	// The second segment's offsets are relative to its part, so it is
+	// located by its text
+	spans := resp.Citations[0].Spans
+	if len(spans) != 2 || spans[0] != (CitationSpan{Start: 0, End: 24, Text: "Go 1.22 shipped in 2024."}) ||
+		resp.Content[spans[1].Start:spans[1].End] != "It added range over ints." {
+		t.Errorf("unexpected spans: %+v", spans)
+	}
+	if len(resp.Citations[1].Spans) != 1 {
+		t.Errorf("expected one span for the second source, got %+v", resp.Citations[1].Spans)
+	}
+}
+
+func TestCitationSpanLocate(t *testing.T) {
+	content := "Go is fun. Go is fast."
+	tests := []struct {
+		span   CitationSpan
+		want   CitationSpan
+		wantOK bool
+	}{
+		{CitationSpan{Start: 11, End: 22, Text: "Go is fast."}, CitationSpan{Start: 11, End: 22, Text: "Go is fast."}, true},
+		{CitationSpan{Start: 0, End: 11, Text: "Go is fast."}, CitationSpan{Start: 11, End: 22, Text: "Go is fast."}, true},
+		{CitationSpan{Start: -5, End: 6, Text: "Go is fun."}, CitationSpan{Start: 0, End: 10, Text: "Go is fun."}, true},
+		{CitationSpan{Start: -5, End: 6}, CitationSpan{Start: -5, End: 6}, false},
+		{CitationSpan{Start: 0, End: 99, Text: "missing"}, CitationSpan{Start: 0, End: 99, Text: "missing"}, false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.span.Locate(content)
+		if ok != tt.wantOK || (ok && got != tt.want) {
+			t.Errorf("Locate(%+v) = %+v, %v; want %+v, %v", tt.span, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestResponseSchema(t *testing.T) {
+	schema := &ResponseSchema{Schema: json.RawMessage(`{
+		"type": "object",
+		"properties": {"item": {"$ref": "#/$defs/item"}},
+		"additionalProperties": false,
+		"$defs": {"item": {"type": "string"}}
+	}`)}
+	req := ChatRequest{
+		Model:          "test-model",
+		Messages:       []Message{{Role: RoleUser, Content: "List one item"}},
+		ResponseSchema: schema,
+	}
+
+	openAIReq := NewOpenAI("test-key").buildRequest(req, false)
+	if openAIReq.ResponseFormat == nil || openAIReq.ResponseFormat.Type != "json_schema" ||
+		openAIReq.ResponseFormat.JSONSchema.Name != "response" {
+		t.Errorf("unexpected OpenAI response format: %+v", openAIReq.ResponseFormat)
+	}
+
+	// Gemini gets the supported subset with references inlined
+	config := NewGemini("test-key").buildRequest(req).GenerationConfig
+	if config == nil || config.ResponseMIMEType != "application/json" {
+		t.Fatalf("expected JSON generation config, got %+v", config)
+	}
+	if got := string(config.ResponseSchema); got != `{"properties":{"item":{"type":"string"}},"type":"object"}` {
+		t.Errorf("unexpected Gemini response schema: %s", got)
+	}
+
+	if got := NewOllama("").buildRequest(req, false).Format; string(got) != string(schema.Schema) {
+		t.Errorf("expected schema as Ollama format, got %s", got)
+	}
+
+	// Anthropic is forced to call a tool whose input is the reply
+	anthropicReq := NewAnthropic("test-key").buildRequest(req, false)
+	if anthropicReq.ToolChoice == nil || anthropicReq.ToolChoice.Name != anthropicJSONTool ||
+		len(anthropicReq.Tools) != 1 || anthropicReq.Tools[0].Name != anthropicJSONTool {
+		t.Errorf("expected forced JSON tool, got %+v", anthropicReq)
+	}
+
+	// Non-object schemas are wrapped, as tool inputs must be objects
+	input, wrapped := anthropicJSONSchema(json.RawMessage(`{"type":"array","items":{"type":"integer"}}`))
+	if !wrapped || !strings.Contains(string(input), `"value"`) {
+		t.Errorf("expected wrapped array schema, got %s", input)
+	}
+	if got := anthropicJSONReply(json.RawMessage(`{"value":[1,2]}`), true); got != "[1,2]" {
+		t.Errorf("expected unwrapped reply, got %s", got)
+	}
+}
+
+func TestAnthropicJSONReply(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body anthropicRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		if !body.Stream {
+			w.Write([]byte(`{"model":"claude-sonnet-4","stop_reason":"tool_use","content":[` +
+				`{"type":"tool_use","id":"t1","name":"json_response","input":{"name":"Ada"}}]}`))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, data := range []string{
+			`{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"t1","name":"json_response"}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"name\":"}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":" \"Ada\"}"}}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use"}}`,
+		} {
+			w.Write([]byte("data: " + data + "\n\n"))
+		}
+	}))
+	defer server.Close()
+
+	p := NewAnthropic("test-key")
+	p.baseURL = server.URL
+	req := ChatRequest{
+		Model:          "claude-sonnet-4",
+		Messages:       []Message{{Role: RoleUser, Content: "Who?"}},
+		ResponseSchema: &ResponseSchema{Schema: json.RawMessage(`{"type":"object"}`)},
+	}
+
+	resp, err := p.Send(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if resp.Content != `{"name":"Ada"}` || len(resp.ToolCalls) != 0 || resp.FinishReason != "end_turn" {
+		t.Errorf("expected JSON reply as content, got %+v", resp)
+	}
+
+	var received strings.Builder
+	resp, err = p.Stream(context.Background(), req, func(delta string) {
+		received.WriteString(delta)
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if received.String() != `{"name": "Ada"}` || resp.Content != received.String() || len(resp.ToolCalls) != 0 {
+		t.Errorf("expected streamed JSON reply, got '%s' (%+v)", received.String(), resp)
+	}
+}
+
+func TestOllamaStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("expected /api/chat, got %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("expected no Authorization header, got %s", auth)
+		}
+
+		var req ollamaRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Error("expected stream=true in request")
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		lines := []string{
+			`{"model":"llama3.2","message":{"role":"assistant","content":"Hello"},"done":false}`,
+			`{"model":"llama3.2","message":{"role":"assistant","content":" there"},"done":false}`,
+			`{"model":"llama3.2","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":10,"eval_count":2}`,
+		}
+		for _, line := range lines {
+			w.Write([]byte(line + "\n"))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOllama(server.URL)
+	if RequiresAPIKey(provider) {
+		t.Error("expected Ollama to be keyless")
+	}
+
+	var received strings.Builder
+	resp, err := provider.Stream(context.Background(), ChatRequest{
+		Model:    "llama3.2",
+		Messages: []Message{{Role: RoleUser, Content: "Hi"}},
+	}, func(delta string) {
+		received.WriteString(delta)
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+
+	if received.String() != "Hello there" || resp.Content != "Hello there" {
+		t.Errorf("expected 'Hello there', got '%s' / '%s'", received.String(), resp.Content)
+	}
+	if resp.FinishReason != "stop" || resp.Usage.TotalTokens != 12 {
+		t.Errorf("unexpected final chunk data: %+v", resp)
+	}
+}
+
+func TestOllamaModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			t.Errorf("expected /api/tags, got %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"models":[{"name":"llama3.2:latest"},{"name":"qwen2.5-coder:7b"}]}`))
+	}))
+	defer server.Close()
+
+	models, err := NewOllama(server.URL).Models(context.Background())
+	if err != nil {
+		t.Fatalf("Models failed: %v", err)
+	}
+	if len(models) != 2 || models[0] != "llama3.2:latest" || models[1] != "qwen2.5-coder:7b" {
+		t.Errorf("unexpected models: %v", models)
+	}
+}
+
+func TestOpenAICompatible(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("expected /v1/chat/completions, got %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("expected no Authorization header for keyless endpoint, got %s", auth)
+		}
+		if r.Header.Get("X-Team") != "platform" {
+			t.Errorf("expected extra header to be sent")
+		}
+		w.Write([]byte(`{"model":"local-model","choices":[{"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	provider := NewOpenAICompatible(OpenAICompatibleConfig{
+		Name:    "lmstudio",
+		BaseURL: server.URL + "/v1/",
+		Headers: map[string]string{"X-Team": "platform"},
+		Models:  []string{"local-model"},
+		Keyless: true,
+	})
+
+	if provider.Name() != "lmstudio" {
+		t.Errorf("expected name 'lmstudio', got '%s'", provider.Name())
+	}
+	if RequiresAPIKey(provider) {
+		t.Error("expected keyless endpoint not to require an API key")
+	}
+	models, _ := provider.Models(context.Background())
+	if len(models) != 1 || models[0] != "local-model" {
+		t.Errorf("expected configured models, got %v", models)
+	}
+
+	resp, err := provider.Send(context.Background(), ChatRequest{
+		Model:    "local-model",
+		Messages: []Message{{Role: RoleUser, Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if resp.Content != "Hi" {
+		t.Errorf("expected 'Hi', got '%s'", resp.Content)
+	}
+
+	if !RequiresAPIKey(NewOpenAI("")) {
+		t.Error("expected OpenAI to require an API key")
+	}
+}
+
+func TestOpenAIListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" {
+			t.Errorf("expected /models, got %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"data":[{"id":"text-embedding-3-small"},{"id":"gpt-5"},{"id":"gpt-4o"},{"id":"gpt-4o-realtime-preview"}]}`))
+	}))
+	defer server.Close()
+
+	provider := NewOpenAI("test-key")
+	provider.baseURL = server.URL
+
+	models, err := provider.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("expected 2 chat models, got %v", models)
+	}
+	// Known models keep their curated metadata and come first
+	if models[0].ID != "gpt-4o" || models[0].Description == "" {
+		t.Errorf("expected gpt-4o with metadata first, got %+v", models[0])
+	}
+	if models[1].ID != "gpt-5" {
+		t.Errorf("expected new model gpt-5, got %+v", models[1])
+	}
+}
+
+// fakeLister is a provider whose live model list can be controlled by tests
+type fakeLister struct {
+	Anthropic
+	models []ModelInfo
+	err    error
+	calls  int
+}
+
+func (f *fakeLister) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	f.calls++
+	return f.models, f.err
+}
+
+func TestModelCache(t *testing.T) {
+	cache := NewModelCache(t.TempDir(), time.Hour)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	p := &fakeLister{models: []ModelInfo{{ID: "claude-new"}}}
+
+	// First call fetches and caches
+	models, err := cache.Models(context.Background(), p)
+	if err != nil || len(models) != 1 || models[0] != "claude-new" {
+		t.Fatalf("expected live models, got %v (%v)", models, err)
+	}
+
+	// Fresh cache avoids a second fetch
+	cache.Models(context.Background(), p)
+	if p.calls != 1 {
+		t.Errorf("expected cached result, got %d fetches", p.calls)
+	}
+
+	// Stale cache is refreshed, and kept when the refresh fails
+	now = now.Add(2 * time.Hour)
+	p.err = ErrRateLimited
+	models, err = cache.Models(context.Background(), p)
+	if p.calls != 2 {
+		t.Errorf("expected refetch of stale cache, got %d fetches", p.calls)
+	}
+	if err != nil || len(models) != 1 || models[0] != "claude-new" {
+		t.Errorf("expected stale cache when offline, got %v (%v)", models, err)
+	}
+
+	// Without a cache, offline falls back to the static list
+	empty := NewModelCache(t.TempDir(), time.Hour)
+	models, err = empty.Models(context.Background(), p)
+	if err != nil || len(models) != len(DefaultModels["anthropic"]) {
+		t.Errorf("expected static fallback, got %v (%v)", models, err)
+	}
+}
+
+func TestProviderErrorDetails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "4")
+		w.WriteHeader(529)
+		w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`))
+	}))
+	defer server.Close()
+
+	provider := NewAnthropic("test-key")
+	provider.baseURL = server.URL
+
+	_, err := provider.Send(context.Background(), ChatRequest{
+		Model:    "claude-sonnet-4-20250514",
+		Messages: []Message{{Role: RoleUser, Content: "Hi"}},
+	})
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *Error, got %T: %v", err, err)
+	}
+	if apiErr.StatusCode != 529 || apiErr.Code != "overloaded_error" || apiErr.Message != "Overloaded" {
+		t.Errorf("unexpected error details: %+v", apiErr)
+	}
+	if !apiErr.Retryable || apiErr.RetryAfter != 4*time.Second {
+		t.Errorf("expected retryable error with 4s Retry-After, got %+v", apiErr)
+	}
+
+	notice := RetryNotice{Attempt: 2, MaxAttempts: 5, Delay: 4 * time.Second, Err: err}
+	if notice.String() != "overloaded, retrying in 4s (2/5)" {
+		t.Errorf("unexpected retry notice: %s", notice.String())
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	transient := &Error{Provider: "test", StatusCode: 503, Retryable: true}
+
+	// Retries transient failures until success
+	calls := 0
+	var notices []RetryNotice
+	err := policy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return transient
+		}
+		return nil
+	}, func(n RetryNotice) {
+		notices = append(notices, n)
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success on third attempt, got %v after %d calls", err, calls)
+	}
+	if len(notices) != 2 || notices[0].Attempt != 2 || notices[1].Attempt != 3 {
+		t.Errorf("unexpected retry notices: %+v", notices)
+	}
+
+	// Gives up after MaxAttempts
+	calls = 0
+	err = policy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return transient
+	}, nil)
+	if err != transient || calls != 3 {
+		t.Errorf("expected transient error after 3 calls, got %v after %d calls", err, calls)
+	}
+
+	// Doesn't retry permanent failures
+	calls = 0
+	permanent := &Error{Provider: "test", StatusCode: 400}
+	err = policy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return permanent
+	}, nil)
+	if err != permanent || calls != 1 {
+		t.Errorf("expected one call for permanent error, got %d", calls)
+	}
+
+	// Stops waiting when the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	slow := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	err = slow.Do(ctx, func(ctx context.Context) error {
+		return transient
+	}, func(RetryNotice) {
+		cancel()
+	})
+	if err != ErrContextCanceled {
+		t.Errorf("expected ErrContextCanceled, got %v", err)
+	}
+}
+
+func TestStreamUsage(t *testing.T) {
+	t.Run("openai", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req openAIRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+				t.Error("expected stream_options.include_usage in request")
+			}
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(`data: {"model":"o3-mini","choices":[{"delta":{"content":"Hi"},"index":0,"finish_reason":"stop"}]}` + "\n\n"))
+			w.Write([]byte(`data: {"model":"o3-mini","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":40,"total_tokens":52,"completion_tokens_details":{"reasoning_tokens":32}}}` + "\n\n"))
+			w.Write([]byte("data: [DONE]\n\n"))
+		}))
+		defer server.Close()
+
+		p := NewOpenAI("test-key")
+		p.baseURL = server.URL
+
+		resp, err := p.Stream(context.Background(), ChatRequest{
+			Model:    "o3-mini",
+			Messages: []Message{{Role: RoleUser, Content: "Hi"}},
+		}, func(string) {})
+		if err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+		want := Usage{PromptTokens: 12, CompletionTokens: 40, TotalTokens: 52, ThinkingTokens: 32}
+		if resp.Usage != want {
+			t.Errorf("expected usage %+v, got %+v", want, resp.Usage)
+		}
+	})
+
+	t.Run("anthropic", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"model\":\"claude-sonnet-4\",\"usage\":{\"input_tokens\":25,\"output_tokens\":1}}}\n\n"))
+			w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi\"}}\n\n"))
+			w.Write([]byte("event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":15}}\n\n"))
+			w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+		}))
+		defer server.Close()
+
+		p := NewAnthropic("test-key")
+		p.baseURL = server.URL
+
+		resp, err := p.Stream(context.Background(), ChatRequest{
+			Model:    "claude-sonnet-4",
+			Messages: []Message{{Role: RoleUser, Content: "Hi"}},
+		}, func(string) {})
+		if err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+		want := Usage{PromptTokens: 25, CompletionTokens: 15, TotalTokens: 40}
+		if resp.Usage != want {
+			t.Errorf("expected usage %+v, got %+v", want, resp.Usage)
+		}
+		if resp.FinishReason != "end_turn" {
+			t.Errorf("expected finish reason 'end_turn', got '%s'", resp.FinishReason)
+		}
+	})
+
+	t.Run("gemini", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(`data: {"candidates":[{"content":{"parts":[{"text":"Hi"}]}}],"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":1,"totalTokenCount":9}}` + "\n\n"))
+			w.Write([]byte(`data: {"candidates":[{"content":{"parts":[{"text":"!"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":2,"totalTokenCount":30,"thoughtsTokenCount":20}}` + "\n\n"))
+		}))
+		defer server.Close()
+
+		p := NewGemini("test-key")
+		p.baseURL = server.URL
+
+		resp, err := p.Stream(context.Background(), ChatRequest{
+			Model:    "gemini-2.5-flash",
+			Messages: []Message{{Role: RoleUser, Content: "Hi"}},
+		}, func(string) {})
+		if err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+		want := Usage{PromptTokens: 8, CompletionTokens: 22, TotalTokens: 30, ThinkingTokens: 20}
+		if resp.Usage != want {
+			t.Errorf("expected usage %+v, got %+v", want, resp.Usage)
+		}
+	})
+}
+
+func TestPricing(t *testing.T) {
+	// Dated model IDs match the longest known prefix
+	p, ok := LookupPricing("openai", "gpt-4o-mini-2024-07-18")
+	if !ok || p != DefaultPricing["openai"]["gpt-4o-mini"] {
+		t.Errorf("expected gpt-4o-mini pricing, got %+v (ok=%v)", p, ok)
+	}
+	p, ok = LookupPricing("openai", "gpt-4o-2024-08-06")
+	if !ok || p != DefaultPricing["openai"]["gpt-4o"] {
+		t.Errorf("expected gpt-4o pricing, got %+v (ok=%v)", p, ok)
+	}
+	if _, ok := LookupPricing("ollama", "llama3.2"); ok {
+		t.Error("expected no pricing for local models")
+	}
+
+	usage := Usage{PromptTokens: 1000000, CompletionTokens: 500000}
+	if cost := Cost("anthropic", "claude-sonnet-4-20250514", usage); cost != 10.5 {
+		t.Errorf("expected cost 10.5, got %v", cost)
+	}
+	if cost := Cost("groq", "llama-3.3-70b-versatile", usage); cost != 0 {
+		t.Errorf("expected unknown model to cost 0, got %v", cost)
+	}
+
+	// Cache reads are billed at the cache price
+	cached := Usage{PromptTokens: 1000000, CacheReadTokens: 1000000}
+	if cost := Cost("anthropic", "claude-sonnet-4", cached); math.Abs(cost-0.30) > 1e-9 {
+		t.Errorf("expected cached cost 0.30, got %v", cost)
+	}
+	if saved := DefaultPricing["anthropic"]["claude-sonnet-4"].CacheSavings(cached); math.Abs(saved-2.70) > 1e-9 {
+		t.Errorf("expected savings of 2.70, got %v", saved)
+	}
+}
+
+func TestPromptCaching(t *testing.T) {
+	req := ChatRequest{
+		Model: "claude-sonnet-4",
+		Messages: []Message{
+			{Role: RoleSystem, Content: "You are helpful", CacheBreakpoint: true},
+			{Role: RoleSystem, Content: "Attached files", CacheBreakpoint: true},
+			{Role: RoleUser, Content: "Hi"},
+		},
+	}
+
+	// Both system messages are kept, each with a cache breakpoint
+	body, _ := json.Marshal(NewAnthropic("test-key").buildRequest(req, false))
+	want := `"system":[{"type":"text","text":"You are helpful","cache_control":{"type":"ephemeral"}},` +
+		`{"type":"text","text":"Attached files","cache_control":{"type":"ephemeral"}}]`
+	if !strings.Contains(string(body), want) {
+		t.Errorf("expected cached system blocks, got %s", body)
+	}
+
+	// No more than four breakpoints are sent
+	many := ChatRequest{Model: "claude-sonnet-4"}
+	for i := 0; i < 6; i++ {
+		many.Messages = append(many.Messages, Message{Role: RoleUser, Content: "x", CacheBreakpoint: true})
+		many.Messages = append(many.Messages, Message{Role: RoleAssistant, Content: "y"})
+	}
+	body, _ = json.Marshal(NewAnthropic("test-key").buildRequest(many, false))
+	if n := strings.Count(string(body), "cache_control"); n != anthropicMaxBreakpoints {
+		t.Errorf("expected %d breakpoints, got %d", anthropicMaxBreakpoints, n)
+	}
+
+	// Cached tokens are counted as prompt tokens
+	var usage anthropicUsage
+	json.Unmarshal([]byte(`{"input_tokens":20,"output_tokens":5,"cache_creation_input_tokens":300,"cache_read_input_tokens":1000}`), &usage)
+	if u := usage.usage(); u.PromptTokens != 1320 || u.CacheReadTokens != 1000 || u.CacheWriteTokens != 300 || u.TotalTokens != 1325 {
+		t.Errorf("unexpected Anthropic cache usage: %+v", u)
+	}
+
+	var openAI openAIUsage
+	json.Unmarshal([]byte(`{"prompt_tokens":2000,"completion_tokens":10,"total_tokens":2010,"prompt_tokens_details":{"cached_tokens":1536}}`), &openAI)
+	if u := openAI.usage(); u.CacheReadTokens != 1536 || u.PromptTokens != 2000 {
+		t.Errorf("unexpected OpenAI cache usage: %+v", u)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	targets, err := ParseChain("anthropic/claude-sonnet-4 -> openrouter/openai/gpt-4o")
+	if err != nil {
+		t.Fatalf("ParseChain failed: %v", err)
+	}
+	if len(targets) != 2 || targets[1] != (Target{Provider: "openrouter", Model: "openai/gpt-4o"}) {
+		t.Errorf("unexpected targets: %+v", targets)
+	}
+	if _, err := ParseChain("anthropic -> openai/gpt-4o"); err == nil {
+		t.Error("expected error for target without a model")
+	}
+
+	overloaded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(529)
+		w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`))
+	}))
+	defer overloaded.Close()
+
+	var gotModel string
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		gotModel = req.Model
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"choices":[{"delta":{"content":"Hello"},"index":0,"finish_reason":"stop"}]}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer healthy.Close()
+
+	anthropic := NewAnthropic("test-key")
+	anthropic.baseURL = overloaded.URL
+	openai := NewOpenAI("test-key")
+	openai.baseURL = healthy.URL
+
+	registry := NewRegistry()
+	registry.Register(anthropic)
+	registry.Register(openai)
+	fallback := NewFallback(registry, map[string][]Target{
+		"default": {{Provider: "anthropic", Model: "claude-sonnet-4"}, {Provider: "openai", Model: "gpt-4o"}},
+	})
+
+	var notices []string
+	ctx := WithFallbackNotice(context.Background(), func(n FallbackNotice) {
+		notices = append(notices, n.String())
+	})
+
+	var received strings.Builder
+	resp, err := fallback.Stream(ctx, ChatRequest{
+		Model:    "default",
+		Messages: []Message{{Role: RoleUser, Content: "Hi"}},
+	}, func(delta string) {
+		received.WriteString(delta)
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if received.String() != "Hello" {
+		t.Errorf("expected 'Hello', got '%s'", received.String())
+	}
+	if resp.Provider != "openai" || gotModel != "gpt-4o" {
+		t.Errorf("expected answer from openai/gpt-4o, got %s (requested %s)", resp.Provider, gotModel)
+	}
+	if len(notices) != 1 || notices[0] != "anthropic overloaded, falling back to openai/gpt-4o" {
+		t.Errorf("unexpected notices: %v", notices)
+	}
+
+	// Non-retryable failures are returned without trying the next target
+	badRequest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"bad request","type":"invalid_request_error"}}`))
+	}))
+	defer badRequest.Close()
+	openai.baseURL = badRequest.URL
+	anthropicCalled := false
+	unused := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		anthropicCalled = true
+	}))
+	defer unused.Close()
+	anthropic.baseURL = unused.URL
+	fallback = NewFallback(registry, map[string][]Target{
+		"default": {{Provider: "openai", Model: "gpt-4o"}, {Provider: "anthropic", Model: "claude-sonnet-4"}},
+	})
+	var apiErr *Error
+	if _, err := fallback.Send(context.Background(), ChatRequest{Model: "default"}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected the openai 400 error, got %v", err)
+	}
+	if anthropicCalled {
+		t.Error("expected no fallback after a non-retryable error")
+	}
+	if _, err := fallback.Send(context.Background(), ChatRequest{Model: "missing"}); err == nil {
+		t.Error("expected error for unknown chain")
+	}
+}
+
+func TestFallbackBudget(t *testing.T) {
+	anthropicCalled := false
+	overBudget := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		anthropicCalled = true
+	}))
+	defer overBudget.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}]}`))
+	}))
+	defer healthy.Close()
+
+	anthropic := NewAnthropic("test-key")
+	anthropic.baseURL = overBudget.URL
+	openai := NewOpenAI("test-key")
+	openai.baseURL = healthy.URL
+
+	registry := NewRegistry()
+	registry.Register(anthropic)
+	registry.Register(openai)
+	fallback := NewFallback(registry, map[string][]Target{
+		"default": {{Provider: "anthropic", Model: "claude-sonnet-4"}, {Provider: "openai", Model: "gpt-4o"}},
+	})
+
+	var checked []string
+	p := fallback.Factory()(Settings{Budget: func(provider string) error {
+		checked = append(checked, provider)
+		if provider == "anthropic" {
+			return fmt.Errorf("anthropic has spent its budget: %w", ErrOverBudget)
+		}
+		return nil
+	}})
+
+	var notices []string
+	ctx := WithFallbackNotice(context.Background(), func(n FallbackNotice) {
+		notices = append(notices, n.String())
+	})
+	resp, err := p.Send(ctx, ChatRequest{Model: "default"})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if anthropicCalled {
+		t.Error("expected the target over budget not to be called")
+	}
+	if resp.Provider != "openai" || len(checked) != 2 {
+		t.Errorf("expected openai to answer after checking both budgets, got %s (checked %v)", resp.Provider, checked)
+	}
+	if len(notices) != 1 || notices[0] != "anthropic is over budget, falling back to openai/gpt-4o" {
+		t.Errorf("unexpected notices: %v", notices)
+	}
+
+	// With every target over budget the chain fails without calling any
+	p = fallback.Factory()(Settings{Budget: func(string) error { return ErrOverBudget }})
+	if _, err := p.Send(context.Background(), ChatRequest{Model: "default"}); !errors.Is(err, ErrOverBudget) {
+		t.Errorf("expected ErrOverBudget, got %v", err)
+	}
+	if anthropicCalled {
+		t.Error("expected no target to be called")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	var got ChatRequest
+	recorder := Intercept(Interceptor{
+		Request: func(ctx context.Context, req *ChatRequest) error {
+			got = *req
+			return nil
+		},
+	})
+	p := Chain(NewOllama(""), Redact("sk-secret", ""), recorder, Intercept(Interceptor{
+		Request: func(ctx context.Context, req *ChatRequest) error {
+			return ErrInvalidResponse
+		},
+	}))
+
+	messages := []Message{
+		{Role: RoleUser, Content: "my key is sk-secret"},
+		{Role: RoleUser, Parts: []ContentPart{TextPart("sk-secret again")}},
+	}
+	p.Send(context.Background(), ChatRequest{Model: "llama3", Messages: messages})
+
+	if got.Messages[0].Content != "my key is [REDACTED]" {
+		t.Errorf("expected redacted content, got '%s'", got.Messages[0].Content)
+	}
+	if got.Messages[1].Parts[0].Text != "[REDACTED] again" {
+		t.Errorf("expected redacted part, got '%s'", got.Messages[1].Parts[0].Text)
+	}
+	// The caller's history is left untouched
+	if messages[0].Content != "my key is sk-secret" || messages[1].Parts[0].Text != "sk-secret again" {
+		t.Error("expected Redact not to modify the caller's messages")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var gotContent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		gotContent, _ = req.Messages[0].Content.(string)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"choices":[{"delta":{"content":"hello"},"index":0}]}` + "\n\n"))
+		w.Write([]byte(`data: {"choices":[{"delta":{"content":" world"},"index":0,"finish_reason":"stop"}]}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	openai := NewOpenAI("test-key")
+	openai.baseURL = server.URL
+
+	var order []string
+	trace := func(name string) Middleware {
+		return Intercept(Interceptor{
+			Request: func(ctx context.Context, req *ChatRequest) error {
+				order = append(order, name+" request")
+				return nil
+			},
+			Response: func(ctx context.Context, req ChatRequest, resp *ChatResponse, err error) error {
+				order = append(order, name+" response")
+				return err
+			},
+		})
+	}
+	redact := Intercept(Interceptor{
+		Request: func(ctx context.Context, req *ChatRequest) error {
+			req.Messages[0].Content = strings.ReplaceAll(req.Messages[0].Content, "secret", "[redacted]")
+			return nil
+		},
+		Delta: strings.ToUpper,
+		Response: func(ctx context.Context, req ChatRequest, resp *ChatResponse, err error) error {
+			resp.Content = strings.ToUpper(resp.Content)
+			return err
+		},
+	})
+
+	registry := NewRegistry()
+	registry.Register(openai)
+	registry.Register(NewOllama(""))
+	// Middleware also applies to providers registered before Use
+	registry.Use(trace("outer"), trace("inner"), redact)
+
+	p, _ := registry.Get("openai")
+	var received strings.Builder
+	resp, err := p.Stream(context.Background(), ChatRequest{
+		Model:    "gpt-4o",
+		Messages: []Message{{Role: RoleUser, Content: "my secret"}},
+	}, func(delta string) {
+		received.WriteString(delta)
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if gotContent != "my [redacted]" {
+		t.Errorf("expected redacted request, got '%s'", gotContent)
+	}
+	if received.String() != "HELLO WORLD" || resp.Content != "HELLO WORLD" {
+		t.Errorf("expected rewritten deltas and response, got '%s' / '%s'", received.String(), resp.Content)
+	}
+	want := []string{"outer request", "inner request", "inner response", "outer response"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Errorf("unexpected middleware order: %v", order)
+	}
+
+	// Wrapped providers keep their optional interfaces
+	if Unwrap(p) != Provider(openai) {
+		t.Error("expected Unwrap to return the registered provider")
+	}
+	ollama, _ := registry.Get("ollama")
+	if RequiresAPIKey(ollama) {
+		t.Error("expected wrapped Ollama to stay keyless")
+	}
+
+	// A Request hook can abort the call
+	blocked := Chain(openai, Intercept(Interceptor{
+		Request: func(ctx context.Context, req *ChatRequest) error {
+			return ErrInvalidResponse
+		},
+	}))
+	if _, err := blocked.Send(context.Background(), ChatRequest{Model: "gpt-4o"}); err != ErrInvalidResponse {
+		t.Errorf("expected aborted call, got %v", err)
+	}
+}
+
+func TestMock(t *testing.T) {
+	script := MockScript{
+		Rules: []MockRule{
+			{Match: "(?i)^hello", Response: "Hi there, friend!"},
+			{Match: "busy", Status: http.StatusTooManyRequests, RetryAfter: 2, Times: 1},
+			{Match: "busy", Response: "Now I can answer."},
+			{Match: "drop", Response: "one two three four", DisconnectAfter: 2},
+		},
+	}
+	mock, err := NewMock(script)
+	if err != nil {
+		t.Fatalf("NewMock failed: %v", err)
+	}
+	if RequiresAPIKey(mock) {
+		t.Error("expected mock to need no API key")
+	}
+
+	stream := func(model, prompt string) (string, ChatResponse, error) {
+		var received strings.Builder
+		resp, err := mock.Stream(context.Background(), ChatRequest{
+			Model:    model,
+			Messages: []Message{{Role: RoleUser, Content: prompt}},
+		}, func(delta string) {
+			received.WriteString(delta)
+		})
+		return received.String(), resp, err
+	}
+
+	got, resp, err := stream(MockScriptedModel, "Hello bot")
+	if err != nil || got != "Hi there, friend!" || resp.Content != got {
+		t.Errorf("unexpected scripted answer '%s' (err %v)", got, err)
+	}
+	if resp.Usage.CompletionTokens != 3 || resp.Usage.PromptTokens == 0 {
+		t.Errorf("unexpected fake usage: %+v", resp.Usage)
+	}
+
+	// Unmatched prompts and the echo model echo the message
+	if got, _, _ := stream(MockScriptedModel, "something else"); got != "something else" {
+		t.Errorf("expected echo, got '%s'", got)
+	}
+	if got, _, _ := stream(MockEchoModel, "Hello bot"); got != "Hello bot" {
+		t.Errorf("expected echo from the echo model, got '%s'", got)
+	}
+
+	// The injected 429 only fires once, then the next rule answers
+	_, _, err = stream(MockScriptedModel, "are you busy?")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrRateLimited) || apiErr.RetryAfter != 2*time.Second {
+		t.Errorf("expected injected rate limit, got %v", err)
+	}
+	if got, _, err := stream(MockScriptedModel, "are you busy?"); err != nil || got != "Now I can answer." {
+		t.Errorf("expected answer after the injected error, got '%s' (err %v)", got, err)
+	}
+
+	// A disconnect fails mid-stream after some tokens
+	got, _, err = stream(MockScriptedModel, "drop it")
+	if err == nil || got != "one two " {
+		t.Errorf("expected disconnect after two tokens, got '%s' (err %v)", got, err)
+	}
+
+	if _, err := NewMock(MockScript{Rules: []MockRule{{Match: "("}}}); err == nil {
+		t.Error("expected error for an invalid pattern")
+	}
+}
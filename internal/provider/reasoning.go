@@ -0,0 +1,83 @@
+package provider
+
+import "context"
+
+// Reasoning effort levels
+const (
+	ReasoningLow    = "low"
+	ReasoningMedium = "medium"
+	ReasoningHigh   = "high"
+)
+
+// ReasoningEfforts lists the effort levels, from least to most thinking
+var ReasoningEfforts = []string{ReasoningLow, ReasoningMedium, ReasoningHigh}
+
+// Reasoning asks a model to think before it answers. Set either an effort
+// level or a thinking token budget; providers that take the other form
+// convert between them.
+type Reasoning struct {
+	// Effort is ReasoningLow, ReasoningMedium or ReasoningHigh
+	Effort string `json:"effort,omitempty"`
+	// BudgetTokens caps the tokens spent thinking
+	BudgetTokens int `json:"budget_tokens,omitempty"`
+}
+
+// reasoningBudgets are the thinking budgets used for each effort level
+var reasoningBudgets = map[string]int{
+	ReasoningLow:    2048,
+	ReasoningMedium: 8192,
+	ReasoningHigh:   24576,
+}
+
+// IsReasoningEffort reports whether s is a known effort level
+func IsReasoningEffort(s string) bool {
+	_, ok := reasoningBudgets[s]
+	return ok
+}
+
+// budget returns the thinking token budget, derived from the effort level
+// when no budget is set
+func (r *Reasoning) budget() int {
+	if r.BudgetTokens > 0 {
+		return r.BudgetTokens
+	}
+	if b, ok := reasoningBudgets[r.Effort]; ok {
+		return b
+	}
+	return reasoningBudgets[ReasoningMedium]
+}
+
+// effort returns the effort level, derived from the budget when no level is
+// set
+func (r *Reasoning) effort() string {
+	if IsReasoningEffort(r.Effort) {
+		return r.Effort
+	}
+	switch b := r.BudgetTokens; {
+	case b <= 0:
+		return ReasoningMedium
+	case b <= reasoningBudgets[ReasoningLow]:
+		return ReasoningLow
+	case b <= reasoningBudgets[ReasoningMedium]:
+		return ReasoningMedium
+	default:
+		return ReasoningHigh
+	}
+}
+
+type reasoningDeltaKey struct{}
+
+// WithReasoningDelta returns a context that reports reasoning text to fn as
+// it streams. Reasoning is never passed to Stream's onDelta.
+func WithReasoningDelta(ctx context.Context, fn func(delta string)) context.Context {
+	return context.WithValue(ctx, reasoningDeltaKey{}, fn)
+}
+
+// reasoningDelta returns the reasoning callback set on ctx, or one that
+// discards the text
+func reasoningDelta(ctx context.Context) func(delta string) {
+	if fn, ok := ctx.Value(reasoningDeltaKey{}).(func(delta string)); ok && fn != nil {
+		return fn
+	}
+	return func(string) {}
+}
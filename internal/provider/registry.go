@@ -0,0 +1,142 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Settings configure a provider built by a Factory
+type Settings struct {
+	// APIKey is the credential to use; when empty the registry's key
+	// resolver supplies it
+	APIKey string
+	// Search enables web search grounding on providers that offer it
+	Search bool
+	// Budget, when set, is asked before each call a fallback chain makes. It
+	// returns an error wrapping ErrOverBudget for a provider whose hard
+	// budget is spent, and the chain moves on to its next target.
+	Budget func(provider string) error
+}
+
+// Factory builds a provider from settings. Built providers are never changed
+// afterwards, so callers build one per request or session instead of
+// reconfiguring a shared instance.
+type Factory func(s Settings) Provider
+
+// KeyResolver returns the current API key for the named provider, or "" when
+// none is configured
+type KeyResolver func(provider string) string
+
+// Registry builds providers by name. It is safe for concurrent use.
+type Registry struct {
+	mu         sync.RWMutex
+	factories  map[string]Factory
+	keys       KeyResolver
+	middleware []Middleware
+	modelCache *ModelCache
+}
+
+// NewRegistry creates a new provider registry
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: make(map[string]Factory),
+	}
+}
+
+// Register adds a provider that is returned as is for every request, for
+// providers that take no settings such as local servers and test doubles
+func (r *Registry) Register(p Provider) {
+	r.RegisterFactory(p.Name(), func(Settings) Provider { return p })
+}
+
+// RegisterFactory adds a provider that is built by f for every request
+func (r *Registry) RegisterFactory(name string, f Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = f
+}
+
+// SetKeyResolver sets how API keys are found for providers built without one
+func (r *Registry) SetKeyResolver(keys KeyResolver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = keys
+}
+
+// Use adds middleware that wraps every provider returned by Get and Build,
+// including providers registered earlier
+func (r *Registry) Use(middleware ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Get builds a provider by name with its current API key and default
+// settings, wrapped in the registry's middleware
+func (r *Registry) Get(name string) (Provider, bool) {
+	return r.Build(name, Settings{})
+}
+
+// Build builds a provider by name with settings, wrapped in the registry's
+// middleware
+func (r *Registry) Build(name string, s Settings) (Provider, bool) {
+	p, ok := r.build(name, s)
+	if !ok {
+		return nil, false
+	}
+	r.mu.RLock()
+	middleware := append([]Middleware(nil), r.middleware...)
+	r.mu.RUnlock()
+	return Chain(p, middleware...), true
+}
+
+// build builds a provider by name without middleware, for wrappers such as
+// Fallback whose own calls already pass through it
+func (r *Registry) build(name string, s Settings) (Provider, bool) {
+	r.mu.RLock()
+	f, ok := r.factories[name]
+	keys := r.keys
+	r.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	if s.APIKey == "" && keys != nil {
+		s.APIKey = keys(name)
+	}
+	return f(s), true
+}
+
+// SetModelCache enables on-disk caching of model lists for Models
+func (r *Registry) SetModelCache(c *ModelCache) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.modelCache = c
+}
+
+// Models returns the models offered by the named provider, served from the
+// model cache when one is set
+func (r *Registry) Models(ctx context.Context, name string) ([]string, error) {
+	p, ok := r.build(name, Settings{})
+	if !ok {
+		return nil, fmt.Errorf("unknown provider: %s", name)
+	}
+	r.mu.RLock()
+	cache := r.modelCache
+	r.mu.RUnlock()
+	if cache != nil {
+		return cache.Models(ctx, p)
+	}
+	return p.Models(ctx)
+}
+
+// List returns all registered provider names
+func (r *Registry) List() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry; it doubles each attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy retries transient failures up to five attempts in total
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// RetryNotice describes a retry that is about to happen
+type RetryNotice struct {
+	// Attempt is the number of the upcoming attempt, starting at 2
+	Attempt     int
+	MaxAttempts int
+	Delay       time.Duration
+	Err         error
+}
+
+// String formats the notice for the status bar, e.g.
+// "overloaded, retrying in 4s (2/5)"
+func (n RetryNotice) String() string {
+	reason := "request failed"
+	var apiErr *Error
+	if errors.As(n.Err, &apiErr) {
+		reason = apiErr.Reason()
+	}
+	secs := int(math.Ceil(n.Delay.Seconds()))
+	return fmt.Sprintf("%s, retrying in %ds (%d/%d)", reason, secs, n.Attempt, n.MaxAttempts)
+}
+
+// Delay returns the wait before the given attempt (2 for the first retry).
+// A Retry-After from the provider wins; otherwise the exponential delay is
+// jittered between half and the full value.
+func (p RetryPolicy) Delay(attempt int, err error) time.Duration {
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if p.MaxDelay > 0 && apiErr.RetryAfter > p.MaxDelay {
+			return p.MaxDelay
+		}
+		return apiErr.RetryAfter
+	}
+
+	delay := p.BaseDelay << uint(attempt-2)
+	if p.MaxDelay > 0 && (delay > p.MaxDelay || delay <= 0) {
+		delay = p.MaxDelay
+	}
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Do calls fn until it succeeds, fails with a non-retryable error, runs out
+// of attempts or ctx is cancelled. onRetry, if set, is called before each
+// wait.
+func (p RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error, onRetry func(RetryNotice)) error {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+		if err == nil || !IsRetryable(err) || attempt >= maxAttempts {
+			return err
+		}
+
+		delay := p.Delay(attempt+1, err)
+		if onRetry != nil {
+			onRetry(RetryNotice{Attempt: attempt + 1, MaxAttempts: maxAttempts, Delay: delay, Err: err})
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ErrContextCanceled
+		case <-timer.C:
+		}
+	}
+}
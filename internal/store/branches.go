@@ -0,0 +1,123 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// activePathCTE selects the messages on a session's active branch as
+// path(msg_id, depth) by walking parent links up from the active leaf, with
+// depth 0 at the leaf. Its one parameter is the session ID.
+const activePathCTE = `WITH RECURSIVE path(msg_id, depth) AS (
+		SELECT active_leaf_id, 0 FROM sessions WHERE id = ? AND active_leaf_id != ''
+		UNION ALL
+		SELECT m.parent_id, path.depth + 1 FROM messages m JOIN path ON m.id = path.msg_id
+		WHERE m.parent_id != ''
+	)
+	`
+
+// Branch locates a message among the versions that share its parent
+type Branch struct {
+	// Index is the message's position among the versions, from 1 for the
+	// oldest
+	Index int
+	// Count is the number of versions
+	Count int
+}
+
+// GetBranches returns the position of every message in a session that has
+// other versions, keyed by message ID. Messages without siblings are left
+// out.
+func (s *Store) GetBranches(sessionID string) (map[string]Branch, error) {
+	rows, err := s.db.Query(`
+		SELECT id, parent_id FROM messages WHERE session_id = ?
+		ORDER BY created_at ASC, rowid ASC
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get branches: %w", err)
+	}
+	defer rows.Close()
+
+	children := make(map[string][]string)
+	for rows.Next() {
+		var id, parentID string
+		if err := rows.Scan(&id, &parentID); err != nil {
+			return nil, fmt.Errorf("failed to scan branch: %w", err)
+		}
+		children[parentID] = append(children[parentID], id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	branches := make(map[string]Branch)
+	for _, ids := range children {
+		if len(ids) < 2 {
+			continue
+		}
+		for i, id := range ids {
+			branches[id] = Branch{Index: i + 1, Count: len(ids)}
+		}
+	}
+	return branches, nil
+}
+
+// GetSiblings returns every version of a message, including the message
+// itself, oldest first
+func (s *Store) GetSiblings(messageID string) ([]*Message, error) {
+	rows, err := s.db.Query(`
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE (session_id, parent_id) = (SELECT session_id, parent_id FROM messages WHERE id = ?)
+		ORDER BY created_at ASC, rowid ASC
+	`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get siblings: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanMessages(rows)
+}
+
+// SetActiveLeaf moves the end of a session's active branch to a message, so
+// the messages added next follow it as a new branch. An empty messageID
+// starts a new branch from the beginning of the session.
+func (s *Store) SetActiveLeaf(sessionID, messageID string) error {
+	if messageID != "" {
+		var owner string
+		err := s.db.QueryRow("SELECT session_id FROM messages WHERE id = ?", messageID).Scan(&owner)
+		if err == sql.ErrNoRows || (err == nil && owner != sessionID) {
+			return fmt.Errorf("message %s is not in session %s", messageID, sessionID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get message: %w", err)
+		}
+	}
+
+	_, err := s.db.Exec("UPDATE sessions SET active_leaf_id = ? WHERE id = ?", messageID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to set active branch: %w", err)
+	}
+	return nil
+}
+
+// SwitchBranch makes the branch through a message active, following the
+// most recent reply at each step below it
+func (s *Store) SwitchBranch(sessionID, messageID string) error {
+	leaf := messageID
+	for {
+		var child string
+		err := s.db.QueryRow(`
+			SELECT id FROM messages WHERE session_id = ? AND parent_id = ?
+			ORDER BY created_at DESC, rowid DESC LIMIT 1
+		`, sessionID, leaf).Scan(&child)
+		if err == sql.ErrNoRows {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to follow branch: %w", err)
+		}
+		leaf = child
+	}
+	return s.SetActiveLeaf(sessionID, leaf)
+}
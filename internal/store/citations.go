@@ -0,0 +1,101 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Citation is a source that an assistant reply is grounded in
+type Citation struct {
+	Title string `json:"title,omitempty"`
+	URI   string `json:"uri"`
+	// Spans are the parts of the reply the source supports
+	Spans []CitationSpan `json:"spans,omitempty"`
+}
+
+// CitationSpan is a part of a reply, as a byte range of its content
+type CitationSpan struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text,omitempty"`
+}
+
+// Label returns the citation's title, or its URI when it has none
+func (c Citation) Label() string {
+	if c.Title != "" {
+		return c.Title
+	}
+	return c.URI
+}
+
+// AnnotateCitations inserts a footnote marker after each cited span of
+// content. marker formats the marker for the n-th citation, counting from 1.
+// Spans that don't match content are skipped.
+func AnnotateCitations(content string, citations []Citation, marker func(n int, c Citation) string) string {
+	// Collect the citations ending at each offset
+	ends := make(map[int][]int)
+	for i, c := range citations {
+		for _, span := range c.Spans {
+			if span.Start < 0 || span.End > len(content) || span.Start >= span.End {
+				continue
+			}
+			if !containsInt(ends[span.End], i) {
+				ends[span.End] = append(ends[span.End], i)
+			}
+		}
+	}
+	if len(ends) == 0 {
+		return content
+	}
+
+	offsets := make([]int, 0, len(ends))
+	for end := range ends {
+		offsets = append(offsets, end)
+	}
+	sort.Ints(offsets)
+
+	var sb strings.Builder
+	prev := 0
+	for _, end := range offsets {
+		sb.WriteString(content[prev:end])
+		indices := ends[end]
+		sort.Ints(indices)
+		for _, i := range indices {
+			sb.WriteString(marker(i+1, citations[i]))
+		}
+		prev = end
+	}
+	sb.WriteString(content[prev:])
+	return sb.String()
+}
+
+// encodeCitations returns citations as stored in the messages table
+func encodeCitations(citations []Citation) string {
+	if len(citations) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(citations)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// decodeCitations parses stored citations, ignoring unreadable values
+func decodeCitations(s string) []Citation {
+	var citations []Citation
+	if s != "" {
+		_ = json.Unmarshal([]byte(s), &citations)
+	}
+	return citations
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
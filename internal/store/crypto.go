@@ -0,0 +1,395 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+var (
+	// ErrLocked is returned when an encrypted database is read or written
+	// before Unlock
+	ErrLocked = errors.New("database is encrypted and locked")
+
+	// ErrWrongPassphrase is returned by Unlock for a passphrase that does not
+	// match the one the database was encrypted with
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+)
+
+// Argon2id parameters for deriving the database key from a passphrase. They
+// are stored with the database, so they can be raised later without
+// breaking existing databases.
+const (
+	kdfTime    = 3
+	kdfMemory  = 64 * 1024 // KiB
+	kdfThreads = 4
+	kdfSaltLen = 16
+	keyLen     = 32 // AES-256
+)
+
+// encryptedPrefix marks an encrypted value. Text values are stored as the
+// prefix followed by the base64 nonce and ciphertext, binary values as the
+// prefix followed by the raw nonce and ciphertext.
+const encryptedPrefix = "enc1:"
+
+// keyCheck is stored encrypted to tell whether a passphrase is right
+const keyCheck = "openchat"
+
+// keyCheckAAD binds the stored key check to its cell, like cellAAD
+var keyCheckAAD = cellAAD("encryption", "key_check", "1")
+
+// encryptedColumns lists the columns that hold conversation content. They
+// are encrypted in an encrypted database; everything else is kept in
+// plaintext: session names, tags and folders, attachment filenames and file
+// paths, models, token counts and costs. Each value is sealed with its table,
+// column and row id as additional data (see cellAAD), so a value copied into
+// another cell or row fails to decrypt.
+var encryptedColumns = []struct {
+	table, column string
+	binary        bool
+}{
+	{"sessions", "system_prompt", false},
+	{"sessions", "json_schema", false},
+	{"messages", "content", false},
+	{"messages", "reasoning", false},
+	{"messages", "tool_arguments", false},
+	{"messages", "citations", false},
+	{"attachments", "content", false},
+	{"attachments", "data", true},
+	{"summaries", "summary_content", false},
+}
+
+// encryptedFTSSchema takes conversation content out of the full-text index
+// when a database is encrypted: messages_fts is dropped, and sessions_fts is
+// rebuilt without system prompts. The tables are dropped rather than cleared
+// so the old index pages are freed and removed by VACUUM.
+var encryptedFTSSchema = []string{
+	`DROP TRIGGER IF EXISTS messages_fts_insert`,
+	`DROP TRIGGER IF EXISTS messages_fts_update`,
+	`DROP TRIGGER IF EXISTS messages_fts_delete`,
+	`DROP TABLE IF EXISTS messages_fts`,
+	`DROP TRIGGER IF EXISTS sessions_fts_insert`,
+	`DROP TRIGGER IF EXISTS sessions_fts_update`,
+	`DROP TABLE IF EXISTS sessions_fts`,
+	`CREATE VIRTUAL TABLE sessions_fts USING fts5(
+		session_id UNINDEXED,
+		name,
+		system_prompt,
+		tags
+	)`,
+	`INSERT INTO sessions_fts(session_id, name, system_prompt, tags)
+		SELECT id, name, '', COALESCE((SELECT group_concat(tag, ' ') FROM session_tags WHERE session_id = sessions.id), '')
+		FROM sessions`,
+	`CREATE TRIGGER sessions_fts_insert AFTER INSERT ON sessions BEGIN
+		INSERT INTO sessions_fts(session_id, name, system_prompt, tags) VALUES (NEW.id, NEW.name, '', '');
+	END`,
+	`CREATE TRIGGER sessions_fts_update AFTER UPDATE OF name ON sessions BEGIN
+		UPDATE sessions_fts SET name = NEW.name WHERE session_id = NEW.id;
+	END`,
+}
+
+// IsEncrypted returns whether the database is encrypted
+func (s *Store) IsEncrypted() bool {
+	return s.encrypted
+}
+
+// IsLocked returns whether the database is encrypted and not yet unlocked
+func (s *Store) IsLocked() bool {
+	return s.encrypted && s.aead == nil
+}
+
+// loadEncryption records whether the database has been encrypted
+func (s *Store) loadEncryption() error {
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM encryption").Scan(&n); err != nil {
+		return fmt.Errorf("failed to check encryption: %w", err)
+	}
+	s.encrypted = n > 0
+	return nil
+}
+
+// Unlock derives the key of an encrypted database from its passphrase. It
+// is called once after New, before anything is read or written.
+func (s *Store) Unlock(passphrase string) error {
+	var salt []byte
+	var iterations, memory uint32
+	var threads uint8
+	var check string
+	err := s.db.QueryRow(`
+		SELECT salt, kdf_time, kdf_memory, kdf_threads, key_check FROM encryption WHERE id = 1
+	`).Scan(&salt, &iterations, &memory, &threads, &check)
+	if err == sql.ErrNoRows {
+		return errors.New("database is not encrypted")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read encryption settings: %w", err)
+	}
+
+	aead, err := newAEAD(argon2.IDKey([]byte(passphrase), salt, iterations, memory, threads, keyLen))
+	if err != nil {
+		return err
+	}
+	if plain, err := openText(aead, check, keyCheckAAD); err != nil || plain != keyCheck {
+		return ErrWrongPassphrase
+	}
+	s.aead = aead
+	return nil
+}
+
+// Encrypt encrypts the conversation content already in the database with a
+// key derived from passphrase, and everything written afterwards. Full-text
+// search stops indexing message content and system prompts; FullTextSearch
+// decrypts messages to search them instead. The database file is vacuumed
+// afterwards so no plaintext is left in freed pages.
+func (s *Store) Encrypt(passphrase string) error {
+	if s.encrypted {
+		return errors.New("database is already encrypted")
+	}
+	if passphrase == "" {
+		return errors.New("passphrase is empty")
+	}
+
+	salt := make([]byte, kdfSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	aead, err := newAEAD(argon2.IDKey([]byte(passphrase), salt, kdfTime, kdfMemory, kdfThreads, keyLen))
+	if err != nil {
+		return err
+	}
+	check, err := sealText(aead, keyCheck, keyCheckAAD)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	// Stop indexing content first, so encrypting it does not reindex it
+	if s.hasFTS5 {
+		for _, stmt := range encryptedFTSSchema {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to update search index: %w", err)
+			}
+		}
+	}
+
+	for _, c := range encryptedColumns {
+		if err := encryptColumn(tx, aead, c.table, c.column, c.binary); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO encryption (id, salt, kdf_time, kdf_memory, kdf_threads, key_check)
+		VALUES (1, ?, ?, ?, ?, ?)
+	`, salt, kdfTime, kdfMemory, kdfThreads, check)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to save encryption settings: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.encrypted = true
+	s.aead = aead
+
+	// Rewrite the file without the pages that held plaintext
+	if _, err := s.db.Exec("VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	if _, err := s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return nil
+}
+
+// encryptColumn encrypts every value in a column in place
+func encryptColumn(tx *sql.Tx, aead cipher.AEAD, table, column string, binary bool) error {
+	rows, err := tx.Query(fmt.Sprintf("SELECT id, %s FROM %s", column, table))
+	if err != nil {
+		return fmt.Errorf("failed to read %s.%s: %w", table, column, err)
+	}
+
+	// Read the whole column before writing, as the transaction has one
+	// connection
+	type value struct {
+		id   string
+		data []byte
+	}
+	var values []value
+	for rows.Next() {
+		var v value
+		if err := rows.Scan(&v.id, &v.data); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read %s.%s: %w", table, column, err)
+		}
+		values = append(values, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s.%s: %w", table, column, err)
+	}
+
+	stmt := fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", table, column)
+	for _, v := range values {
+		ad := cellAAD(table, column, v.id)
+		var sealed interface{}
+		if binary {
+			if sealed, err = sealBytes(aead, v.data, ad); err != nil {
+				return err
+			}
+		} else {
+			if sealed, err = sealText(aead, string(v.data), ad); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(stmt, sealed, v.id); err != nil {
+			return fmt.Errorf("failed to encrypt %s.%s: %w", table, column, err)
+		}
+	}
+	return nil
+}
+
+// cellAAD returns the additional data an encrypted value is sealed with: its
+// table, column and row id
+func cellAAD(table, column, id string) []byte {
+	return []byte(table + "|" + column + "|" + id)
+}
+
+// encrypt encrypts a text value for storage in the cell identified by ad
+// (see cellAAD). It returns the value as is when the database is not
+// encrypted.
+func (s *Store) encrypt(plain string, ad []byte) (string, error) {
+	if !s.encrypted {
+		return plain, nil
+	}
+	if s.aead == nil {
+		return "", ErrLocked
+	}
+	return sealText(s.aead, plain, ad)
+}
+
+// decrypt decrypts a text value stored in the cell identified by ad
+func (s *Store) decrypt(stored string, ad []byte) (string, error) {
+	if !s.encrypted {
+		return stored, nil
+	}
+	if s.aead == nil {
+		return "", ErrLocked
+	}
+	return openText(s.aead, stored, ad)
+}
+
+// encryptBytes encrypts a binary value for storage in the cell identified
+// by ad
+func (s *Store) encryptBytes(plain, ad []byte) ([]byte, error) {
+	if !s.encrypted {
+		return plain, nil
+	}
+	if s.aead == nil {
+		return nil, ErrLocked
+	}
+	return sealBytes(s.aead, plain, ad)
+}
+
+// decryptBytes decrypts a binary value stored in the cell identified by ad
+func (s *Store) decryptBytes(stored, ad []byte) ([]byte, error) {
+	if !s.encrypted {
+		return stored, nil
+	}
+	if s.aead == nil {
+		return nil, ErrLocked
+	}
+	return openBytes(s.aead, stored, ad)
+}
+
+// newAEAD returns AES-GCM with the given key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// sealBytes encrypts a value with a random nonce, authenticating ad along
+// with it. Empty values are left empty.
+func sealBytes(aead cipher.AEAD, plain, ad []byte) ([]byte, error) {
+	if len(plain) == 0 {
+		return plain, nil
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return append([]byte(encryptedPrefix), aead.Seal(nonce, nonce, plain, ad)...), nil
+}
+
+// openBytes decrypts a value sealed with sealBytes and the same ad
+func openBytes(aead cipher.AEAD, sealed, ad []byte) ([]byte, error) {
+	if len(sealed) == 0 {
+		return sealed, nil
+	}
+	if !bytes.HasPrefix(sealed, []byte(encryptedPrefix)) {
+		return nil, errors.New("value is not encrypted")
+	}
+	sealed = sealed[len(encryptedPrefix):]
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted value is truncated")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], ad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return plain, nil
+}
+
+// sealText encrypts a text value, encoding the nonce and ciphertext as
+// base64 so it stays valid text
+func sealText(aead cipher.AEAD, plain string, ad []byte) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	sealed, err := sealBytes(aead, []byte(plain), ad)
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed[len(encryptedPrefix):]), nil
+}
+
+// openText decrypts a value sealed with sealText
+func openText(aead cipher.AEAD, sealed string, ad []byte) (string, error) {
+	if sealed == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(sealed, encryptedPrefix) {
+		return "", errors.New("value is not encrypted")
+	}
+	raw, err := base64.StdEncoding.DecodeString(sealed[len(encryptedPrefix):])
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted value: %w", err)
+	}
+	plain, err := openBytes(aead, append([]byte(encryptedPrefix), raw...), ad)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
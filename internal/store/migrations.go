@@ -118,6 +118,166 @@ var migrations = []string{
 
 	// Migration 16: Create index for summaries
 	`CREATE INDEX IF NOT EXISTS idx_summaries_session_id ON summaries(session_id)`,
+
+	// Migration 17: Add tool call details to messages with the tool role
+	`ALTER TABLE messages ADD COLUMN tool_call_id TEXT DEFAULT ''`,
+	`ALTER TABLE messages ADD COLUMN tool_name TEXT DEFAULT ''`,
+	`ALTER TABLE messages ADD COLUMN tool_arguments TEXT DEFAULT ''`,
+
+	// Migration 18: Store binary attachments such as images
+	`ALTER TABLE attachments ADD COLUMN data BLOB`,
+
+	// Migration 19: Record provider, model, usage and timing of assistant replies
+	`ALTER TABLE messages ADD COLUMN provider TEXT DEFAULT ''`,
+	`ALTER TABLE messages ADD COLUMN model TEXT DEFAULT ''`,
+	`ALTER TABLE messages ADD COLUMN prompt_tokens INTEGER DEFAULT 0`,
+	`ALTER TABLE messages ADD COLUMN completion_tokens INTEGER DEFAULT 0`,
+	`ALTER TABLE messages ADD COLUMN thinking_tokens INTEGER DEFAULT 0`,
+	`ALTER TABLE messages ADD COLUMN finish_reason TEXT DEFAULT ''`,
+	`ALTER TABLE messages ADD COLUMN latency_ms INTEGER DEFAULT 0`,
+	`ALTER TABLE messages ADD COLUMN ttft_ms INTEGER DEFAULT 0`,
+
+	// Migration 20: Record the cost of assistant replies, indexed for the
+	// per-provider budget totals
+	`ALTER TABLE messages ADD COLUMN cost REAL DEFAULT 0`,
+	`CREATE INDEX IF NOT EXISTS idx_messages_provider_created_at ON messages(provider, created_at)`,
+
+	// Migration 21: Store per-session generation parameters as JSON
+	`ALTER TABLE sessions ADD COLUMN params TEXT DEFAULT ''`,
+
+	// Migration 22: Store the session's JSON Schema for structured replies
+	`ALTER TABLE sessions ADD COLUMN json_schema TEXT DEFAULT ''`,
+
+	// Migration 23: Record prompt cache usage of assistant replies
+	`ALTER TABLE messages ADD COLUMN cache_read_tokens INTEGER DEFAULT 0`,
+	`ALTER TABLE messages ADD COLUMN cache_write_tokens INTEGER DEFAULT 0`,
+
+	// Migration 24: Keep the model's reasoning apart from the reply
+	`ALTER TABLE messages ADD COLUMN reasoning TEXT DEFAULT ''`,
+
+	// Migration 25: Store the sources a reply is grounded in as JSON
+	`ALTER TABLE messages ADD COLUMN citations TEXT DEFAULT ''`,
+
+	// Migration 26: Link messages into a tree so edits and regenerations
+	// become sibling branches, and point each session at its active branch.
+	// Existing sessions become a single branch in created_at order.
+	`ALTER TABLE messages ADD COLUMN parent_id TEXT DEFAULT ''`,
+	`ALTER TABLE sessions ADD COLUMN active_leaf_id TEXT DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS idx_messages_parent_id ON messages(session_id, parent_id)`,
+	`UPDATE messages SET parent_id = COALESCE((
+		SELECT p.id FROM messages p
+		WHERE p.session_id = messages.session_id
+			AND (p.created_at < messages.created_at OR (p.created_at = messages.created_at AND p.rowid < messages.rowid))
+		ORDER BY p.created_at DESC, p.rowid DESC LIMIT 1
+	), '')`,
+	`UPDATE sessions SET active_leaf_id = COALESCE((
+		SELECT id FROM messages WHERE session_id = sessions.id
+		ORDER BY created_at DESC, rowid DESC LIMIT 1
+	), '')`,
+
+	// Migration 27: Move deleted sessions to a trash instead of removing them
+	`ALTER TABLE sessions ADD COLUMN deleted_at DATETIME`,
+	`CREATE INDEX IF NOT EXISTS idx_sessions_deleted_at ON sessions(deleted_at)`,
+
+	// Migration 28: Organize sessions with tags, an optional folder and pins
+	`CREATE TABLE IF NOT EXISTS folders (
+		name TEXT PRIMARY KEY,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS session_tags (
+		session_id TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (session_id, tag),
+		FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_session_tags_tag ON session_tags(tag)`,
+	`ALTER TABLE sessions ADD COLUMN folder TEXT REFERENCES folders(name) ON UPDATE CASCADE ON DELETE SET NULL`,
+	`ALTER TABLE sessions ADD COLUMN pinned INTEGER DEFAULT 0`,
+
+	// Migration 29: Index session tags for full-text search. sessions_fts
+	// keeps its own copy of the text instead of reading it from sessions, so
+	// it can hold the tags as well.
+	`DROP TRIGGER IF EXISTS sessions_fts_insert`,
+	`DROP TRIGGER IF EXISTS sessions_fts_update`,
+	`DROP TRIGGER IF EXISTS sessions_fts_delete`,
+	`DROP TABLE IF EXISTS sessions_fts`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS sessions_fts USING fts5(
+		session_id UNINDEXED,
+		name,
+		system_prompt,
+		tags
+	)`,
+	`INSERT INTO sessions_fts(session_id, name, system_prompt, tags)
+		SELECT id, name, system_prompt, COALESCE((SELECT group_concat(tag, ' ') FROM session_tags WHERE session_id = sessions.id), '') FROM sessions`,
+	`CREATE TRIGGER IF NOT EXISTS sessions_fts_insert AFTER INSERT ON sessions BEGIN
+		INSERT INTO sessions_fts(session_id, name, system_prompt, tags) VALUES (NEW.id, NEW.name, NEW.system_prompt, '');
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS sessions_fts_update AFTER UPDATE OF name, system_prompt ON sessions BEGIN
+		UPDATE sessions_fts SET name = NEW.name, system_prompt = NEW.system_prompt WHERE session_id = NEW.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS sessions_fts_delete AFTER DELETE ON sessions BEGIN
+		DELETE FROM sessions_fts WHERE session_id = OLD.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS sessions_fts_tag_insert AFTER INSERT ON session_tags BEGIN
+		UPDATE sessions_fts SET tags = COALESCE((SELECT group_concat(tag, ' ') FROM session_tags WHERE session_id = NEW.session_id), '')
+		WHERE session_id = NEW.session_id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS sessions_fts_tag_delete AFTER DELETE ON session_tags BEGIN
+		UPDATE sessions_fts SET tags = COALESCE((SELECT group_concat(tag, ' ') FROM session_tags WHERE session_id = OLD.session_id), '')
+		WHERE session_id = OLD.session_id;
+	END`,
+
+	// Migration 30: Give messages_fts its own copy of the text, as
+	// sessions_fts has, instead of reading it from messages
+	`DROP TRIGGER IF EXISTS messages_fts_insert`,
+	`DROP TRIGGER IF EXISTS messages_fts_update`,
+	`DROP TRIGGER IF EXISTS messages_fts_delete`,
+	`DROP TABLE IF EXISTS messages_fts`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+		message_id UNINDEXED,
+		session_id UNINDEXED,
+		content
+	)`,
+	`INSERT INTO messages_fts(message_id, session_id, content) SELECT id, session_id, content FROM messages`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts(message_id, session_id, content) VALUES (NEW.id, NEW.session_id, NEW.content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+		UPDATE messages_fts SET content = NEW.content WHERE message_id = NEW.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+		DELETE FROM messages_fts WHERE message_id = OLD.id;
+	END`,
+
+	// Migration 31: Record how the key of an encrypted database is derived
+	// from its passphrase. The table stays empty until the database is
+	// encrypted with "chatui db encrypt".
+	`CREATE TABLE IF NOT EXISTS encryption (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		salt BLOB NOT NULL,
+		kdf_time INTEGER NOT NULL,
+		kdf_memory INTEGER NOT NULL,
+		kdf_threads INTEGER NOT NULL,
+		key_check TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+
+	// Migration 32: Record the cost of every billed request in a table of its
+	// own, so spending totals and budgets survive /clear, deleted messages
+	// and purged sessions. The costs of existing replies are copied over.
+	`CREATE TABLE IF NOT EXISTS usage_costs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		provider TEXT NOT NULL,
+		model TEXT NOT NULL DEFAULT '',
+		session_id TEXT NOT NULL DEFAULT '',
+		cost REAL NOT NULL,
+		created_at DATETIME NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_usage_costs_provider_created_at ON usage_costs(provider, created_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_usage_costs_created_at ON usage_costs(created_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_usage_costs_session ON usage_costs(session_id)`,
+	`INSERT INTO usage_costs (provider, model, session_id, cost, created_at)
+		SELECT provider, model, session_id, cost, created_at FROM messages WHERE cost > 0`,
 }
 
 // getSchemaVersion returns the current schema version
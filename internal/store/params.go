@@ -0,0 +1,250 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Generation parameter names, as used by /set
+const (
+	ParamTemperature      = "temperature"
+	ParamTopP             = "top_p"
+	ParamMaxTokens        = "max_tokens"
+	ParamStop             = "stop"
+	ParamSeed             = "seed"
+	ParamFrequencyPenalty = "frequency_penalty"
+	ParamReasoning        = "reasoning"
+)
+
+// ParamNames lists the generation parameters in display order
+var ParamNames = []string{
+	ParamTemperature,
+	ParamTopP,
+	ParamMaxTokens,
+	ParamStop,
+	ParamSeed,
+	ParamFrequencyPenalty,
+	ParamReasoning,
+}
+
+// ReasoningEfforts lists the reasoning effort levels accepted by /set, from
+// least to most thinking
+var ReasoningEfforts = []string{"low", "medium", "high"}
+
+// MinReasoningBudget is the smallest reasoning token budget accepted
+const MinReasoningBudget = 1024
+
+// GenerationParams are a session's sampling settings. Unset (nil or zero)
+// parameters are left to the provider's default.
+type GenerationParams struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	MaxTokens        int      `json:"max_tokens,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int64   `json:"seed,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+	// Reasoning is an effort level or a thinking token budget
+	Reasoning string `json:"reasoning,omitempty"`
+}
+
+// IsZero reports whether no parameter is set
+func (p GenerationParams) IsZero() bool {
+	return p.Temperature == nil && p.TopP == nil && p.MaxTokens == 0 &&
+		len(p.Stop) == 0 && p.Seed == nil && p.FrequencyPenalty == nil &&
+		p.Reasoning == ""
+}
+
+// Set parses value and sets the named parameter. "default" unsets it. Stop
+// sequences are separated by commas, and reasoning is an effort level or a
+// token budget.
+func (p *GenerationParams) Set(name, value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fmt.Errorf("missing value for %s", name)
+	}
+	if value == "default" {
+		return p.Unset(name)
+	}
+
+	switch name {
+	case ParamTemperature:
+		v, err := parseFloatParam(name, value, 0, 2)
+		if err != nil {
+			return err
+		}
+		p.Temperature = &v
+	case ParamTopP:
+		v, err := parseFloatParam(name, value, 0, 1)
+		if err != nil {
+			return err
+		}
+		p.TopP = &v
+	case ParamMaxTokens:
+		v, err := strconv.Atoi(value)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("%s must be a positive whole number", name)
+		}
+		p.MaxTokens = v
+	case ParamStop:
+		var stop []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				stop = append(stop, s)
+			}
+		}
+		p.Stop = stop
+	case ParamSeed:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be a whole number", name)
+		}
+		p.Seed = &v
+	case ParamFrequencyPenalty:
+		v, err := parseFloatParam(name, value, -2, 2)
+		if err != nil {
+			return err
+		}
+		p.FrequencyPenalty = &v
+	case ParamReasoning:
+		value = strings.ToLower(value)
+		if !isReasoningEffort(value) {
+			v, err := strconv.Atoi(value)
+			if err != nil || v < MinReasoningBudget {
+				return fmt.Errorf("%s must be %s or a token budget of at least %d",
+					name, strings.Join(ReasoningEfforts, ", "), MinReasoningBudget)
+			}
+			value = strconv.Itoa(v)
+		}
+		p.Reasoning = value
+	default:
+		return fmt.Errorf("unknown parameter: %s", name)
+	}
+	return nil
+}
+
+// Unset returns the named parameter to the provider's default
+func (p *GenerationParams) Unset(name string) error {
+	switch name {
+	case ParamTemperature:
+		p.Temperature = nil
+	case ParamTopP:
+		p.TopP = nil
+	case ParamMaxTokens:
+		p.MaxTokens = 0
+	case ParamStop:
+		p.Stop = nil
+	case ParamSeed:
+		p.Seed = nil
+	case ParamFrequencyPenalty:
+		p.FrequencyPenalty = nil
+	case ParamReasoning:
+		p.Reasoning = ""
+	default:
+		return fmt.Errorf("unknown parameter: %s", name)
+	}
+	return nil
+}
+
+// Get formats the named parameter, or returns "" when it is unset
+func (p GenerationParams) Get(name string) string {
+	switch name {
+	case ParamTemperature:
+		return formatFloatParam(p.Temperature)
+	case ParamTopP:
+		return formatFloatParam(p.TopP)
+	case ParamMaxTokens:
+		if p.MaxTokens > 0 {
+			return strconv.Itoa(p.MaxTokens)
+		}
+	case ParamStop:
+		return strings.Join(p.Stop, ", ")
+	case ParamSeed:
+		if p.Seed != nil {
+			return strconv.FormatInt(*p.Seed, 10)
+		}
+	case ParamFrequencyPenalty:
+		return formatFloatParam(p.FrequencyPenalty)
+	case ParamReasoning:
+		return p.Reasoning
+	}
+	return ""
+}
+
+// ReasoningEffort returns the reasoning effort level, or "" when reasoning is
+// unset or given as a budget
+func (p GenerationParams) ReasoningEffort() string {
+	if isReasoningEffort(p.Reasoning) {
+		return p.Reasoning
+	}
+	return ""
+}
+
+// isReasoningEffort reports whether value is one of ReasoningEfforts
+func isReasoningEffort(value string) bool {
+	for _, effort := range ReasoningEfforts {
+		if value == effort {
+			return true
+		}
+	}
+	return false
+}
+
+// ReasoningBudget returns the reasoning token budget, or 0 when reasoning is
+// unset or given as an effort level
+func (p GenerationParams) ReasoningBudget() int {
+	v, err := strconv.Atoi(p.Reasoning)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// String formats the set parameters, e.g. "temperature=0.2 seed=7"
+func (p GenerationParams) String() string {
+	var parts []string
+	for _, name := range ParamNames {
+		if v := p.Get(name); v != "" {
+			parts = append(parts, name+"="+v)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// encode returns the parameters as stored in the sessions table
+func (p GenerationParams) encode() string {
+	if p.IsZero() {
+		return ""
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// decodeParams parses stored parameters. Unreadable values are treated as
+// unset rather than failing to load the session.
+func decodeParams(s string) GenerationParams {
+	var p GenerationParams
+	if s != "" {
+		_ = json.Unmarshal([]byte(s), &p)
+	}
+	return p
+}
+
+func parseFloatParam(name, value string, min, max float64) (float64, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("%s must be a number from %g to %g", name, min, max)
+	}
+	return v, nil
+}
+
+func formatFloatParam(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'g', -1, 64)
+}
@@ -1,8 +1,10 @@
 package store
 
 import (
+	"crypto/cipher"
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -28,8 +30,14 @@ type Session struct {
 	Provider     string
 	Model        string
 	SystemPrompt string
+	Params       GenerationParams
+	JSONSchema   string // JSON Schema replies must match; empty when off
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
+	DeletedAt    time.Time // When the session was moved to the trash; zero if it wasn't
+	Folder       string    // Folder the session is filed in; empty if none
+	Pinned       bool      // Pinned sessions are listed first
+	Tags         []string  // Sorted tags
 }
 
 // Message represents a single message in a session
@@ -39,6 +47,95 @@ type Message struct {
 	Role      Role
 	Content   string
 	CreatedAt time.Time
+
+	// ParentID is the message this one follows, empty for the first
+	// message. Edited prompts and regenerated replies share the parent of
+	// the version they replace.
+	ParentID string
+
+	// Tool call details, set on messages with the tool role. Content holds
+	// the tool's result.
+	ToolCallID    string
+	ToolName      string
+	ToolArguments string
+
+	// Reasoning is the model's thinking before an assistant reply. It is
+	// shown apart from Content and never sent back to the model.
+	Reasoning string
+
+	// Citations are the sources an assistant reply is grounded in
+	Citations []Citation
+
+	// Meta describes how an assistant reply was generated
+	Meta ResponseMeta
+}
+
+// ResponseMeta records the provider, model, usage and timing of an
+// assistant reply
+type ResponseMeta struct {
+	Provider         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	// ThinkingTokens is the part of CompletionTokens spent on reasoning
+	ThinkingTokens int
+	// CacheReadTokens and CacheWriteTokens are the parts of PromptTokens
+	// read from and written to the provider's prompt cache
+	CacheReadTokens  int
+	CacheWriteTokens int
+	FinishReason     string
+	// Latency is the time from sending the request to the last token
+	Latency time.Duration
+	// TimeToFirstToken is the time from sending the request to the first
+	// streamed token
+	TimeToFirstToken time.Duration
+	// Cost is the price of the request in US dollars, 0 if unknown
+	Cost float64
+}
+
+// IsZero reports whether no metadata was recorded, e.g. for messages saved
+// before it was tracked
+func (m ResponseMeta) IsZero() bool {
+	return m == ResponseMeta{}
+}
+
+// String formats the metadata on one line, e.g.
+// "openai/gpt-4o · 120 in (100 cached), 45 out (10 thinking) · $0.0008 · stop · 1.5s, first token 0.3s"
+func (m ResponseMeta) String() string {
+	var parts []string
+	switch {
+	case m.Provider != "" && m.Model != "":
+		parts = append(parts, m.Provider+"/"+m.Model)
+	case m.Model != "":
+		parts = append(parts, m.Model)
+	case m.Provider != "":
+		parts = append(parts, m.Provider)
+	}
+	if m.PromptTokens > 0 || m.CompletionTokens > 0 {
+		tokens := fmt.Sprintf("%d in", m.PromptTokens)
+		if m.CacheReadTokens > 0 {
+			tokens += fmt.Sprintf(" (%d cached)", m.CacheReadTokens)
+		}
+		tokens += fmt.Sprintf(", %d out", m.CompletionTokens)
+		if m.ThinkingTokens > 0 {
+			tokens += fmt.Sprintf(" (%d thinking)", m.ThinkingTokens)
+		}
+		parts = append(parts, tokens)
+	}
+	if m.Cost > 0 {
+		parts = append(parts, FormatCost(m.Cost))
+	}
+	if m.FinishReason != "" {
+		parts = append(parts, m.FinishReason)
+	}
+	if m.Latency > 0 {
+		timing := fmt.Sprintf("%.1fs", m.Latency.Seconds())
+		if m.TimeToFirstToken > 0 {
+			timing += fmt.Sprintf(", first token %.1fs", m.TimeToFirstToken.Seconds())
+		}
+		parts = append(parts, timing)
+	}
+	return strings.Join(parts, " · ")
 }
 
 // Attachment represents a file attached to a session context vault
@@ -52,6 +149,15 @@ type Attachment struct {
 	MimeType          string
 	IncludedInContext bool
 	CreatedAt         time.Time
+
+	// Data holds the raw bytes of binary attachments (images); Content is
+	// empty for these
+	Data []byte
+}
+
+// IsBinary returns true if the attachment holds binary data rather than text
+func (a *Attachment) IsBinary() bool {
+	return len(a.Data) > 0
 }
 
 // Summary represents a summarized portion of conversation history
@@ -80,8 +186,10 @@ type SearchResult struct {
 
 // Store provides database operations for sessions and messages
 type Store struct {
-	db          *sql.DB
-	hasFTS5     bool // Whether FTS5 is available
+	db        *sql.DB
+	hasFTS5   bool        // Whether FTS5 is available
+	encrypted bool        // Whether conversation content is encrypted
+	aead      cipher.AEAD // Key of an encrypted database, set by Unlock
 }
 
 // New creates a new Store instance and initializes the database
@@ -104,6 +212,11 @@ func New(dbPath string) (*Store, error) {
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	if err := store.loadEncryption(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return store, nil
 }
 
@@ -136,9 +249,9 @@ func (s *Store) runMigrations() error {
 			continue
 		}
 
-		// Skip FTS5 migrations if FTS5 is not available (versions 7-14)
+		// Skip FTS5 migrations if FTS5 is not available
 		// These are: messages_fts, sessions_fts, and their triggers
-		if !s.hasFTS5 && version >= 7 && version <= 14 {
+		if !s.hasFTS5 && strings.Contains(migration, "_fts") {
 			// Record that we skipped this migration
 			if _, err := s.db.Exec(insertSchemaVersionSQL, version); err != nil {
 				return fmt.Errorf("failed to record skipped migration %d: %w", version, err)
@@ -198,10 +311,15 @@ func (s *Store) CreateSession(name, provider, model, systemPrompt string) (*Sess
 		UpdatedAt:    time.Now(),
 	}
 
-	_, err := s.db.Exec(`
+	systemPrompt, err := s.encrypt(session.SystemPrompt, cellAAD("sessions", "system_prompt", session.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	_, err = s.db.Exec(`
 		INSERT INTO sessions (id, name, provider, model, system_prompt, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, session.ID, session.Name, session.Provider, session.Model, session.SystemPrompt,
+	`, session.ID, session.Name, session.Provider, session.Model, systemPrompt,
 		session.CreatedAt, session.UpdatedAt)
 
 	if err != nil {
@@ -213,12 +331,10 @@ func (s *Store) CreateSession(name, provider, model, systemPrompt string) (*Sess
 
 // GetSession retrieves a session by ID
 func (s *Store) GetSession(id string) (*Session, error) {
-	session := &Session{}
-	err := s.db.QueryRow(`
-		SELECT id, name, provider, model, system_prompt, created_at, updated_at
+	session, err := s.scanSession(s.db.QueryRow(`
+		SELECT `+sessionColumns+`
 		FROM sessions WHERE id = ?
-	`, id).Scan(&session.ID, &session.Name, &session.Provider, &session.Model,
-		&session.SystemPrompt, &session.CreatedAt, &session.UpdatedAt)
+	`, id))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -230,11 +346,12 @@ func (s *Store) GetSession(id string) (*Session, error) {
 	return session, nil
 }
 
-// ListSessions returns all sessions ordered by most recently updated
+// ListSessions returns all sessions outside the trash, pinned sessions first
+// and then by most recently updated
 func (s *Store) ListSessions() ([]*Session, error) {
 	rows, err := s.db.Query(`
-		SELECT id, name, provider, model, system_prompt, created_at, updated_at
-		FROM sessions ORDER BY updated_at DESC
+		SELECT `+sessionColumns+`
+		FROM sessions WHERE deleted_at IS NULL ORDER BY pinned DESC, updated_at DESC
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list sessions: %w", err)
@@ -243,9 +360,7 @@ func (s *Store) ListSessions() ([]*Session, error) {
 
 	var sessions []*Session
 	for rows.Next() {
-		session := &Session{}
-		err := rows.Scan(&session.ID, &session.Name, &session.Provider, &session.Model,
-			&session.SystemPrompt, &session.CreatedAt, &session.UpdatedAt)
+		session, err := s.scanSession(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan session: %w", err)
 		}
@@ -257,12 +372,22 @@ func (s *Store) ListSessions() ([]*Session, error) {
 
 // UpdateSession updates an existing session
 func (s *Store) UpdateSession(session *Session) error {
+	systemPrompt, err := s.encrypt(session.SystemPrompt, cellAAD("sessions", "system_prompt", session.ID))
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	jsonSchema, err := s.encrypt(session.JSONSchema, cellAAD("sessions", "json_schema", session.ID))
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+
 	session.UpdatedAt = time.Now()
-	_, err := s.db.Exec(`
-		UPDATE sessions SET name = ?, provider = ?, model = ?, system_prompt = ?, updated_at = ?
+	_, err = s.db.Exec(`
+		UPDATE sessions SET name = ?, provider = ?, model = ?, system_prompt = ?, params = ?, json_schema = ?,
+			updated_at = ?
 		WHERE id = ?
-	`, session.Name, session.Provider, session.Model, session.SystemPrompt,
-		session.UpdatedAt, session.ID)
+	`, session.Name, session.Provider, session.Model, systemPrompt,
+		session.Params.encode(), jsonSchema, session.UpdatedAt, session.ID)
 
 	if err != nil {
 		return fmt.Errorf("failed to update session: %w", err)
@@ -271,7 +396,41 @@ func (s *Store) UpdateSession(session *Session) error {
 	return nil
 }
 
-// DeleteSession deletes a session and its messages
+// sessionColumns lists the session columns read by scanSession, in order.
+// They are qualified so queries can join sessions with other tables.
+const sessionColumns = `sessions.id, sessions.name, sessions.provider, sessions.model, sessions.system_prompt,
+	sessions.created_at, sessions.updated_at, sessions.params, sessions.json_schema, sessions.deleted_at,
+	COALESCE(sessions.folder, ''), sessions.pinned,
+	COALESCE((SELECT group_concat(tag, ',') FROM session_tags WHERE session_tags.session_id = sessions.id), '')`
+
+// scanSession scans a row selected with sessionColumns
+func (s *Store) scanSession(row rowScanner) (*Session, error) {
+	session := &Session{}
+	var params, tags string
+	var deletedAt sql.NullTime
+	err := row.Scan(&session.ID, &session.Name, &session.Provider, &session.Model,
+		&session.SystemPrompt, &session.CreatedAt, &session.UpdatedAt, &params, &session.JSONSchema, &deletedAt,
+		&session.Folder, &session.Pinned, &tags)
+	if err != nil {
+		return nil, err
+	}
+	if session.SystemPrompt, err = s.decrypt(session.SystemPrompt, cellAAD("sessions", "system_prompt", session.ID)); err != nil {
+		return nil, err
+	}
+	if session.JSONSchema, err = s.decrypt(session.JSONSchema, cellAAD("sessions", "json_schema", session.ID)); err != nil {
+		return nil, err
+	}
+	session.Params = decodeParams(params)
+	session.DeletedAt = deletedAt.Time
+	if tags != "" {
+		session.Tags = strings.Split(tags, ",")
+		sort.Strings(session.Tags)
+	}
+	return session, nil
+}
+
+// DeleteSession permanently deletes a session with its messages,
+// attachments and summaries. Use TrashSession for a recoverable delete.
 func (s *Store) DeleteSession(id string) error {
 	_, err := s.db.Exec("DELETE FROM sessions WHERE id = ?", id)
 	if err != nil {
@@ -280,6 +439,60 @@ func (s *Store) DeleteSession(id string) error {
 	return nil
 }
 
+// messageColumns lists the message columns read by scanMessage, in order
+const messageColumns = `id, session_id, role, content, created_at, tool_call_id, tool_name, tool_arguments,
+	provider, model, prompt_tokens, completion_tokens, thinking_tokens, finish_reason, latency_ms, ttft_ms, cost,
+	cache_read_tokens, cache_write_tokens, reasoning, citations, parent_id`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage scans a row selected with messageColumns
+func (s *Store) scanMessage(row rowScanner) (*Message, error) {
+	msg := &Message{}
+	var latencyMs, ttftMs int64
+	var citations string
+	err := row.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.CreatedAt,
+		&msg.ToolCallID, &msg.ToolName, &msg.ToolArguments,
+		&msg.Meta.Provider, &msg.Meta.Model, &msg.Meta.PromptTokens, &msg.Meta.CompletionTokens,
+		&msg.Meta.ThinkingTokens, &msg.Meta.FinishReason, &latencyMs, &ttftMs, &msg.Meta.Cost,
+		&msg.Meta.CacheReadTokens, &msg.Meta.CacheWriteTokens, &msg.Reasoning, &citations, &msg.ParentID)
+	if err != nil {
+		return msg, err
+	}
+	if msg.Content, err = s.decrypt(msg.Content, cellAAD("messages", "content", msg.ID)); err != nil {
+		return msg, err
+	}
+	if msg.Reasoning, err = s.decrypt(msg.Reasoning, cellAAD("messages", "reasoning", msg.ID)); err != nil {
+		return msg, err
+	}
+	if msg.ToolArguments, err = s.decrypt(msg.ToolArguments, cellAAD("messages", "tool_arguments", msg.ID)); err != nil {
+		return msg, err
+	}
+	if citations, err = s.decrypt(citations, cellAAD("messages", "citations", msg.ID)); err != nil {
+		return msg, err
+	}
+	msg.Citations = decodeCitations(citations)
+	msg.Meta.Latency = time.Duration(latencyMs) * time.Millisecond
+	msg.Meta.TimeToFirstToken = time.Duration(ttftMs) * time.Millisecond
+	return msg, nil
+}
+
+// scanMessages scans all rows selected with messageColumns
+func (s *Store) scanMessages(rows *sql.Rows) ([]*Message, error) {
+	var messages []*Message
+	for rows.Next() {
+		msg, err := s.scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
 // AddMessage adds a message to a session
 func (s *Store) AddMessage(sessionID string, role Role, content string) (*Message, error) {
 	msg := &Message{
@@ -290,84 +503,146 @@ func (s *Store) AddMessage(sessionID string, role Role, content string) (*Messag
 		CreatedAt: time.Now(),
 	}
 
+	if err := s.insertMessage(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// AddToolMessage records a tool call made by the model together with its result
+func (s *Store) AddToolMessage(sessionID, callID, toolName, arguments, result string) (*Message, error) {
+	msg := &Message{
+		ID:            uuid.New().String(),
+		SessionID:     sessionID,
+		Role:          RoleTool,
+		Content:       result,
+		CreatedAt:     time.Now(),
+		ToolCallID:    callID,
+		ToolName:      toolName,
+		ToolArguments: arguments,
+	}
+
+	if err := s.insertMessage(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// AddAssistantMessage adds an assistant reply together with the model's
+// reasoning and citations, if any, and the metadata of the response that
+// produced it
+func (s *Store) AddAssistantMessage(sessionID, content, reasoning string, citations []Citation, meta ResponseMeta) (*Message, error) {
+	msg := &Message{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Role:      RoleAssistant,
+		Content:   content,
+		CreatedAt: time.Now(),
+		Reasoning: reasoning,
+		Citations: citations,
+		Meta:      meta,
+	}
+
+	if err := s.insertMessage(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// insertMessage stores a message at the end of the session's active branch,
+// makes it the branch's new leaf and bumps the session's updated_at
+func (s *Store) insertMessage(msg *Message) error {
+	content, err := s.encrypt(msg.Content, cellAAD("messages", "content", msg.ID))
+	if err != nil {
+		return fmt.Errorf("failed to add message: %w", err)
+	}
+	reasoning, err := s.encrypt(msg.Reasoning, cellAAD("messages", "reasoning", msg.ID))
+	if err != nil {
+		return fmt.Errorf("failed to add message: %w", err)
+	}
+	arguments, err := s.encrypt(msg.ToolArguments, cellAAD("messages", "tool_arguments", msg.ID))
+	if err != nil {
+		return fmt.Errorf("failed to add message: %w", err)
+	}
+	citations, err := s.encrypt(encodeCitations(msg.Citations), cellAAD("messages", "citations", msg.ID))
+	if err != nil {
+		return fmt.Errorf("failed to add message: %w", err)
+	}
+
 	tx, err := s.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	err = tx.QueryRow("SELECT active_leaf_id FROM sessions WHERE id = ?", msg.SessionID).Scan(&msg.ParentID)
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return fmt.Errorf("failed to get active branch: %w", err)
 	}
 
 	_, err = tx.Exec(`
-		INSERT INTO messages (id, session_id, role, content, created_at)
-		VALUES (?, ?, ?, ?, ?)
-	`, msg.ID, msg.SessionID, msg.Role, msg.Content, msg.CreatedAt)
+		INSERT INTO messages (id, session_id, role, content, created_at, tool_call_id, tool_name, tool_arguments,
+			provider, model, prompt_tokens, completion_tokens, thinking_tokens, finish_reason, latency_ms, ttft_ms, cost,
+			cache_read_tokens, cache_write_tokens, reasoning, citations, parent_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, msg.ID, msg.SessionID, msg.Role, content, msg.CreatedAt,
+		msg.ToolCallID, msg.ToolName, arguments,
+		msg.Meta.Provider, msg.Meta.Model, msg.Meta.PromptTokens, msg.Meta.CompletionTokens,
+		msg.Meta.ThinkingTokens, msg.Meta.FinishReason,
+		msg.Meta.Latency.Milliseconds(), msg.Meta.TimeToFirstToken.Milliseconds(), msg.Meta.Cost,
+		msg.Meta.CacheReadTokens, msg.Meta.CacheWriteTokens, reasoning, citations,
+		msg.ParentID)
 
 	if err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("failed to add message: %w", err)
+		return fmt.Errorf("failed to add message: %w", err)
 	}
 
-	// Update session's updated_at
-	_, err = tx.Exec("UPDATE sessions SET updated_at = ? WHERE id = ?",
-		time.Now(), sessionID)
+	// Update session's updated_at and active branch
+	_, err = tx.Exec("UPDATE sessions SET updated_at = ?, active_leaf_id = ? WHERE id = ?",
+		time.Now(), msg.ID, msg.SessionID)
 	if err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("failed to update session timestamp: %w", err)
+		return fmt.Errorf("failed to update session timestamp: %w", err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return msg, nil
+	return nil
 }
 
-// GetMessages retrieves all messages for a session in chronological order
+// GetMessages retrieves the messages on a session's active branch in
+// chronological order
 func (s *Store) GetMessages(sessionID string) ([]*Message, error) {
-	rows, err := s.db.Query(`
-		SELECT id, session_id, role, content, created_at
-		FROM messages WHERE session_id = ?
-		ORDER BY created_at ASC
+	rows, err := s.db.Query(activePathCTE+`
+		SELECT `+messageColumns+`
+		FROM messages JOIN path ON messages.id = path.msg_id
+		ORDER BY path.depth DESC
 	`, sessionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []*Message
-	for rows.Next() {
-		msg := &Message{}
-		err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
-		}
-		messages = append(messages, msg)
-	}
-
-	return messages, rows.Err()
+	return s.scanMessages(rows)
 }
 
-// GetLastNMessages retrieves the last N messages for a session
+// GetLastNMessages retrieves the last N messages on a session's active branch
 func (s *Store) GetLastNMessages(sessionID string, n int) ([]*Message, error) {
-	rows, err := s.db.Query(`
-		SELECT id, session_id, role, content, created_at
-		FROM messages WHERE session_id = ?
-		ORDER BY created_at DESC LIMIT ?
+	rows, err := s.db.Query(activePathCTE+`
+		SELECT `+messageColumns+`
+		FROM messages JOIN path ON messages.id = path.msg_id
+		ORDER BY path.depth ASC LIMIT ?
 	`, sessionID, n)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []*Message
-	for rows.Next() {
-		msg := &Message{}
-		err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
-		}
-		messages = append(messages, msg)
-	}
-
-	if err := rows.Err(); err != nil {
+	messages, err := s.scanMessages(rows)
+	if err != nil {
 		return nil, err
 	}
 
@@ -381,37 +656,158 @@ func (s *Store) GetLastNMessages(sessionID string, n int) ([]*Message, error) {
 
 // UpdateMessage updates an existing message's content
 func (s *Store) UpdateMessage(id, content string) error {
-	_, err := s.db.Exec("UPDATE messages SET content = ? WHERE id = ?", content, id)
+	content, err := s.encrypt(content, cellAAD("messages", "content", id))
+	if err != nil {
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+	_, err = s.db.Exec("UPDATE messages SET content = ? WHERE id = ?", content, id)
 	if err != nil {
 		return fmt.Errorf("failed to update message: %w", err)
 	}
 	return nil
 }
 
-// DeleteMessage deletes a message
+// DeleteMessage deletes a message. The messages that followed it are linked
+// to its parent instead, so no branch is cut off.
 func (s *Store) DeleteMessage(id string) error {
-	_, err := s.db.Exec("DELETE FROM messages WHERE id = ?", id)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	var sessionID, parentID string
+	err = tx.QueryRow("SELECT session_id, parent_id FROM messages WHERE id = ?", id).Scan(&sessionID, &parentID)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return nil
+	}
 	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+
+	statements := []string{
+		"UPDATE messages SET parent_id = ? WHERE session_id = ? AND parent_id = ?",
+		"UPDATE sessions SET active_leaf_id = ? WHERE id = ? AND active_leaf_id = ?",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, parentID, sessionID, id); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to relink messages: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM messages WHERE id = ?", id); err != nil {
+		tx.Rollback()
 		return fmt.Errorf("failed to delete message: %w", err)
 	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
-// GetMessageCount returns the number of messages in a session
+// GetMessageCount returns the number of messages on a session's active branch
 func (s *Store) GetMessageCount(sessionID string) (int, error) {
 	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM messages WHERE session_id = ?", sessionID).Scan(&count)
+	err := s.db.QueryRow(activePathCTE+"SELECT COUNT(*) FROM path", sessionID).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count messages: %w", err)
 	}
 	return count, nil
 }
 
+// RecordCost records the cost of a billed request. Costs are kept apart from
+// messages and are never deleted, so spending totals and budgets count
+// requests whose replies were not saved or have since been removed.
+func (s *Store) RecordCost(sessionID, provider, model string, cost float64) error {
+	if cost <= 0 {
+		return nil
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO usage_costs (provider, model, session_id, cost, created_at) VALUES (?, ?, ?, ?, ?)
+	`, provider, model, sessionID, cost, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record cost: %w", err)
+	}
+	return nil
+}
+
+// GetSessionCost returns the total cost of the requests made in a session
+func (s *Store) GetSessionCost(sessionID string) (float64, error) {
+	var cost float64
+	err := s.db.QueryRow("SELECT COALESCE(SUM(cost), 0) FROM usage_costs WHERE session_id = ?", sessionID).Scan(&cost)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum session cost: %w", err)
+	}
+	return cost, nil
+}
+
+// CacheUsage totals the prompt cache tokens of a session's replies from one
+// provider and model
+type CacheUsage struct {
+	Provider    string
+	Model       string
+	ReadTokens  int
+	WriteTokens int
+}
+
+// GetCacheUsage returns a session's prompt cache usage by provider and model
+func (s *Store) GetCacheUsage(sessionID string) ([]CacheUsage, error) {
+	rows, err := s.db.Query(`
+		SELECT provider, model, SUM(cache_read_tokens), SUM(cache_write_tokens)
+		FROM messages
+		WHERE session_id = ? AND (cache_read_tokens > 0 OR cache_write_tokens > 0)
+		GROUP BY provider, model
+		ORDER BY provider, model
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum cache usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []CacheUsage
+	for rows.Next() {
+		var u CacheUsage
+		if err := rows.Scan(&u.Provider, &u.Model, &u.ReadTokens, &u.WriteTokens); err != nil {
+			return nil, fmt.Errorf("failed to scan cache usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// GetCostSince returns the total cost of requests made since the given
+// time, across all sessions. An empty provider includes every provider.
+func (s *Store) GetCostSince(since time.Time, provider string) (float64, error) {
+	query := "SELECT COALESCE(SUM(cost), 0) FROM usage_costs WHERE created_at >= ?"
+	args := []interface{}{since}
+	if provider != "" {
+		query += " AND provider = ?"
+		args = append(args, provider)
+	}
+
+	var cost float64
+	if err := s.db.QueryRow(query, args...).Scan(&cost); err != nil {
+		return 0, fmt.Errorf("failed to sum cost: %w", err)
+	}
+	return cost, nil
+}
+
+// FormatCost formats a cost in US dollars, keeping small amounts readable
+func FormatCost(cost float64) string {
+	if cost > 0 && cost < 0.01 {
+		return fmt.Sprintf("$%.4f", cost)
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
+
 // SearchSessions searches sessions by name (case-insensitive)
 func (s *Store) SearchSessions(query string) ([]*Session, error) {
 	rows, err := s.db.Query(`
-		SELECT id, name, provider, model, system_prompt, created_at, updated_at
-		FROM sessions WHERE name LIKE ? ORDER BY updated_at DESC
+		SELECT `+sessionColumns+`
+		FROM sessions WHERE name LIKE ? AND deleted_at IS NULL ORDER BY updated_at DESC
 	`, "%"+query+"%")
 	if err != nil {
 		return nil, fmt.Errorf("failed to search sessions: %w", err)
@@ -420,9 +816,7 @@ func (s *Store) SearchSessions(query string) ([]*Session, error) {
 
 	var sessions []*Session
 	for rows.Next() {
-		session := &Session{}
-		err := rows.Scan(&session.ID, &session.Name, &session.Provider, &session.Model,
-			&session.SystemPrompt, &session.CreatedAt, &session.UpdatedAt)
+		session, err := s.scanSession(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan session: %w", err)
 		}
@@ -432,14 +826,13 @@ func (s *Store) SearchSessions(query string) ([]*Session, error) {
 	return sessions, rows.Err()
 }
 
-// GetMostRecentSession returns the most recently updated session
+// GetMostRecentSession returns the most recently updated session outside the
+// trash
 func (s *Store) GetMostRecentSession() (*Session, error) {
-	session := &Session{}
-	err := s.db.QueryRow(`
-		SELECT id, name, provider, model, system_prompt, created_at, updated_at
-		FROM sessions ORDER BY updated_at DESC LIMIT 1
-	`).Scan(&session.ID, &session.Name, &session.Provider, &session.Model,
-		&session.SystemPrompt, &session.CreatedAt, &session.UpdatedAt)
+	session, err := s.scanSession(s.db.QueryRow(`
+		SELECT `+sessionColumns+`
+		FROM sessions WHERE deleted_at IS NULL ORDER BY updated_at DESC LIMIT 1
+	`))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -453,11 +846,10 @@ func (s *Store) GetMostRecentSession() (*Session, error) {
 
 // GetMessage retrieves a message by ID
 func (s *Store) GetMessage(id string) (*Message, error) {
-	msg := &Message{}
-	err := s.db.QueryRow(`
-		SELECT id, session_id, role, content, created_at
+	msg, err := s.scanMessage(s.db.QueryRow(`
+		SELECT `+messageColumns+`
 		FROM messages WHERE id = ?
-	`, id).Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.CreatedAt)
+	`, id))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -475,7 +867,11 @@ func (s *Store) FullTextSearch(query string, limit int) ([]*SearchResult, error)
 		limit = 50
 	}
 
-	// Use FTS5 if available, otherwise fall back to LIKE
+	// Encrypted content can only be searched once decrypted. Otherwise use
+	// FTS5 if available, or fall back to LIKE.
+	if s.encrypted {
+		return s.fullTextSearchDecrypted(query, limit)
+	}
 	if s.hasFTS5 {
 		return s.fullTextSearchFTS5(query, limit)
 	}
@@ -496,7 +892,7 @@ func (s *Store) fullTextSearchFTS5(query string, limit int) ([]*SearchResult, er
 		FROM messages_fts
 		JOIN messages m ON messages_fts.message_id = m.id
 		JOIN sessions s ON m.session_id = s.id
-		WHERE messages_fts MATCH ?
+		WHERE messages_fts MATCH ? AND s.deleted_at IS NULL
 		ORDER BY rank
 		LIMIT ?
 	`, query, limit)
@@ -533,7 +929,7 @@ func (s *Store) fullTextSearchLike(query string, limit int) ([]*SearchResult, er
 			m.created_at
 		FROM messages m
 		JOIN sessions s ON m.session_id = s.id
-		WHERE m.content LIKE ?
+		WHERE m.content LIKE ? AND s.deleted_at IS NULL
 		ORDER BY m.created_at DESC
 		LIMIT ?
 	`, likeQuery, limit)
@@ -559,6 +955,51 @@ func (s *Store) fullTextSearchLike(query string, limit int) ([]*SearchResult, er
 	return results, rows.Err()
 }
 
+// fullTextSearchDecrypted searches an encrypted database by decrypting each
+// message in turn, newest first. It reads every message outside the trash,
+// so it is slower than the index on large databases.
+func (s *Store) fullTextSearchDecrypted(query string, limit int) ([]*SearchResult, error) {
+	rows, err := s.db.Query(`
+		SELECT
+			m.id,
+			m.session_id,
+			s.name,
+			m.role,
+			m.content,
+			m.created_at
+		FROM messages m
+		JOIN sessions s ON m.session_id = s.id
+		WHERE s.deleted_at IS NULL
+		ORDER BY m.created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	lowerQuery := strings.ToLower(query)
+	var results []*SearchResult
+	for rows.Next() && len(results) < limit {
+		r := &SearchResult{}
+		var role string
+		err := rows.Scan(&r.MessageID, &r.SessionID, &r.SessionName, &role, &r.Content, &r.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		if r.Content, err = s.decrypt(r.Content, cellAAD("messages", "content", r.MessageID)); err != nil {
+			return nil, fmt.Errorf("failed to search messages: %w", err)
+		}
+		if !strings.Contains(strings.ToLower(r.Content), lowerQuery) {
+			continue
+		}
+		r.Role = Role(role)
+		r.Snippet = createSnippet(r.Content, query, 100)
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
 // createSnippet creates a snippet around the first occurrence of the query
 func createSnippet(content, query string, maxLen int) string {
 	lowerContent := strings.ToLower(content)
@@ -603,11 +1044,10 @@ func (s *Store) SearchSessionsByFTS(query string, limit int) ([]*Session, error)
 	// Use FTS5 if available, otherwise fall back to LIKE
 	if s.hasFTS5 {
 		rows, err := s.db.Query(`
-			SELECT
-				s.id, s.name, s.provider, s.model, s.system_prompt, s.created_at, s.updated_at
+			SELECT `+sessionColumns+`
 			FROM sessions_fts
-			JOIN sessions s ON sessions_fts.session_id = s.id
-			WHERE sessions_fts MATCH ?
+			JOIN sessions ON sessions_fts.session_id = sessions.id
+			WHERE sessions_fts MATCH ? AND sessions.deleted_at IS NULL
 			ORDER BY rank
 			LIMIT ?
 		`, query, limit)
@@ -618,9 +1058,7 @@ func (s *Store) SearchSessionsByFTS(query string, limit int) ([]*Session, error)
 
 		var sessions []*Session
 		for rows.Next() {
-			session := &Session{}
-			err := rows.Scan(&session.ID, &session.Name, &session.Provider, &session.Model,
-				&session.SystemPrompt, &session.CreatedAt, &session.UpdatedAt)
+			session, err := s.scanSession(rows)
 			if err != nil {
 				return nil, fmt.Errorf("failed to scan session: %w", err)
 			}
@@ -632,12 +1070,14 @@ func (s *Store) SearchSessionsByFTS(query string, limit int) ([]*Session, error)
 	// Fallback to LIKE search
 	likeQuery := "%" + query + "%"
 	rows, err := s.db.Query(`
-		SELECT id, name, provider, model, system_prompt, created_at, updated_at
+		SELECT `+sessionColumns+`
 		FROM sessions
-		WHERE name LIKE ? OR system_prompt LIKE ?
+		WHERE (name LIKE ? OR system_prompt LIKE ?
+			OR EXISTS (SELECT 1 FROM session_tags WHERE session_id = sessions.id AND tag LIKE ?))
+			AND deleted_at IS NULL
 		ORDER BY updated_at DESC
 		LIMIT ?
-	`, likeQuery, likeQuery, limit)
+	`, likeQuery, likeQuery, likeQuery, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search sessions: %w", err)
 	}
@@ -645,9 +1085,7 @@ func (s *Store) SearchSessionsByFTS(query string, limit int) ([]*Session, error)
 
 	var sessions []*Session
 	for rows.Next() {
-		session := &Session{}
-		err := rows.Scan(&session.ID, &session.Name, &session.Provider, &session.Model,
-			&session.SystemPrompt, &session.CreatedAt, &session.UpdatedAt)
+		session, err := s.scanSession(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan session: %w", err)
 		}
@@ -669,18 +1107,20 @@ func (s *Store) RebuildFTSIndex() error {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
-	// Rebuild messages FTS
-	if _, err := tx.Exec("DELETE FROM messages_fts"); err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to clear messages_fts: %w", err)
-	}
+	// Rebuild messages FTS, which an encrypted database no longer has
+	if !s.encrypted {
+		if _, err := tx.Exec("DELETE FROM messages_fts"); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to clear messages_fts: %w", err)
+		}
 
-	if _, err := tx.Exec(`
-		INSERT INTO messages_fts(message_id, session_id, content)
-		SELECT id, session_id, content FROM messages
-	`); err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to rebuild messages_fts: %w", err)
+		if _, err := tx.Exec(`
+			INSERT INTO messages_fts(message_id, session_id, content)
+			SELECT id, session_id, content FROM messages
+		`); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to rebuild messages_fts: %w", err)
+		}
 	}
 
 	// Rebuild sessions FTS
@@ -689,9 +1129,16 @@ func (s *Store) RebuildFTSIndex() error {
 		return fmt.Errorf("failed to clear sessions_fts: %w", err)
 	}
 
+	// System prompts of an encrypted database are left out of the index
+	systemPrompt := "system_prompt"
+	if s.encrypted {
+		systemPrompt = "''"
+	}
 	if _, err := tx.Exec(`
-		INSERT INTO sessions_fts(session_id, name, system_prompt)
-		SELECT id, name, system_prompt FROM sessions
+		INSERT INTO sessions_fts(session_id, name, system_prompt, tags)
+		SELECT id, name, ` + systemPrompt + `,
+			COALESCE((SELECT group_concat(tag, ' ') FROM session_tags WHERE session_id = sessions.id), '')
+		FROM sessions
 	`); err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to rebuild sessions_fts: %w", err)
@@ -719,48 +1166,99 @@ func (s *Store) AddAttachment(sessionID, filename, filepath, content, mimeType s
 		CreatedAt:         time.Now(),
 	}
 
-	_, err := s.db.Exec(`
-		INSERT INTO attachments (id, session_id, filename, filepath, content, size_bytes, mime_type, included_in_context, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, att.ID, att.SessionID, att.Filename, att.Filepath, att.Content, att.SizeBytes, att.MimeType, att.IncludedInContext, att.CreatedAt)
+	if err := s.insertAttachment(att); err != nil {
+		return nil, err
+	}
+	return att, nil
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to add attachment: %w", err)
+// AddBinaryAttachment adds a binary file, such as an image, to the session's
+// context vault
+func (s *Store) AddBinaryAttachment(sessionID, filename, filepath, mimeType string, data []byte) (*Attachment, error) {
+	att := &Attachment{
+		ID:                uuid.New().String(),
+		SessionID:         sessionID,
+		Filename:          filename,
+		Filepath:          filepath,
+		SizeBytes:         int64(len(data)),
+		MimeType:          mimeType,
+		IncludedInContext: true,
+		CreatedAt:         time.Now(),
+		Data:              data,
 	}
 
+	if err := s.insertAttachment(att); err != nil {
+		return nil, err
+	}
 	return att, nil
 }
 
-// GetAttachments retrieves all attachments for a session
-func (s *Store) GetAttachments(sessionID string) ([]*Attachment, error) {
-	rows, err := s.db.Query(`
-		SELECT id, session_id, filename, filepath, content, size_bytes, mime_type, included_in_context, created_at
-		FROM attachments WHERE session_id = ?
-		ORDER BY created_at ASC
-	`, sessionID)
+// insertAttachment stores an attachment row
+func (s *Store) insertAttachment(att *Attachment) error {
+	content, err := s.encrypt(att.Content, cellAAD("attachments", "content", att.ID))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get attachments: %w", err)
+		return fmt.Errorf("failed to add attachment: %w", err)
 	}
-	defer rows.Close()
+	data, err := s.encryptBytes(att.Data, cellAAD("attachments", "data", att.ID))
+	if err != nil {
+		return fmt.Errorf("failed to add attachment: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO attachments (id, session_id, filename, filepath, content, size_bytes, mime_type, included_in_context, created_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, att.ID, att.SessionID, att.Filename, att.Filepath, content, att.SizeBytes, att.MimeType, att.IncludedInContext, att.CreatedAt, data)
+
+	if err != nil {
+		return fmt.Errorf("failed to add attachment: %w", err)
+	}
+	return nil
+}
+
+// attachmentColumns lists the attachment columns read by scanAttachments, in order
+const attachmentColumns = `id, session_id, filename, filepath, content, size_bytes, mime_type, included_in_context, created_at, data`
 
+// scanAttachments scans all rows selected with attachmentColumns
+func (s *Store) scanAttachments(rows *sql.Rows) ([]*Attachment, error) {
 	var attachments []*Attachment
 	for rows.Next() {
 		att := &Attachment{}
 		err := rows.Scan(&att.ID, &att.SessionID, &att.Filename, &att.Filepath, &att.Content,
-			&att.SizeBytes, &att.MimeType, &att.IncludedInContext, &att.CreatedAt)
+			&att.SizeBytes, &att.MimeType, &att.IncludedInContext, &att.CreatedAt, &att.Data)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan attachment: %w", err)
 		}
+		if att.Content, err = s.decrypt(att.Content, cellAAD("attachments", "content", att.ID)); err != nil {
+			return nil, fmt.Errorf("failed to read attachment: %w", err)
+		}
+		if att.Data, err = s.decryptBytes(att.Data, cellAAD("attachments", "data", att.ID)); err != nil {
+			return nil, fmt.Errorf("failed to read attachment: %w", err)
+		}
 		attachments = append(attachments, att)
 	}
 
 	return attachments, rows.Err()
 }
 
+// GetAttachments retrieves all attachments for a session
+func (s *Store) GetAttachments(sessionID string) ([]*Attachment, error) {
+	rows, err := s.db.Query(`
+		SELECT `+attachmentColumns+`
+		FROM attachments WHERE session_id = ?
+		ORDER BY created_at ASC
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachments: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanAttachments(rows)
+}
+
 // GetActiveAttachments retrieves attachments marked for inclusion in context
 func (s *Store) GetActiveAttachments(sessionID string) ([]*Attachment, error) {
 	rows, err := s.db.Query(`
-		SELECT id, session_id, filename, filepath, content, size_bytes, mime_type, included_in_context, created_at
+		SELECT `+attachmentColumns+`
 		FROM attachments WHERE session_id = ? AND included_in_context = 1
 		ORDER BY created_at ASC
 	`, sessionID)
@@ -769,18 +1267,7 @@ func (s *Store) GetActiveAttachments(sessionID string) ([]*Attachment, error) {
 	}
 	defer rows.Close()
 
-	var attachments []*Attachment
-	for rows.Next() {
-		att := &Attachment{}
-		err := rows.Scan(&att.ID, &att.SessionID, &att.Filename, &att.Filepath, &att.Content,
-			&att.SizeBytes, &att.MimeType, &att.IncludedInContext, &att.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan attachment: %w", err)
-		}
-		attachments = append(attachments, att)
-	}
-
-	return attachments, rows.Err()
+	return s.scanAttachments(rows)
 }
 
 // ToggleAttachmentContext toggles whether an attachment is included in context
@@ -824,10 +1311,15 @@ func (s *Store) AddSummary(sessionID, startMsgID, endMsgID, content string, orig
 		CreatedAt:          time.Now(),
 	}
 
-	_, err := s.db.Exec(`
+	summaryContent, err := s.encrypt(sum.SummaryContent, cellAAD("summaries", "summary_content", sum.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add summary: %w", err)
+	}
+
+	_, err = s.db.Exec(`
 		INSERT INTO summaries (id, session_id, start_message_id, end_message_id, summary_content, original_token_count, summary_token_count, created_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, sum.ID, sum.SessionID, sum.StartMessageID, sum.EndMessageID, sum.SummaryContent, sum.OriginalTokenCount, sum.SummaryTokenCount, sum.CreatedAt)
+	`, sum.ID, sum.SessionID, sum.StartMessageID, sum.EndMessageID, summaryContent, sum.OriginalTokenCount, sum.SummaryTokenCount, sum.CreatedAt)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to add summary: %w", err)
@@ -856,6 +1348,9 @@ func (s *Store) GetSummaries(sessionID string) ([]*Summary, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan summary: %w", err)
 		}
+		if sum.SummaryContent, err = s.decrypt(sum.SummaryContent, cellAAD("summaries", "summary_content", sum.ID)); err != nil {
+			return nil, fmt.Errorf("failed to read summary: %w", err)
+		}
 		summaries = append(summaries, sum)
 	}
 
@@ -878,6 +1373,9 @@ func (s *Store) GetLatestSummary(sessionID string) (*Summary, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get latest summary: %w", err)
 	}
+	if sum.SummaryContent, err = s.decrypt(sum.SummaryContent, cellAAD("summaries", "summary_content", sum.ID)); err != nil {
+		return nil, fmt.Errorf("failed to read summary: %w", err)
+	}
 
 	return sum, nil
 }
@@ -891,71 +1389,47 @@ func (s *Store) DeleteSummary(id string) error {
 	return nil
 }
 
-// GetMessagesAfterID retrieves all messages after a specific message ID (chronologically)
+// GetMessagesAfterID retrieves the messages after a specific message ID on
+// the session's active branch (chronologically)
 func (s *Store) GetMessagesAfterID(sessionID, messageID string) ([]*Message, error) {
-	// First get the timestamp of the reference message
-	var refTime time.Time
-	err := s.db.QueryRow("SELECT created_at FROM messages WHERE id = ?", messageID).Scan(&refTime)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get reference message: %w", err)
-	}
-
-	rows, err := s.db.Query(`
-		SELECT id, session_id, role, content, created_at
-		FROM messages
-		WHERE session_id = ? AND created_at > ?
-		ORDER BY created_at ASC
-	`, sessionID, refTime)
+	messages, err := s.GetMessages(sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get messages: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
-
-	var messages []*Message
-	for rows.Next() {
-		msg := &Message{}
-		err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
-		}
-		messages = append(messages, msg)
+	start := messageIndex(messages, messageID)
+	if start < 0 {
+		return nil, fmt.Errorf("failed to get reference message: %s is not on the active branch", messageID)
 	}
-
-	return messages, rows.Err()
+	return messages[start+1:], nil
 }
 
-// GetMessagesInRange retrieves messages between two message IDs (inclusive)
+// GetMessagesInRange retrieves the messages between two message IDs on the
+// session's active branch (inclusive)
 func (s *Store) GetMessagesInRange(sessionID, startMsgID, endMsgID string) ([]*Message, error) {
-	var startTime, endTime time.Time
-	err := s.db.QueryRow("SELECT created_at FROM messages WHERE id = ?", startMsgID).Scan(&startTime)
+	messages, err := s.GetMessages(sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get start message: %w", err)
+		return nil, err
 	}
-	err = s.db.QueryRow("SELECT created_at FROM messages WHERE id = ?", endMsgID).Scan(&endTime)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get end message: %w", err)
+	start := messageIndex(messages, startMsgID)
+	if start < 0 {
+		return nil, fmt.Errorf("failed to get start message: %s is not on the active branch", startMsgID)
 	}
-
-	rows, err := s.db.Query(`
-		SELECT id, session_id, role, content, created_at
-		FROM messages
-		WHERE session_id = ? AND created_at >= ? AND created_at <= ?
-		ORDER BY created_at ASC
-	`, sessionID, startTime, endTime)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get messages: %w", err)
+	end := messageIndex(messages, endMsgID)
+	if end < 0 {
+		return nil, fmt.Errorf("failed to get end message: %s is not on the active branch", endMsgID)
 	}
-	defer rows.Close()
+	if end < start {
+		return nil, nil
+	}
+	return messages[start : end+1], nil
+}
 
-	var messages []*Message
-	for rows.Next() {
-		msg := &Message{}
-		err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
+// messageIndex returns the index of the message with the given ID, or -1
+func messageIndex(messages []*Message, id string) int {
+	for i, msg := range messages {
+		if msg.ID == id {
+			return i
 		}
-		messages = append(messages, msg)
 	}
-
-	return messages, rows.Err()
+	return -1
 }
@@ -1,8 +1,12 @@
 package store
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -156,6 +160,78 @@ func TestUpdateSession(t *testing.T) {
 	}
 }
 
+func TestSessionParams(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session, err := store.CreateSession("Params", "openai", "gpt-4o", "")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if !session.Params.IsZero() {
+		t.Errorf("expected no parameters on a new session, got %s", session.Params)
+	}
+
+	for name, value := range map[string]string{
+		ParamTemperature: "0",
+		ParamTopP:        "0.9",
+		ParamMaxTokens:   "512",
+		ParamStop:        "END, ###",
+		ParamSeed:        "42",
+	} {
+		if err := session.Params.Set(name, value); err != nil {
+			t.Fatalf("Set %s failed: %v", name, err)
+		}
+	}
+	for name, value := range map[string]string{
+		ParamTemperature:      "3",
+		ParamMaxTokens:        "-1",
+		ParamSeed:             "abc",
+		ParamFrequencyPenalty: "",
+		"presence":            "1",
+	} {
+		if err := session.Params.Set(name, value); err == nil {
+			t.Errorf("expected error setting %s to %q", name, value)
+		}
+	}
+	session.JSONSchema = `{"type":"object"}`
+	if err := store.UpdateSession(session); err != nil {
+		t.Fatalf("UpdateSession failed: %v", err)
+	}
+
+	loaded, err := store.GetSession(session.ID)
+	if err != nil {
+		t.Fatalf("GetSession failed: %v", err)
+	}
+	if loaded.JSONSchema != session.JSONSchema {
+		t.Errorf("expected stored JSON schema, got '%s'", loaded.JSONSchema)
+	}
+	if got := loaded.Params.String(); got != "temperature=0 top_p=0.9 max_tokens=512 stop=END, ### seed=42" {
+		t.Errorf("unexpected stored parameters: %s", got)
+	}
+
+	// "default" unsets a parameter
+	if err := loaded.Params.Set(ParamTemperature, "default"); err != nil || loaded.Params.Temperature != nil {
+		t.Errorf("expected temperature unset, got %v (err %v)", loaded.Params.Temperature, err)
+	}
+
+	// Reasoning is an effort level or a token budget
+	if err := loaded.Params.Set(ParamReasoning, "High"); err != nil || loaded.Params.ReasoningEffort() != "high" {
+		t.Errorf("expected high reasoning effort, got %q (err %v)", loaded.Params.Reasoning, err)
+	}
+	if err := loaded.Params.Set(ParamReasoning, "8000"); err != nil || loaded.Params.ReasoningBudget() != 8000 {
+		t.Errorf("expected 8000 token reasoning budget, got %q (err %v)", loaded.Params.Reasoning, err)
+	}
+	if err := loaded.Params.Set(ParamReasoning, "100"); err == nil {
+		t.Error("expected error for a reasoning budget below the minimum")
+	}
+
+	sessions, err := store.ListSessions()
+	if err != nil || len(sessions) != 1 || sessions[0].Params.MaxTokens != 512 {
+		t.Errorf("expected parameters in session list, got %+v (err %v)", sessions, err)
+	}
+}
+
 func TestDeleteSession(t *testing.T) {
 	store, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -194,6 +270,420 @@ func TestDeleteSession(t *testing.T) {
 	}
 }
 
+func TestTrashSession(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	kept, err := store.CreateSession("Kept", "openai", "gpt-4o", "")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	trashed, err := store.CreateSession("Trashed", "openai", "gpt-4o", "")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if _, err := store.AddMessage(trashed.ID, RoleUser, "findable needle"); err != nil {
+		t.Fatalf("AddMessage failed: %v", err)
+	}
+
+	if err := store.TrashSession(trashed.ID); err != nil {
+		t.Fatalf("TrashSession failed: %v", err)
+	}
+
+	sessions, err := store.ListSessions()
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != kept.ID {
+		t.Errorf("expected only the kept session to be listed, got %d sessions", len(sessions))
+	}
+	if recent, _ := store.GetMostRecentSession(); recent == nil || recent.ID != kept.ID {
+		t.Error("expected the most recent session to skip the trash")
+	}
+	if results, _ := store.FullTextSearch("needle", 10); len(results) != 0 {
+		t.Errorf("expected no search results from the trash, got %d", len(results))
+	}
+
+	trash, err := store.ListTrash()
+	if err != nil {
+		t.Fatalf("ListTrash failed: %v", err)
+	}
+	if len(trash) != 1 || trash[0].ID != trashed.ID || trash[0].DeletedAt.IsZero() {
+		t.Fatalf("expected the trashed session in the trash, got %+v", trash)
+	}
+
+	// Restoring brings the session and its messages back
+	if err := store.RestoreSession(trashed.ID); err != nil {
+		t.Fatalf("RestoreSession failed: %v", err)
+	}
+	if sessions, _ := store.ListSessions(); len(sessions) != 2 {
+		t.Errorf("expected 2 sessions after restore, got %d", len(sessions))
+	}
+	if messages, _ := store.GetMessages(trashed.ID); len(messages) != 1 {
+		t.Errorf("expected the restored session's message, got %d", len(messages))
+	}
+
+	// Purging only removes sessions trashed before the cutoff
+	if err := store.TrashSession(trashed.ID); err != nil {
+		t.Fatalf("TrashSession failed: %v", err)
+	}
+	if n, err := store.PurgeTrash(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("expected nothing purged before the cutoff, got %d (%v)", n, err)
+	}
+	if n, err := store.PurgeTrash(time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Errorf("expected 1 session purged, got %d (%v)", n, err)
+	}
+	if gone, _ := store.GetSession(trashed.ID); gone != nil {
+		t.Error("expected purged session to be gone")
+	}
+	if kept, _ := store.GetSession(kept.ID); kept == nil {
+		t.Error("expected the kept session to survive the purge")
+	}
+}
+
+func TestClearMessages(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session, err := store.CreateSession("Test Session", "openai", "gpt-4o", "")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	first, _ := store.AddMessage(session.ID, RoleUser, "first")
+	store.AddMessage(session.ID, RoleAssistant, "reply")
+	store.SetActiveLeaf(session.ID, "")
+	store.AddMessage(session.ID, RoleUser, "other branch")
+	if first == nil {
+		t.Fatal("AddMessage failed")
+	}
+
+	if err := store.ClearMessages(session.ID); err != nil {
+		t.Fatalf("ClearMessages failed: %v", err)
+	}
+	if branches, _ := store.GetBranches(session.ID); len(branches) != 0 {
+		t.Errorf("expected every branch cleared, got %d versions", len(branches))
+	}
+
+	msg, err := store.AddMessage(session.ID, RoleUser, "fresh start")
+	if err != nil {
+		t.Fatalf("AddMessage failed: %v", err)
+	}
+	if msg.ParentID != "" {
+		t.Errorf("expected a new root message, got parent %q", msg.ParentID)
+	}
+	if messages, _ := store.GetMessages(session.ID); len(messages) != 1 {
+		t.Errorf("expected 1 message after clearing, got %d", len(messages))
+	}
+}
+
+func TestSessionTagsFoldersAndPins(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	older, err := store.CreateSession("Older", "openai", "gpt-4o", "")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	newer, err := store.CreateSession("Newer", "openai", "gpt-4o", "")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if _, err := store.AddMessage(newer.ID, RoleUser, "Hello"); err != nil {
+		t.Fatalf("AddMessage failed: %v", err)
+	}
+
+	if err := store.AddTags(older.ID, "#Work", "go lang", "work"); err != nil {
+		t.Fatalf("AddTags failed: %v", err)
+	}
+	if err := store.SetFolder(older.ID, "Projects"); err != nil {
+		t.Fatalf("SetFolder failed: %v", err)
+	}
+	if err := store.SetPinned(older.ID, true); err != nil {
+		t.Fatalf("SetPinned failed: %v", err)
+	}
+
+	// Pinned sessions come first even when older
+	sessions, err := store.ListSessions()
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != older.ID {
+		t.Fatalf("expected the pinned session first, got %+v", sessions)
+	}
+	got := sessions[0]
+	if !got.Pinned || got.Folder != "Projects" {
+		t.Errorf("expected pinned session in Projects, got pinned=%v folder=%q", got.Pinned, got.Folder)
+	}
+	if strings.Join(got.Tags, ",") != "go-lang,work" {
+		t.Errorf("expected normalized tags [go-lang work], got %v", got.Tags)
+	}
+	if sessions[1].Pinned || sessions[1].Folder != "" || len(sessions[1].Tags) != 0 {
+		t.Errorf("expected the other session untouched, got %+v", sessions[1])
+	}
+
+	// Tags are searchable
+	results, err := store.SearchSessionsByFTS("work", 10)
+	if err != nil {
+		t.Fatalf("SearchSessionsByFTS failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != older.ID {
+		t.Errorf("expected the tagged session from a tag search, got %d results", len(results))
+	}
+
+	if err := store.RemoveTags(older.ID, "WORK"); err != nil {
+		t.Fatalf("RemoveTags failed: %v", err)
+	}
+	if results, _ := store.SearchSessionsByFTS("work", 10); len(results) != 0 {
+		t.Errorf("expected no results for a removed tag, got %d", len(results))
+	}
+
+	// Empty folders are removed once their last session leaves
+	if folders, _ := store.ListFolders(); len(folders) != 1 || folders[0] != "Projects" {
+		t.Errorf("expected folder Projects, got %v", folders)
+	}
+	if err := store.SetFolder(older.ID, ""); err != nil {
+		t.Fatalf("SetFolder failed: %v", err)
+	}
+	if folders, _ := store.ListFolders(); len(folders) != 0 {
+		t.Errorf("expected no folders, got %v", folders)
+	}
+
+	if err := store.SetPinned(older.ID, false); err != nil {
+		t.Fatalf("SetPinned failed: %v", err)
+	}
+	if sessions, _ := store.ListSessions(); sessions[0].ID != newer.ID {
+		t.Error("expected the most recent session first after unpinning")
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	store, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	session, err := store.CreateSession("Private", "openai", "gpt-4o", "secret prompt")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if _, err := store.AddMessage(session.ID, RoleUser, "secret question"); err != nil {
+		t.Fatalf("AddMessage failed: %v", err)
+	}
+	if _, err := store.AddAttachment(session.ID, "notes.txt", "/tmp/notes.txt", "secret notes", "text/plain", 12); err != nil {
+		t.Fatalf("AddAttachment failed: %v", err)
+	}
+	if _, err := store.AddBinaryAttachment(session.ID, "pic.png", "/tmp/pic.png", "image/png", []byte("secret image")); err != nil {
+		t.Fatalf("AddBinaryAttachment failed: %v", err)
+	}
+	if _, err := store.AddSummary(session.ID, "a", "b", "secret summary", 100, 10); err != nil {
+		t.Fatalf("AddSummary failed: %v", err)
+	}
+
+	if store.IsEncrypted() {
+		t.Fatal("expected a new database to be unencrypted")
+	}
+	if err := store.Encrypt("correct horse"); err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if err := store.Encrypt("again"); err == nil {
+		t.Error("expected encrypting twice to fail")
+	}
+
+	// Content added afterwards is encrypted too
+	if _, err := store.AddAssistantMessage(session.ID, "secret answer", "secret reasoning", nil, ResponseMeta{}); err != nil {
+		t.Fatalf("AddAssistantMessage failed: %v", err)
+	}
+	store.Close()
+
+	// No plaintext is left anywhere in the file
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read database: %v", err)
+	}
+	if wal, err := os.ReadFile(dbPath + "-wal"); err == nil {
+		data = append(data, wal...)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Error("expected no plaintext content in the database file")
+	}
+
+	store, err = New(dbPath)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	if !store.IsEncrypted() || !store.IsLocked() {
+		t.Fatal("expected a reopened encrypted database to be locked")
+	}
+	if _, err := store.GetMessages(session.ID); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked before unlocking, got %v", err)
+	}
+	if _, err := store.AddMessage(session.ID, RoleUser, "leak"); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected writes to fail before unlocking, got %v", err)
+	}
+	if err := store.Unlock("wrong"); err != ErrWrongPassphrase {
+		t.Errorf("expected ErrWrongPassphrase, got %v", err)
+	}
+	if err := store.Unlock("correct horse"); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	got, err := store.GetSession(session.ID)
+	if err != nil || got.SystemPrompt != "secret prompt" {
+		t.Errorf("expected decrypted system prompt, got %q (%v)", got.SystemPrompt, err)
+	}
+	messages, err := store.GetMessages(session.ID)
+	if err != nil {
+		t.Fatalf("GetMessages failed: %v", err)
+	}
+	if len(messages) != 2 || messages[0].Content != "secret question" ||
+		messages[1].Content != "secret answer" || messages[1].Reasoning != "secret reasoning" {
+		t.Errorf("expected decrypted messages, got %+v", messages)
+	}
+	attachments, err := store.GetAttachments(session.ID)
+	if err != nil || len(attachments) != 2 {
+		t.Fatalf("expected 2 attachments, got %d (%v)", len(attachments), err)
+	}
+	if attachments[0].Content != "secret notes" || string(attachments[1].Data) != "secret image" {
+		t.Errorf("expected decrypted attachments, got %q and %q", attachments[0].Content, attachments[1].Data)
+	}
+	if sum, err := store.GetLatestSummary(session.ID); err != nil || sum.SummaryContent != "secret summary" {
+		t.Errorf("expected decrypted summary, got %+v (%v)", sum, err)
+	}
+
+	// Search decrypts messages to match them
+	results, err := store.FullTextSearch("ANSWER", 10)
+	if err != nil {
+		t.Fatalf("FullTextSearch failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Content != "secret answer" {
+		t.Errorf("expected 1 decrypted search result, got %+v", results)
+	}
+
+	// A value copied into another row no longer decrypts
+	if _, err := store.db.Exec(`UPDATE messages SET content = (SELECT content FROM messages WHERE id = ?) WHERE id = ?`,
+		messages[1].ID, messages[0].ID); err != nil {
+		t.Fatalf("failed to copy content: %v", err)
+	}
+	if _, err := store.GetMessages(session.ID); err == nil {
+		t.Error("expected content copied from another message to fail to decrypt")
+	}
+}
+
+func TestEncryptionLeavesNoReplyTextInColumns(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	store, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	const reply = "the quokka answer"
+	citations := []Citation{{
+		Title: "Source",
+		URI:   "https://example.com",
+		Spans: []CitationSpan{{Start: 0, End: len(reply), Text: reply}},
+	}}
+
+	session, err := store.CreateSession("Private", "openai", "gpt-4o", "")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	session.JSONSchema = `{"description":"` + reply + `"}`
+	if err := store.UpdateSession(session); err != nil {
+		t.Fatalf("UpdateSession failed: %v", err)
+	}
+	if _, err := store.AddAssistantMessage(session.ID, reply, "", citations, ResponseMeta{}); err != nil {
+		t.Fatalf("AddAssistantMessage failed: %v", err)
+	}
+	if _, err := store.AddToolMessage(session.ID, "call_1", "echo", `{"text":"`+reply+`"}`, "ok"); err != nil {
+		t.Fatalf("AddToolMessage failed: %v", err)
+	}
+
+	if err := store.Encrypt("correct horse"); err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	// Content added afterwards is encrypted in every column too
+	if _, err := store.AddAssistantMessage(session.ID, reply, "", citations, ResponseMeta{}); err != nil {
+		t.Fatalf("AddAssistantMessage failed: %v", err)
+	}
+	if _, err := store.AddToolMessage(session.ID, "call_2", "echo", `{"text":"`+reply+`"}`, "ok"); err != nil {
+		t.Fatalf("AddToolMessage failed: %v", err)
+	}
+	if err := store.UpdateSession(session); err != nil {
+		t.Fatalf("UpdateSession failed: %v", err)
+	}
+
+	messages, err := store.GetMessages(session.ID)
+	if err != nil || len(messages) != 4 {
+		t.Fatalf("expected 4 messages, got %d (%v)", len(messages), err)
+	}
+	if len(messages[2].Citations) != 1 || messages[2].Citations[0].Spans[0].Text != reply {
+		t.Errorf("expected decrypted citations, got %+v", messages[2].Citations)
+	}
+	if messages[3].ToolArguments != `{"text":"`+reply+`"}` {
+		t.Errorf("expected decrypted tool arguments, got %q", messages[3].ToolArguments)
+	}
+	if got, err := store.GetSession(session.ID); err != nil || got.JSONSchema != session.JSONSchema {
+		t.Errorf("expected decrypted JSON schema, got %+v (%v)", got, err)
+	}
+	store.Close()
+
+	// Read every column of every table straight from the file
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table'")
+	if err != nil {
+		t.Fatalf("failed to list tables: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("failed to scan table name: %v", err)
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+
+	for _, table := range tables {
+		rows, err := db.Query(fmt.Sprintf("SELECT * FROM %q", table))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", table, err)
+		}
+		columns, _ := rows.Columns()
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(ptrs...); err != nil {
+				t.Fatalf("failed to scan %s: %v", table, err)
+			}
+			for i, v := range values {
+				var text string
+				switch v := v.(type) {
+				case string:
+					text = v
+				case []byte:
+					text = string(v)
+				}
+				if strings.Contains(strings.ToLower(text), "quokka") {
+					t.Errorf("expected no reply text in %s.%s, got %q", table, columns[i], text)
+				}
+			}
+		}
+		rows.Close()
+	}
+}
+
 func TestAddMessage(t *testing.T) {
 	store, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -262,6 +752,217 @@ func TestGetMessages(t *testing.T) {
 	}
 }
 
+func TestAddToolMessage(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session, err := store.CreateSession("Test Session", "openai", "gpt-4o", "")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	msg, err := store.AddToolMessage(session.ID, "call_1", "current_time", `{"timezone":"UTC"}`, "2025-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("AddToolMessage failed: %v", err)
+	}
+	if msg.Role != RoleTool {
+		t.Errorf("expected role 'tool', got '%s'", msg.Role)
+	}
+
+	retrieved, err := store.GetMessage(msg.ID)
+	if err != nil {
+		t.Fatalf("GetMessage failed: %v", err)
+	}
+	if retrieved.ToolCallID != "call_1" {
+		t.Errorf("expected tool call ID 'call_1', got '%s'", retrieved.ToolCallID)
+	}
+	if retrieved.ToolName != "current_time" {
+		t.Errorf("expected tool name 'current_time', got '%s'", retrieved.ToolName)
+	}
+	if retrieved.ToolArguments != `{"timezone":"UTC"}` {
+		t.Errorf("unexpected tool arguments: %s", retrieved.ToolArguments)
+	}
+	if retrieved.Content != "2025-01-01T00:00:00Z" {
+		t.Errorf("unexpected tool result: %s", retrieved.Content)
+	}
+}
+
+func TestAddAssistantMessage(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session, err := store.CreateSession("Test Session", "openai", "gpt-4o", "")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	meta := ResponseMeta{
+		Provider:         "openai",
+		Model:            "gpt-4o-2024-08-06",
+		PromptTokens:     120,
+		CompletionTokens: 45,
+		ThinkingTokens:   10,
+		CacheReadTokens:  100,
+		FinishReason:     "stop",
+		Latency:          1500 * time.Millisecond,
+		TimeToFirstToken: 300 * time.Millisecond,
+	}
+	msg, err := store.AddAssistantMessage(session.ID, "Hello!", "The user greeted me.", nil, meta)
+	if err != nil {
+		t.Fatalf("AddAssistantMessage failed: %v", err)
+	}
+	if msg.Role != RoleAssistant {
+		t.Errorf("expected role 'assistant', got '%s'", msg.Role)
+	}
+
+	messages, err := store.GetMessages(session.ID)
+	if err != nil {
+		t.Fatalf("GetMessages failed: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	if messages[0].Meta != meta {
+		t.Errorf("unexpected metadata: %+v", messages[0].Meta)
+	}
+	if messages[0].Content != "Hello!" || messages[0].Reasoning != "The user greeted me." {
+		t.Errorf("expected reasoning stored apart from content, got %q / %q", messages[0].Content, messages[0].Reasoning)
+	}
+	if !strings.Contains(meta.String(), "120 in (100 cached), 45 out (10 thinking)") {
+		t.Errorf("unexpected metadata line: %s", meta.String())
+	}
+
+	// Citations are stored with the reply and annotate its content
+	citations := []Citation{
+		{Title: "go.dev", URI: "https://go.dev", Spans: []CitationSpan{{Start: 0, End: 2, Text: "Go"}}},
+		{URI: "https://example.com", Spans: []CitationSpan{{Start: 0, End: 2, Text: "Go"}, {Start: 3, End: 99}}},
+	}
+	cited, err := store.AddAssistantMessage(session.ID, "Go is fun", "", citations, ResponseMeta{})
+	if err != nil {
+		t.Fatalf("AddAssistantMessage failed: %v", err)
+	}
+	messages, _ = store.GetMessages(session.ID)
+	if got := messages[len(messages)-1]; got.ID != cited.ID || len(got.Citations) != 2 || got.Citations[1].Label() != "https://example.com" {
+		t.Fatalf("unexpected stored citations: %+v", got.Citations)
+	}
+	annotated := AnnotateCitations("Go is fun", messages[len(messages)-1].Citations, func(n int, _ Citation) string {
+		return fmt.Sprintf("[%d]", n)
+	})
+	if annotated != "Go[1][2] is fun" {
+		t.Errorf("unexpected annotated content: %s", annotated)
+	}
+
+	cacheUsage, err := store.GetCacheUsage(session.ID)
+	if err != nil {
+		t.Fatalf("GetCacheUsage failed: %v", err)
+	}
+	if len(cacheUsage) != 1 || cacheUsage[0].ReadTokens != 100 || cacheUsage[0].Model != meta.Model {
+		t.Errorf("unexpected cache usage: %+v", cacheUsage)
+	}
+
+	// Messages saved without metadata read back as zero
+	userMsg, err := store.AddMessage(session.ID, RoleUser, "Hi")
+	if err != nil {
+		t.Fatalf("AddMessage failed: %v", err)
+	}
+	retrieved, err := store.GetMessage(userMsg.ID)
+	if err != nil {
+		t.Fatalf("GetMessage failed: %v", err)
+	}
+	if !retrieved.Meta.IsZero() {
+		t.Errorf("expected no metadata, got %+v", retrieved.Meta)
+	}
+}
+
+func TestCostTotals(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	s1, _ := store.CreateSession("One", "openai", "gpt-4o", "")
+	s2, _ := store.CreateSession("Two", "anthropic", "claude-sonnet-4", "")
+
+	store.RecordCost(s1.ID, "openai", "gpt-4o", 0.25)
+	store.RecordCost(s1.ID, "openai", "gpt-4o", 0.5)
+	store.RecordCost(s2.ID, "anthropic", "claude-sonnet-4", 1)
+	store.RecordCost(s2.ID, "anthropic", "claude-sonnet-4", 0)
+	store.AddMessage(s2.ID, RoleUser, "d")
+
+	cost, err := store.GetSessionCost(s1.ID)
+	if err != nil {
+		t.Fatalf("GetSessionCost failed: %v", err)
+	}
+	if cost != 0.75 {
+		t.Errorf("expected session cost 0.75, got %v", cost)
+	}
+
+	since := time.Now().Add(-time.Hour)
+	if cost, _ := store.GetCostSince(since, ""); cost != 1.75 {
+		t.Errorf("expected total cost 1.75, got %v", cost)
+	}
+	if cost, _ := store.GetCostSince(since, "anthropic"); cost != 1 {
+		t.Errorf("expected anthropic cost 1, got %v", cost)
+	}
+	if cost, _ := store.GetCostSince(time.Now().Add(time.Hour), ""); cost != 0 {
+		t.Errorf("expected no cost in the future, got %v", cost)
+	}
+
+	// Spending outlives the messages and sessions it was made for
+	if err := store.ClearMessages(s2.ID); err != nil {
+		t.Fatalf("ClearMessages failed: %v", err)
+	}
+	if err := store.TrashSession(s1.ID); err != nil {
+		t.Fatalf("TrashSession failed: %v", err)
+	}
+	if _, err := store.PurgeTrash(time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("PurgeTrash failed: %v", err)
+	}
+	if cost, _ := store.GetCostSince(since, ""); cost != 1.75 {
+		t.Errorf("expected total cost 1.75 after clearing and purging, got %v", cost)
+	}
+
+	if s := FormatCost(0.0012); s != "$0.0012" {
+		t.Errorf("unexpected small cost format: %s", s)
+	}
+	if s := FormatCost(3.456); s != "$3.46" {
+		t.Errorf("unexpected cost format: %s", s)
+	}
+}
+
+func TestAddBinaryAttachment(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session, err := store.CreateSession("Test Session", "openai", "gpt-4o", "")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	data := []byte{0x89, 'P', 'N', 'G', 0x00, 0x01}
+	if _, err := store.AddBinaryAttachment(session.ID, "shot.png", "/tmp/shot.png", "image/png", data); err != nil {
+		t.Fatalf("AddBinaryAttachment failed: %v", err)
+	}
+	if _, err := store.AddAttachment(session.ID, "notes.txt", "/tmp/notes.txt", "notes", "text/plain", 5); err != nil {
+		t.Fatalf("AddAttachment failed: %v", err)
+	}
+
+	atts, err := store.GetActiveAttachments(session.ID)
+	if err != nil {
+		t.Fatalf("GetActiveAttachments failed: %v", err)
+	}
+	if len(atts) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(atts))
+	}
+	if !atts[0].IsBinary() || string(atts[0].Data) != string(data) {
+		t.Errorf("expected image bytes to round-trip, got %v", atts[0].Data)
+	}
+	if atts[0].SizeBytes != int64(len(data)) {
+		t.Errorf("expected size %d, got %d", len(data), atts[0].SizeBytes)
+	}
+	if atts[1].IsBinary() || atts[1].Content != "notes" {
+		t.Errorf("expected text attachment, got %+v", atts[1])
+	}
+}
+
 func TestGetLastNMessages(t *testing.T) {
 	store, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -299,6 +1000,94 @@ func TestGetLastNMessages(t *testing.T) {
 	}
 }
 
+func TestMessageBranches(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session, err := store.CreateSession("Test Session", "openai", "gpt-4o", "")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	add := func(role Role, content string) *Message {
+		msg, err := store.AddMessage(session.ID, role, content)
+		if err != nil {
+			t.Fatalf("AddMessage failed: %v", err)
+		}
+		return msg
+	}
+	path := func() string {
+		messages, err := store.GetMessages(session.ID)
+		if err != nil {
+			t.Fatalf("GetMessages failed: %v", err)
+		}
+		var contents []string
+		for _, msg := range messages {
+			contents = append(contents, msg.Content)
+		}
+		return strings.Join(contents, ",")
+	}
+
+	u1 := add(RoleUser, "u1")
+	a1 := add(RoleAssistant, "a1")
+	u2 := add(RoleUser, "u2")
+	add(RoleAssistant, "a2")
+	if u2.ParentID != a1.ID || u1.ParentID != "" {
+		t.Errorf("expected messages to be linked in order, got parents %q and %q", u1.ParentID, u2.ParentID)
+	}
+
+	// Editing u2 branches from a1 and hides the old version
+	if err := store.SetActiveLeaf(session.ID, a1.ID); err != nil {
+		t.Fatalf("SetActiveLeaf failed: %v", err)
+	}
+	edited := add(RoleUser, "u2-edited")
+	if got := path(); got != "u1,a1,u2-edited" {
+		t.Errorf("expected edited branch, got %s", got)
+	}
+
+	branches, err := store.GetBranches(session.ID)
+	if err != nil {
+		t.Fatalf("GetBranches failed: %v", err)
+	}
+	if branches[u2.ID] != (Branch{Index: 1, Count: 2}) || branches[edited.ID] != (Branch{Index: 2, Count: 2}) {
+		t.Errorf("expected u2 versions 1/2 and 2/2, got %+v", branches)
+	}
+	if _, ok := branches[u1.ID]; ok {
+		t.Error("expected no branch entry for a message without versions")
+	}
+
+	siblings, err := store.GetSiblings(edited.ID)
+	if err != nil {
+		t.Fatalf("GetSiblings failed: %v", err)
+	}
+	if len(siblings) != 2 || siblings[0].ID != u2.ID {
+		t.Errorf("expected u2 and its edit as siblings, got %d", len(siblings))
+	}
+
+	// Switching back restores the original branch down to its last reply
+	if err := store.SwitchBranch(session.ID, u2.ID); err != nil {
+		t.Fatalf("SwitchBranch failed: %v", err)
+	}
+	if got := path(); got != "u1,a1,u2,a2" {
+		t.Errorf("expected original branch, got %s", got)
+	}
+	if count, _ := store.GetMessageCount(session.ID); count != 4 {
+		t.Errorf("expected 4 messages on the active branch, got %d", count)
+	}
+
+	// Deleting a message relinks the messages after it
+	if err := store.DeleteMessage(a1.ID); err != nil {
+		t.Fatalf("DeleteMessage failed: %v", err)
+	}
+	if got := path(); got != "u1,u2,a2" {
+		t.Errorf("expected a1 removed from the branch, got %s", got)
+	}
+
+	if err := store.SetActiveLeaf(session.ID, "missing"); err == nil {
+		t.Error("expected error for a message outside the session")
+	}
+}
+
 func TestUpdateMessage(t *testing.T) {
 	store, cleanup := setupTestDB(t)
 	defer cleanup()
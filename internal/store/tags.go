@@ -0,0 +1,126 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NormalizeTag returns tag in the form it is stored in: lower case, without
+// a leading '#', with runs of spaces and commas replaced by '-'
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	return strings.Join(strings.FieldsFunc(tag, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	}), "-")
+}
+
+// AddTags tags a session. Tags are normalized with NormalizeTag; tags the
+// session already has are ignored.
+func (s *Store) AddTags(sessionID string, tags ...string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag == "" {
+			continue
+		}
+		_, err := tx.Exec("INSERT OR IGNORE INTO session_tags (session_id, tag) VALUES (?, ?)", sessionID, tag)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to add tag: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RemoveTags removes tags from a session
+func (s *Store) RemoveTags(sessionID string, tags ...string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	for _, tag := range tags {
+		_, err := tx.Exec("DELETE FROM session_tags WHERE session_id = ? AND tag = ?", sessionID, NormalizeTag(tag))
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to remove tag: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SetFolder files a session in a folder, creating the folder if needed. An
+// empty folder takes the session out of its folder. Folders left without
+// sessions are removed.
+func (s *Store) SetFolder(sessionID, folder string) error {
+	folder = strings.TrimSpace(folder)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if folder != "" {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO folders (name) VALUES (?)", folder); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to create folder: %w", err)
+		}
+	}
+
+	_, err = tx.Exec("UPDATE sessions SET folder = NULLIF(?, '') WHERE id = ?", folder, sessionID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to set folder: %w", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM folders WHERE name NOT IN (SELECT folder FROM sessions WHERE folder IS NOT NULL)")
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to remove empty folders: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ListFolders returns the names of all folders in alphabetical order
+func (s *Store) ListFolders() ([]string, error) {
+	rows, err := s.db.Query("SELECT name FROM folders ORDER BY name COLLATE NOCASE")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folders: %w", err)
+	}
+	defer rows.Close()
+
+	var folders []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan folder: %w", err)
+		}
+		folders = append(folders, name)
+	}
+	return folders, rows.Err()
+}
+
+// SetPinned pins a session to the top of the session list, or unpins it
+func (s *Store) SetPinned(sessionID string, pinned bool) error {
+	_, err := s.db.Exec("UPDATE sessions SET pinned = ? WHERE id = ?", pinned, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to pin session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// TrashSession moves a session to the trash. It is left out of session
+// lists and search until it is restored or purged.
+func (s *Store) TrashSession(id string) error {
+	_, err := s.db.Exec("UPDATE sessions SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL",
+		time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to move session to trash: %w", err)
+	}
+	return nil
+}
+
+// RestoreSession moves a session out of the trash
+func (s *Store) RestoreSession(id string) error {
+	_, err := s.db.Exec("UPDATE sessions SET deleted_at = NULL WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to restore session: %w", err)
+	}
+	return nil
+}
+
+// ListTrash returns the sessions in the trash, most recently deleted first
+func (s *Store) ListTrash() ([]*Session, error) {
+	rows, err := s.db.Query(`
+		SELECT ` + sessionColumns + `
+		FROM sessions WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		session, err := s.scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// PurgeTrash permanently deletes the sessions moved to the trash before the
+// given time, with their messages, attachments and summaries, and returns
+// how many were deleted
+func (s *Store) PurgeTrash(before time.Time) (int, error) {
+	result, err := s.db.Exec("DELETE FROM sessions WHERE deleted_at IS NOT NULL AND deleted_at < ?", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge trash: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge trash: %w", err)
+	}
+	return int(n), nil
+}
+
+// ClearMessages deletes every message in a session, on all branches
+func (s *Store) ClearMessages(sessionID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM messages WHERE session_id = ?", sessionID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to clear messages: %w", err)
+	}
+
+	_, err = tx.Exec("UPDATE sessions SET active_leaf_id = '', updated_at = ? WHERE id = ?",
+		time.Now(), sessionID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/user/openchat/internal/provider"
+)
+
+// RegisterBuiltins registers the tools that ship with chatui
+func RegisterBuiltins(r *Registry) {
+	r.Register(provider.Tool{
+		Name:        "current_time",
+		Description: "Get the current local date and time, optionally in a given IANA time zone.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"timezone": {"type": "string", "description": "IANA time zone name, e.g. Europe/Berlin"}
+			}
+		}`),
+	}, currentTime)
+}
+
+// currentTime returns the current time in RFC 3339 format
+func currentTime(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	now := time.Now()
+	if args.Timezone != "" {
+		loc, err := time.LoadLocation(args.Timezone)
+		if err != nil {
+			return "", fmt.Errorf("unknown time zone: %s", args.Timezone)
+		}
+		now = now.In(loc)
+	}
+	return now.Format(time.RFC3339), nil
+}
@@ -0,0 +1,73 @@
+// Package tools provides the local tools that models can call when tool
+// calling is enabled.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/user/openchat/internal/provider"
+)
+
+// Handler runs a tool with the JSON arguments supplied by the model and
+// returns the result to send back
+type Handler func(ctx context.Context, arguments json.RawMessage) (string, error)
+
+type tool struct {
+	def     provider.Tool
+	handler Handler
+}
+
+// Registry holds the tools available to models
+type Registry struct {
+	tools map[string]tool
+}
+
+// NewRegistry creates an empty tool registry
+func NewRegistry() *Registry {
+	return &Registry{
+		tools: make(map[string]tool),
+	}
+}
+
+// Register adds a tool, replacing any tool with the same name
+func (r *Registry) Register(def provider.Tool, handler Handler) {
+	r.tools[def.Name] = tool{def: def, handler: handler}
+}
+
+// Definitions returns the tool definitions sorted by name
+func (r *Registry) Definitions() []provider.Tool {
+	defs := make([]provider.Tool, 0, len(r.tools))
+	for _, t := range r.tools {
+		defs = append(defs, t.def)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Name < defs[j].Name
+	})
+	return defs
+}
+
+// Run executes a tool call. Errors are returned as results so the model can
+// see what went wrong and recover.
+func (r *Registry) Run(ctx context.Context, call provider.ToolCall) string {
+	t, ok := r.tools[call.Name]
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %q", call.Name)
+	}
+
+	args := json.RawMessage(call.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if !json.Valid(args) {
+		return "error: arguments are not valid JSON"
+	}
+
+	result, err := t.handler(ctx, args)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/openchat/internal/provider"
+)
+
+func TestRegistryRun(t *testing.T) {
+	r := NewRegistry()
+	r.Register(provider.Tool{Name: "echo"}, func(ctx context.Context, args json.RawMessage) (string, error) {
+		return string(args), nil
+	})
+
+	result := r.Run(context.Background(), provider.ToolCall{Name: "echo", Arguments: `{"a":1}`})
+	if result != `{"a":1}` {
+		t.Errorf("Expected arguments to be echoed, got %s", result)
+	}
+
+	result = r.Run(context.Background(), provider.ToolCall{Name: "echo"})
+	if result != "{}" {
+		t.Errorf("Expected empty arguments to default to {}, got %s", result)
+	}
+
+	result = r.Run(context.Background(), provider.ToolCall{Name: "missing"})
+	if !strings.HasPrefix(result, "error:") {
+		t.Errorf("Expected error for unknown tool, got %s", result)
+	}
+
+	result = r.Run(context.Background(), provider.ToolCall{Name: "echo", Arguments: "{"})
+	if !strings.HasPrefix(result, "error:") {
+		t.Errorf("Expected error for invalid arguments, got %s", result)
+	}
+}
+
+func TestCurrentTime(t *testing.T) {
+	r := NewRegistry()
+	RegisterBuiltins(r)
+
+	defs := r.Definitions()
+	if len(defs) != 1 || defs[0].Name != "current_time" {
+		t.Fatalf("Expected current_time builtin, got %v", defs)
+	}
+
+	result := r.Run(context.Background(), provider.ToolCall{Name: "current_time", Arguments: `{"timezone":"UTC"}`})
+	ts, err := time.Parse(time.RFC3339, result)
+	if err != nil {
+		t.Fatalf("Expected RFC 3339 time, got %s", result)
+	}
+	if _, offset := ts.Zone(); offset != 0 {
+		t.Errorf("Expected UTC offset, got %d", offset)
+	}
+}
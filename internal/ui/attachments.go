@@ -8,9 +8,14 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"github.com/user/openchat/internal/provider"
 	"github.com/user/openchat/internal/store"
 )
 
+// maxImageSize is the largest image accepted by /attach. Images are sent as
+// binary content rather than text, so they get a larger limit.
+const maxImageSize = 5 * 1024 * 1024
+
 // Message types for attachments
 type attachmentsLoadedMsg struct {
 	attachments []*store.Attachment
@@ -24,6 +29,8 @@ type attachmentAddedMsg struct {
 
 type filePreviewMsg struct {
 	content  string
+	data     []byte // Raw bytes for image files
+	mimeType string
 	filename string
 	filepath string
 	size     int64
@@ -67,6 +74,10 @@ func (m *Model) updateAttachments(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "enter": // View content preview
 		if len(m.attachments) > 0 && m.attachmentIndex < len(m.attachments) {
 			att := m.attachments[m.attachmentIndex]
+			if att.IsBinary() {
+				m.attachmentPreview = "Image (" + att.MimeType + ", " + formatSize(att.SizeBytes) + ") - no text preview"
+				return m, nil
+			}
 			m.attachmentPreview = att.Content
 			if len(m.attachmentPreview) > 2000 {
 				m.attachmentPreview = m.attachmentPreview[:2000] + "\n\n... (truncated)"
@@ -132,6 +143,17 @@ func (m *Model) deleteAttachment(id string) tea.Cmd {
 func (m *Model) confirmAttachment() tea.Cmd {
 	att := m.pendingAttachment
 	return func() tea.Msg {
+		if att.IsBinary() {
+			newAtt, err := m.store.AddBinaryAttachment(
+				att.SessionID,
+				att.Filename,
+				att.Filepath,
+				att.MimeType,
+				att.Data,
+			)
+			return attachmentAddedMsg{attachment: newAtt, err: err}
+		}
+
 		newAtt, err := m.store.AddAttachment(
 			att.SessionID,
 			att.Filename,
@@ -178,8 +200,16 @@ func (m *Model) previewFile(path string) tea.Cmd {
 			return filePreviewMsg{err: os.ErrInvalid}
 		}
 
+		// Images are stored as binary attachments with their own size limit
+		mimeType := detectMimeType(absPath)
+		isImage := provider.IsSupportedImageType(mimeType)
+
 		// Check size limit (1MB default)
-		if info.Size() > 1024*1024 {
+		limit := int64(1024 * 1024)
+		if isImage {
+			limit = maxImageSize
+		}
+		if info.Size() > limit {
 			return filePreviewMsg{err: os.ErrInvalid}
 		}
 
@@ -195,8 +225,19 @@ func (m *Model) previewFile(path string) tea.Cmd {
 			return filePreviewMsg{err: err}
 		}
 
+		if isImage {
+			return filePreviewMsg{
+				data:     content,
+				mimeType: mimeType,
+				filename: filepath.Base(absPath),
+				filepath: absPath,
+				size:     info.Size(),
+			}
+		}
+
 		return filePreviewMsg{
 			content:  string(content),
+			mimeType: mimeType,
 			filename: filepath.Base(absPath),
 			filepath: absPath,
 			size:     info.Size(),
@@ -296,15 +337,21 @@ func (m *Model) viewAttachConfirm() string {
 		b.WriteString(mutedTextStyle.Render(formatSize(m.pendingAttachment.SizeBytes)))
 		b.WriteString("\n\n")
 
-		// Preview (first 500 chars)
-		b.WriteString(titleStyle.Render("Content Preview:"))
-		b.WriteString("\n")
-		preview := m.pendingAttachment.Content
-		if len(preview) > 500 {
-			preview = preview[:500] + "\n... (truncated)"
+		if m.pendingAttachment.IsBinary() {
+			b.WriteString("Type: ")
+			b.WriteString(mutedTextStyle.Render(m.pendingAttachment.MimeType + " image"))
+			b.WriteString("\n\n")
+		} else {
+			// Preview (first 500 chars)
+			b.WriteString(titleStyle.Render("Content Preview:"))
+			b.WriteString("\n")
+			preview := m.pendingAttachment.Content
+			if len(preview) > 500 {
+				preview = preview[:500] + "\n... (truncated)"
+			}
+			b.WriteString(mutedTextStyle.Render(preview))
+			b.WriteString("\n\n")
 		}
-		b.WriteString(mutedTextStyle.Render(preview))
-		b.WriteString("\n\n")
 
 		b.WriteString(warningStyle.Render("This content will be sent to the AI when you send messages."))
 		b.WriteString("\n\n")
@@ -0,0 +1,312 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/user/openchat/internal/provider"
+	"github.com/user/openchat/internal/store"
+)
+
+// refreshBranches reloads the version counts of the current session's
+// messages
+func (m *Model) refreshBranches() {
+	m.branches = nil
+	if m.currentSession == nil {
+		return
+	}
+	branches, err := m.store.GetBranches(m.currentSession.ID)
+	if err != nil {
+		m.errorMessage = "Failed to load message versions: " + err.Error()
+		return
+	}
+	m.branches = branches
+}
+
+// selectMessage moves the message selection by delta. Moving down past the
+// last message clears the selection.
+func (m *Model) selectMessage(delta int) {
+	if len(m.messages) == 0 {
+		return
+	}
+	i := m.selectedMessage
+	if i < 0 {
+		if delta > 0 {
+			return
+		}
+		i = len(m.messages)
+	}
+	i += delta
+	switch {
+	case i < 0:
+		i = 0
+	case i >= len(m.messages):
+		i = -1
+	}
+	m.selectedMessage = i
+	m.updateViewportContent()
+}
+
+// branchTarget returns the message the version keys act on: the selected
+// message, or else the last message on the branch that has other versions
+func (m *Model) branchTarget() *store.Message {
+	if m.selectedMessage >= 0 && m.selectedMessage < len(m.messages) {
+		return m.messages[m.selectedMessage]
+	}
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if _, ok := m.branches[m.messages[i].ID]; ok {
+			return m.messages[i]
+		}
+	}
+	return nil
+}
+
+// switchVersion shows the previous (delta -1) or next (delta 1) version of
+// the target message and the conversation that followed it
+func (m *Model) switchVersion(delta int) (tea.Model, tea.Cmd) {
+	if m.currentSession == nil || m.streaming {
+		return m, nil
+	}
+	target := m.branchTarget()
+	if target == nil {
+		m.statusMessage = "No other versions to switch to"
+		return m, nil
+	}
+
+	siblings, err := m.store.GetSiblings(target.ID)
+	if err != nil {
+		m.errorMessage = "Failed to load message versions: " + err.Error()
+		return m, nil
+	}
+	next := -1
+	for i, sibling := range siblings {
+		if sibling.ID == target.ID {
+			next = i + delta
+		}
+	}
+	if next < 0 || next >= len(siblings) {
+		m.statusMessage = "No other versions to switch to"
+		return m, nil
+	}
+
+	chosen := siblings[next]
+	if err := m.store.SwitchBranch(m.currentSession.ID, chosen.ID); err != nil {
+		m.errorMessage = "Failed to switch version: " + err.Error()
+		return m, nil
+	}
+	if err := m.reloadMessages(); err != nil {
+		m.errorMessage = "Failed to load messages: " + err.Error()
+		return m, nil
+	}
+	if m.selectedMessage >= 0 {
+		// Keep the selection on the version now shown
+		for i, msg := range m.messages {
+			if msg.ID == chosen.ID {
+				m.selectedMessage = i
+			}
+		}
+	}
+	m.statusMessage = fmt.Sprintf("Version %d of %d", next+1, len(siblings))
+	m.updateViewportContent()
+	return m, nil
+}
+
+// reloadMessages reloads the current session's active branch and its
+// version counts
+func (m *Model) reloadMessages() error {
+	messages, err := m.store.GetMessages(m.currentSession.ID)
+	if err != nil {
+		return err
+	}
+	m.messages = messages
+	if m.selectedMessage >= len(m.messages) {
+		m.selectedMessage = -1
+	}
+	m.refreshBranches()
+	return nil
+}
+
+// renderBranchLabel renders the selection marker and version counter shown
+// after a message's label, e.g. " ‹ 2/3 ›"
+func (m *Model) renderBranchLabel(i int, msg *store.Message) string {
+	var label string
+	if b, ok := m.branches[msg.ID]; ok {
+		label += " " + branchStyle.Render(fmt.Sprintf("‹ %d/%d ›", b.Index, b.Count))
+	}
+	if i == m.selectedMessage {
+		label += " " + selectedMarkerStyle.Render("◀")
+	}
+	return label
+}
+
+// cmdEdit loads the selected user message, or else the last one, into the
+// input. Sending it adds a new version of that message and continues the
+// conversation from there; the earlier version is kept.
+func (m *Model) cmdEdit() (tea.Model, tea.Cmd) {
+	if m.currentSession == nil {
+		m.errorMessage = "No session selected"
+		return m, nil
+	}
+	if m.streaming {
+		m.errorMessage = "Wait for the reply to finish before editing"
+		return m, nil
+	}
+
+	var target *store.Message
+	if m.selectedMessage >= 0 && m.selectedMessage < len(m.messages) {
+		if msg := m.messages[m.selectedMessage]; msg.Role == store.RoleUser {
+			target = msg
+		}
+	}
+	if target == nil {
+		target = lastUserMessage(m.messages)
+	}
+	if target == nil {
+		m.errorMessage = "No message to edit"
+		return m, nil
+	}
+
+	m.editing = target
+	m.textarea.SetValue(target.Content)
+	m.textarea.Focus()
+	m.statusMessage = "Editing message: Ctrl+Enter sends it as a new version, Esc cancels"
+	return m, nil
+}
+
+// cmdRegen generates a new version of the reply to the last prompt, with the
+// current model or the provider/model given, keeping the earlier version.
+// A model given here is used for this reply only; the default is unchanged.
+func (m *Model) cmdRegen(args []string) (tea.Model, tea.Cmd) {
+	if m.currentSession == nil {
+		m.errorMessage = "No session selected"
+		return m, nil
+	}
+	if m.streaming {
+		m.errorMessage = "Wait for the reply to finish before regenerating"
+		return m, nil
+	}
+	if lastUserMessage(m.messages) == nil {
+		m.errorMessage = "No reply to regenerate"
+		return m, nil
+	}
+
+	// A provider/model given here is used for this reply only
+	providerName, modelName := m.config.GetDefaultProvider(), m.config.GetDefaultModel()
+	if len(args) > 0 {
+		modelName = args[0]
+		if strings.Contains(args[0], "/") {
+			parts := strings.SplitN(args[0], "/", 2)
+			providerName, modelName = parts[0], parts[1]
+		}
+	}
+
+	p, ok := m.registry.Get(providerName)
+	if !ok {
+		if len(args) > 0 {
+			m.errorMessage = "Unknown provider: " + providerName
+		} else {
+			m.errorMessage = "No provider configured. Use /connect to set API key."
+		}
+		return m, nil
+	}
+	if provider.RequiresAPIKey(p) && !m.config.HasAPIKey(providerName) {
+		m.errorMessage = "No API key for " + providerName + ". Use /connect."
+		return m, nil
+	}
+	if len(args) > 0 {
+		m.regenProvider, m.regenModel = providerName, modelName
+	}
+	if m.overHardBudget(providerName) {
+		m.pendingRegen = true
+		m.currentView = ViewBudgetConfirm
+		return m, nil
+	}
+	return m.regenerate()
+}
+
+// regenerate re-runs the last prompt on the active branch. The new reply is
+// added as a sibling of the previous one, which is shown again if the new
+// reply fails or is cancelled.
+func (m *Model) regenerate() (tea.Model, tea.Cmd) {
+	prompt := lastUserMessage(m.messages)
+	if prompt == nil {
+		m.finishRegen()
+		m.errorMessage = "No reply to regenerate"
+		return m, nil
+	}
+	leaf := m.messages[len(m.messages)-1].ID
+	if err := m.branchFrom(prompt.ID); err != nil {
+		m.finishRegen()
+		m.errorMessage = "Failed to regenerate: " + err.Error()
+		return m, nil
+	}
+	m.regenSession, m.regenLeaf = m.currentSession.ID, leaf
+	providerName, modelName := m.turnModel()
+	m.statusMessage = "Regenerating with " + providerName + "/" + modelName
+	m.updateViewportContent()
+
+	// A regenerated turn gets a fresh tool round budget
+	m.toolRounds = 0
+
+	m.streaming = true
+	m.streamContent.Reset()
+	cmd := m.streamResponse(m.buildRequest())
+	if cmd == nil {
+		m.finishRegen()
+	}
+	return m, cmd
+}
+
+// turnModel returns the provider and model the current turn is sent to:
+// the ones given to /regen, or the defaults
+func (m *Model) turnModel() (string, string) {
+	if m.regenProvider != "" {
+		return m.regenProvider, m.regenModel
+	}
+	return m.config.GetDefaultProvider(), m.config.GetDefaultModel()
+}
+
+// finishRegen ends a regeneration. If no message was saved on the new
+// branch, because the reply failed or was cancelled, the previous reply is
+// made active again.
+func (m *Model) finishRegen() {
+	sessionID, leaf := m.regenSession, m.regenLeaf
+	m.regenSession, m.regenLeaf = "", ""
+	m.regenProvider, m.regenModel = "", ""
+	if leaf == "" {
+		return
+	}
+	if err := m.store.SetActiveLeaf(sessionID, leaf); err != nil {
+		m.errorMessage = "Failed to restore the previous reply: " + err.Error()
+		return
+	}
+	if m.currentSession != nil && m.currentSession.ID == sessionID {
+		if err := m.reloadMessages(); err != nil {
+			m.errorMessage = "Failed to reload messages: " + err.Error()
+		}
+		m.updateViewportContent()
+	}
+}
+
+// branchFrom ends the active branch at a message, so the next message added
+// starts a new version of the one that followed it. An empty messageID
+// branches from the start of the session.
+func (m *Model) branchFrom(messageID string) error {
+	if err := m.store.SetActiveLeaf(m.currentSession.ID, messageID); err != nil {
+		return err
+	}
+	m.selectedMessage = -1
+	return m.reloadMessages()
+}
+
+// lastUserMessage returns the last user message in messages, or nil
+func lastUserMessage(messages []*store.Message) *store.Message {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == store.RoleUser {
+			return messages[i]
+		}
+	}
+	return nil
+}
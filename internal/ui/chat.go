@@ -2,7 +2,9 @@ package ui
 
 import (
 	"context"
+	"encoding/json"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 
@@ -27,6 +29,29 @@ func (m *Model) updateChat(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.viewport.LineDown(1)
 		}
 
+	case "ctrl+up":
+		// Select an earlier message for the version keys
+		m.selectMessage(-1)
+
+	case "ctrl+down":
+		m.selectMessage(1)
+
+	case "ctrl+left":
+		// Show the previous version of the selected or last edited message
+		return m.switchVersion(-1)
+
+	case "ctrl+right":
+		return m.switchVersion(1)
+
+	case "ctrl+z":
+		// Restore the session deleted last
+		return m.undoDelete()
+
+	case "ctrl+o":
+		// Expand or collapse the reasoning shown above replies
+		m.showThinking = !m.showThinking
+		m.updateViewportContent()
+
 	case "pgup":
 		m.viewport.HalfViewUp()
 
@@ -95,12 +120,28 @@ func (m *Model) sendToAI(content string) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
-	// Check API key
-	if !m.config.HasAPIKey(m.currentProvider.Name()) {
+	// Check API key (local providers such as Ollama don't need one)
+	if provider.RequiresAPIKey(m.currentProvider) && !m.config.HasAPIKey(m.currentProvider.Name()) {
 		m.errorMessage = "No API key for " + m.currentProvider.Name() + ". Use /connect."
 		return m, nil
 	}
 
+	// Hold the message until the user confirms spending past a hard budget
+	if m.overHardBudget(m.currentProvider.Name()) {
+		m.pendingSend = content
+		m.currentView = ViewBudgetConfirm
+		return m, nil
+	}
+
+	// An edited message becomes a new version next to the original
+	if m.editing != nil {
+		if err := m.branchFrom(m.editing.ParentID); err != nil {
+			m.errorMessage = "Failed to edit message: " + err.Error()
+			return m, nil
+		}
+		m.editing = nil
+	}
+
 	// Save user message
 	userMsg, err := m.store.AddMessage(m.currentSession.ID, store.RoleUser, content)
 	if err != nil {
@@ -108,26 +149,49 @@ func (m *Model) sendToAI(content string) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 	m.messages = append(m.messages, userMsg)
+	m.refreshBranches()
 	m.updateViewportContent()
 
-	// Build request
+	// A new user turn gets a fresh tool round budget
+	m.toolRounds = 0
+
+	// Start streaming
+	m.streaming = true
+	m.streamContent.Reset()
+
+	return m, m.streamResponse(m.buildRequest())
+}
+
+// buildRequest builds a chat request from the current session state
+func (m *Model) buildRequest() provider.ChatRequest {
 	messages := make([]provider.Message, 0, len(m.messages)+10)
 
 	// Add system prompt if exists
 	if m.currentSession.SystemPrompt != "" {
 		messages = append(messages, provider.Message{
-			Role:    provider.RoleSystem,
-			Content: m.currentSession.SystemPrompt,
+			Role:            provider.RoleSystem,
+			Content:         m.currentSession.SystemPrompt,
+			CacheBreakpoint: true,
 		})
 	}
 
-	// Add attached file contents as system context
+	// Add attached file contents as system context; images are sent with
+	// the latest user message since system prompts only accept text
+	var images []*store.Attachment
 	if m.currentSession != nil {
 		attachments, _ := m.store.GetActiveAttachments(m.currentSession.ID)
-		if len(attachments) > 0 {
+		var textAttachments []*store.Attachment
+		for _, att := range attachments {
+			if att.IsBinary() {
+				images = append(images, att)
+			} else {
+				textAttachments = append(textAttachments, att)
+			}
+		}
+		if len(textAttachments) > 0 {
 			var contextBuilder strings.Builder
 			contextBuilder.WriteString("The following files are attached as context:\n\n")
-			for _, att := range attachments {
+			for _, att := range textAttachments {
 				contextBuilder.WriteString("--- File: ")
 				contextBuilder.WriteString(att.Filename)
 				contextBuilder.WriteString(" ---\n")
@@ -136,15 +200,97 @@ func (m *Model) sendToAI(content string) (tea.Model, tea.Cmd) {
 				contextBuilder.WriteString(att.Filename)
 				contextBuilder.WriteString(" ---\n\n")
 			}
+			// The vault rarely changes between turns, so it is worth caching
 			messages = append(messages, provider.Message{
-				Role:    provider.RoleSystem,
-				Content: contextBuilder.String(),
+				Role:            provider.RoleSystem,
+				Content:         contextBuilder.String(),
+				CacheBreakpoint: true,
 			})
 		}
 	}
 
 	// Add conversation history
-	for _, msg := range m.messages {
+	messages = append(messages, buildHistory(m.messages)...)
+	attachImages(messages, images)
+
+	_, modelName := m.turnModel()
+	req := provider.ChatRequest{
+		Model:    modelName,
+		Messages: messages,
+	}
+	if m.currentSession != nil {
+		applyParams(&req, m.currentSession.Params)
+		if m.currentSession.JSONSchema != "" {
+			req.ResponseSchema = &provider.ResponseSchema{Schema: json.RawMessage(m.currentSession.JSONSchema)}
+		}
+	}
+
+	// Only offer tools when the user has opted in
+	if m.config.EnableTools && m.tools != nil {
+		req.Tools = m.tools.Definitions()
+	}
+
+	return req
+}
+
+// buildHistory converts stored messages into provider messages. Each stored
+// tool message holds both the call and its result, so a run of tool messages
+// is expanded into the assistant message that made the calls followed by one
+// result message per call. Each tool-call round is saved as an assistant
+// message, empty when the model sent no text, so rounds stay separate.
+func buildHistory(stored []*store.Message) []provider.Message {
+	messages := make([]provider.Message, 0, len(stored))
+
+	for i := 0; i < len(stored); i++ {
+		msg := stored[i]
+
+		if msg.Role == store.RoleTool {
+			// Collect the run of consecutive tool messages
+			j := i
+			for j < len(stored) && stored[j].Role == store.RoleTool {
+				j++
+			}
+			run := stored[i:j]
+
+			calls := make([]provider.ToolCall, 0, len(run))
+			for _, t := range run {
+				calls = append(calls, provider.ToolCall{
+					ID:        t.ToolCallID,
+					Name:      t.ToolName,
+					Arguments: t.ToolArguments,
+				})
+			}
+
+			// Attach the calls to the assistant text that preceded them
+			last := len(messages) - 1
+			if last >= 0 && messages[last].Role == provider.RoleAssistant && len(messages[last].ToolCalls) == 0 {
+				messages[last].ToolCalls = calls
+			} else {
+				messages = append(messages, provider.Message{
+					Role:      provider.RoleAssistant,
+					ToolCalls: calls,
+				})
+			}
+
+			for _, t := range run {
+				messages = append(messages, provider.Message{
+					Role:       provider.RoleTool,
+					Content:    t.Content,
+					ToolCallID: t.ToolCallID,
+					Name:       t.ToolName,
+				})
+			}
+
+			i = j - 1
+			continue
+		}
+
+		// Skip an empty round whose tool results were never saved
+		if msg.Role == store.RoleAssistant && msg.Content == "" &&
+			(i+1 == len(stored) || stored[i+1].Role != store.RoleTool) {
+			continue
+		}
+
 		// Map summary role to system for the provider
 		role := provider.Role(msg.Role)
 		if msg.Role == store.RoleSummary {
@@ -156,74 +302,258 @@ func (m *Model) sendToAI(content string) (tea.Model, tea.Cmd) {
 		})
 	}
 
-	req := provider.ChatRequest{
-		Model:    m.config.GetDefaultModel(),
-		Messages: messages,
-	}
+	return messages
+}
 
-	// Start streaming
-	m.streaming = true
-	m.streamContent.Reset()
+// attachImages adds image attachments to the last user message
+func attachImages(messages []provider.Message, images []*store.Attachment) {
+	if len(images) == 0 {
+		return
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != provider.RoleUser {
+			continue
+		}
+		parts := make([]provider.ContentPart, 0, len(images)+1)
+		for _, img := range images {
+			parts = append(parts, provider.ImagePart(img.MimeType, img.Data))
+		}
+		messages[i].Parts = append(parts, messages[i].ContentParts()...)
+		return
+	}
+}
 
-	return m, m.streamResponse(req)
+// runTools executes the tool calls requested by the model in the background
+func (m *Model) runTools(sessionID string, calls []provider.ToolCall) tea.Cmd {
+	registry := m.tools
+	return func() tea.Msg {
+		ctx := context.Background()
+		results := make([]toolResult, 0, len(calls))
+		for _, call := range calls {
+			results = append(results, toolResult{
+				call:   call,
+				output: registry.Run(ctx, call),
+			})
+		}
+		return toolResultsMsg{sessionID: sessionID, results: results}
+	}
 }
 
-// streamResponse streams a response from the AI provider
+// streamResponse starts a response from the AI provider in the background.
+// Deltas are delivered to the Update loop over a channel as streamDeltaMsg
+// values, followed by a single streamCompleteMsg, each tagged with the
+// stream's ID.
 func (m *Model) streamResponse(req provider.ChatRequest) tea.Cmd {
-	return func() tea.Msg {
-		ctx, cancel := context.WithCancel(context.Background())
-		m.streamCancel = cancel
+	// Build a provider for this request with the current API key
+	providerName, _ := m.turnModel()
+	prov, ok := m.registry.Build(providerName, m.providerSettings())
+	if !ok {
+		m.streaming = false
+		m.errorMessage = provider.ErrNoAPIKey.Error()
+		return nil
+	}
 
-		// Get fresh provider reference with API key
-		prov, ok := m.registry.Get(m.config.GetDefaultProvider())
-		if !ok {
-			return streamCompleteMsg{err: provider.ErrNoAPIKey}
-		}
-
-		// Set API key on provider
-		apiKey := m.config.GetAPIKey(prov.Name())
-		switch p := prov.(type) {
-		case *provider.OpenAI:
-			p.SetAPIKey(apiKey)
-		case *provider.Anthropic:
-			p.SetAPIKey(apiKey)
-		case *provider.Gemini:
-			p.SetAPIKey(apiKey)
-			// Apply Gemini-specific settings from model state
-			p.SetThinkingEnabled(m.geminiThinking)
-			p.SetSearchEnabled(m.geminiGrounding)
-		}
-
-		if prov.SupportsStreaming() {
-			err := prov.Stream(ctx, req, func(delta string) {
-				// Send delta through program
-				// This is a workaround since we can't directly update model from here
-				// We accumulate in streamContent and signal completion
-			})
+	ctx, cancel := context.WithCancel(context.Background())
+	m.streamCancel = cancel
 
-			// For now, use non-streaming as the stream callback can't easily
-			// send messages back to the Update loop without a channel
-			// TODO: Implement proper streaming with channels
-			if err != nil {
-				return streamCompleteMsg{err: err}
+	// Every call is billed to the session, even if its reply is never saved
+	st, sessionID := m.store, m.currentSession.ID
+
+	m.streamID++
+	ch := make(chan tea.Msg, 64)
+	m.streamCh = ch
+	m.streamReasoning.Reset()
+
+	go func() {
+		defer close(ch)
+
+		// send delivers a message unless the stream has been cancelled, so a
+		// cancelled stream never blocks on a reader that has gone away.
+		send := func(msg tea.Msg) {
+			select {
+			case ch <- msg:
+			case <-ctx.Done():
 			}
 		}
 
-		// Fallback to non-streaming
-		resp, err := prov.Send(ctx, req)
-		if err != nil {
-			return streamCompleteMsg{err: err}
+		// Fallback chains report each switch to the next target
+		fellBack := false
+		ctx := provider.WithFallbackNotice(ctx, func(notice provider.FallbackNotice) {
+			fellBack = true
+			send(fallbackNoticeMsg(notice.String()))
+		})
+		// Reasoning streams apart from the answer
+		ctx = provider.WithReasoningDelta(ctx, func(delta string) {
+			send(reasoningDeltaMsg(delta))
+		})
+
+		var latency, ttft time.Duration
+		attempt := func(req provider.ChatRequest) (provider.ChatResponse, error) {
+			var resp provider.ChatResponse
+			var streamErr error
+			err := retryPolicy(prov).Do(ctx, func(ctx context.Context) error {
+				var streamed strings.Builder
+				var err error
+				// Timings cover the attempt that produced the answer
+				start := time.Now()
+				if prov.SupportsStreaming() {
+					resp, err = prov.Stream(ctx, req, func(delta string) {
+						if streamed.Len() == 0 {
+							ttft = time.Since(start)
+						}
+						streamed.WriteString(delta)
+						send(streamDeltaMsg(delta))
+					})
+				} else {
+					resp, err = prov.Send(ctx, req)
+					ttft = time.Since(start)
+					if err == nil {
+						streamed.WriteString(resp.Content)
+						send(streamDeltaMsg(resp.Content))
+					}
+				}
+				latency = time.Since(start)
+				recordCost(st, sessionID, prov.Name(), req, resp, streamed.String())
+				if err != nil && streamed.Len() > 0 {
+					// Part of the answer is already on screen, so a retry would
+					// duplicate it; report the failure instead
+					streamErr = err
+					return nil
+				}
+				return err
+			}, func(notice provider.RetryNotice) {
+				send(retryNoticeMsg(notice.String()))
+			})
+			if streamErr != nil {
+				err = streamErr
+			}
+			return resp, err
 		}
 
-		return streamContentMsg(resp.Content)
+		resp, err := attempt(req)
+
+		// In JSON mode, a reply that doesn't match the schema is retried
+		// once with the validation errors
+		var schemaErrors []string
+		if err == nil && req.ResponseSchema != nil && len(resp.ToolCalls) == 0 {
+			resp, schemaErrors, err = retryInvalidReply(req, resp, attempt, func(problems []string) {
+				send(schemaRetryMsg(problems))
+			})
+		}
+
+		if resp.Model == "" {
+			resp.Model = req.Model
+		}
+		answeredBy := prov.Name()
+		if resp.Provider != "" {
+			answeredBy = resp.Provider
+		}
+		send(streamCompleteMsg{
+			resp:         resp,
+			provider:     answeredBy,
+			fellBack:     fellBack,
+			latency:      latency,
+			ttft:         ttft,
+			schemaErrors: schemaErrors,
+			err:          err,
+		})
+	}()
+
+	return m.waitForStream()
+}
+
+// providerSettings returns the settings providers are built with for the
+// current session. API keys are resolved by the registry.
+func (m *Model) providerSettings() provider.Settings {
+	return provider.Settings{Search: m.geminiGrounding, Budget: m.budgetCheck()}
+}
+
+// retryPolicy returns how calls to prov are retried. Fallback chains are
+// called once, since they already move past failing targets and a retry
+// would call every target again.
+func retryPolicy(prov provider.Provider) provider.RetryPolicy {
+	if _, ok := provider.Unwrap(prov).(*provider.Fallback); ok {
+		return provider.RetryPolicy{MaxAttempts: 1}
+	}
+	return provider.DefaultRetryPolicy
+}
+
+// waitForStream waits for the next message on the current stream's channel
+// and tags it with the stream's ID
+func (m *Model) waitForStream() tea.Cmd {
+	id, ch := m.streamID, m.streamCh
+	return func() tea.Msg {
+		msg, ok := <-ch
+		if !ok {
+			return nil
+		}
+		return streamMsg{id: id, msg: msg}
 	}
 }
 
 // Message types for async operations
+type streamMsg struct {
+	id  int     // The stream that sent msg
+	msg tea.Msg // One of the stream message types below
+}
 type streamDeltaMsg string
-type streamContentMsg string
+type reasoningDeltaMsg string
+type retryNoticeMsg string
+type fallbackNoticeMsg string
+type schemaRetryMsg []string
 type streamCompleteMsg struct {
-	err error
+	resp         provider.ChatResponse
+	provider     string // The provider that answered
+	fellBack     bool   // A fallback chain moved past its first target
+	latency      time.Duration
+	ttft         time.Duration
+	schemaErrors []string // Why the reply still doesn't match the JSON schema
+	err          error
+}
+
+// meta returns the metadata to store with the reply
+func (msg streamCompleteMsg) meta() store.ResponseMeta {
+	return store.ResponseMeta{
+		Provider:         msg.provider,
+		Model:            msg.resp.Model,
+		PromptTokens:     msg.resp.Usage.PromptTokens,
+		CompletionTokens: msg.resp.Usage.CompletionTokens,
+		ThinkingTokens:   msg.resp.Usage.ThinkingTokens,
+		CacheReadTokens:  msg.resp.Usage.CacheReadTokens,
+		CacheWriteTokens: msg.resp.Usage.CacheWriteTokens,
+		FinishReason:     msg.resp.FinishReason,
+		Latency:          msg.latency,
+		TimeToFirstToken: msg.ttft,
+		Cost:             provider.Cost(msg.provider, msg.resp.Model, msg.resp.Usage),
+	}
+}
+
+// citations returns the reply's citations with their spans located in
+// content, the reply as saved. Spans whose text is no longer found after
+// sanitizing are dropped.
+func (msg streamCompleteMsg) citations(content string) []store.Citation {
+	var citations []store.Citation
+	for _, c := range msg.resp.Citations {
+		citation := store.Citation{Title: c.Title, URI: c.URI}
+		for _, span := range c.Spans {
+			span, ok := span.Locate(content)
+			if !ok {
+				continue
+			}
+			citation.Spans = append(citation.Spans, store.CitationSpan{Start: span.Start, End: span.End, Text: span.Text})
+		}
+		citations = append(citations, citation)
+	}
+	return citations
+}
+
+type toolResult struct {
+	call   provider.ToolCall
+	output string
+}
+type toolResultsMsg struct {
+	sessionID string
+	results   []toolResult
 }
 type errorMsg string
 type sessionCreatedMsg struct {
@@ -240,11 +570,3 @@ type exportCompleteMsg struct {
 	path string
 	err  error
 }
-
-// Update the model to handle streamContentMsg
-func (m *Model) handleStreamContent(content string) tea.Cmd {
-	return func() tea.Msg {
-		m.streamContent.WriteString(content)
-		return streamCompleteMsg{err: nil}
-	}
-}
@@ -0,0 +1,52 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/user/openchat/internal/provider"
+	"github.com/user/openchat/internal/store"
+)
+
+func TestBuildHistoryToolRounds(t *testing.T) {
+	stored := []*store.Message{
+		{Role: store.RoleUser, Content: "weather in Paris and Rome?"},
+		{Role: store.RoleAssistant, Content: "Checking."},
+		{Role: store.RoleTool, ToolCallID: "a", ToolName: "weather", Content: "sunny"},
+		{Role: store.RoleTool, ToolCallID: "b", ToolName: "weather", Content: "rain"},
+		{Role: store.RoleAssistant},
+		{Role: store.RoleTool, ToolCallID: "c", ToolName: "forecast", Content: "clear"},
+		{Role: store.RoleAssistant, Content: "Sunny in Paris, rain in Rome."},
+		{Role: store.RoleAssistant},
+	}
+
+	got := buildHistory(stored)
+	roles := make([]provider.Role, len(got))
+	for i, msg := range got {
+		roles[i] = msg.Role
+	}
+	want := []provider.Role{
+		provider.RoleUser,
+		provider.RoleAssistant, provider.RoleTool, provider.RoleTool,
+		provider.RoleAssistant, provider.RoleTool,
+		provider.RoleAssistant,
+	}
+	if len(roles) != len(want) {
+		t.Fatalf("expected roles %v, got %v", want, roles)
+	}
+	for i := range want {
+		if roles[i] != want[i] {
+			t.Fatalf("expected roles %v, got %v", want, roles)
+		}
+	}
+
+	// Each round keeps its own calls
+	if len(got[1].ToolCalls) != 2 || got[1].Content != "Checking." {
+		t.Errorf("expected first round with text and 2 calls, got %+v", got[1])
+	}
+	if len(got[4].ToolCalls) != 1 || got[4].ToolCalls[0].ID != "c" {
+		t.Errorf("expected second round with 1 call, got %+v", got[4])
+	}
+	if len(got[6].ToolCalls) != 0 {
+		t.Errorf("expected the final reply to carry no calls, got %+v", got[6])
+	}
+}
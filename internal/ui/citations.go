@@ -0,0 +1,35 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/user/openchat/internal/sanitize"
+	"github.com/user/openchat/internal/store"
+)
+
+// renderCitedContent returns a reply's content with a numbered footnote
+// marker after each cited span, e.g. "Go 1.22 was released in 2024.[1]"
+func renderCitedContent(msg *store.Message) string {
+	return store.AnnotateCitations(msg.Content, msg.Citations, func(n int, _ store.Citation) string {
+		return fmt.Sprintf("[%d]", n)
+	})
+}
+
+// renderFootnotes lists a reply's citations under it, numbered to match the
+// markers in its content
+func renderFootnotes(citations []store.Citation) string {
+	if len(citations) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i, c := range citations {
+		line := fmt.Sprintf("[%d] %s", i+1, sanitize.SanitizeForDisplay(c.Label()))
+		if c.Title != "" {
+			line += " · " + sanitize.SanitizeForDisplay(c.URI)
+		}
+		b.WriteString(footnoteStyle.Render(line))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"context"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -23,7 +24,7 @@ func (m *Model) handleCommand(input string) (tea.Model, tea.Cmd) {
 	case "/new":
 		return m.cmdNew(args)
 	case "/switch":
-		return m.cmdSwitch()
+		return m.cmdSwitch(args)
 	case "/connect":
 		return m.cmdConnect(args)
 	case "/model":
@@ -36,6 +37,16 @@ func (m *Model) handleCommand(input string) (tea.Model, tea.Cmd) {
 		return m.cmdClear()
 	case "/delete":
 		return m.cmdDelete()
+	case "/tag":
+		return m.cmdTag(args)
+	case "/pin":
+		return m.cmdPin()
+	case "/folder":
+		return m.cmdFolder(args)
+	case "/trash":
+		return m.cmdTrash()
+	case "/undo":
+		return m.undoDelete()
 	case "/rename":
 		return m.cmdRename(args)
 	case "/system":
@@ -51,9 +62,17 @@ func (m *Model) handleCommand(input string) (tea.Model, tea.Cmd) {
 	case "/context":
 		return m.cmdContext()
 	case "/thinking":
-		return m.cmdThinking()
+		return m.cmdThinking(args)
 	case "/grounding", "/search-grounding":
 		return m.cmdGrounding()
+	case "/set", "/settings":
+		return m.cmdSet(args)
+	case "/edit":
+		return m.cmdEdit()
+	case "/regen", "/regenerate":
+		return m.cmdRegen(args)
+	case "/json":
+		return m.cmdJSON(args)
 	default:
 		m.errorMessage = "Unknown command: " + cmd + ". Type /help for available commands."
 		return m, nil
@@ -81,10 +100,15 @@ func (m *Model) cmdNew(args []string) (tea.Model, tea.Cmd) {
 	}
 }
 
-// cmdSwitch opens the session switcher
-func (m *Model) cmdSwitch() (tea.Model, tea.Cmd) {
+// cmdSwitch opens the session switcher, showing only the sessions with the
+// given tag if there is one
+func (m *Model) cmdSwitch(args []string) (tea.Model, tea.Cmd) {
 	m.currentView = ViewSessions
 	m.sessionIndex = 0
+	m.sessionTag = ""
+	if len(args) > 0 {
+		m.sessionTag = store.NormalizeTag(args[0])
+	}
 	return m, m.loadSessions()
 }
 
@@ -120,6 +144,9 @@ func (m *Model) cmdModel(args []string) (tea.Model, tea.Cmd) {
 				m.config.SetDefaultModel(modelName)
 				m.initProvider()
 				m.statusMessage = "Set provider: " + providerName + ", model: " + modelName
+				if warning := m.paramWarning(); warning != "" {
+					m.statusMessage += " (" + warning + ")"
+				}
 
 				// Update current session if exists
 				if m.currentSession != nil {
@@ -134,6 +161,9 @@ func (m *Model) cmdModel(args []string) (tea.Model, tea.Cmd) {
 			// Just model name - use current provider
 			m.config.SetDefaultModel(args[0])
 			m.statusMessage = "Set model: " + args[0]
+			if warning := m.paramWarning(); warning != "" {
+				m.statusMessage += " (" + warning + ")"
+			}
 
 			if m.currentSession != nil {
 				m.currentSession.Model = args[0]
@@ -175,35 +205,29 @@ func (m *Model) cmdClear() (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
-	// Clear messages from database
-	for _, msg := range m.messages {
-		m.store.DeleteMessage(msg.ID)
+	if err := m.store.ClearMessages(m.currentSession.ID); err != nil {
+		m.errorMessage = "Failed to clear session: " + err.Error()
+		return m, nil
 	}
 
 	m.messages = make([]*store.Message, 0)
+	m.branches = nil
+	m.selectedMessage = -1
+	m.editing = nil
+	m.refreshCosts()
 	m.updateViewportContent()
 	m.statusMessage = "Session cleared"
 	return m, nil
 }
 
-// cmdDelete deletes the current session
+// cmdDelete moves the current session to the trash
 func (m *Model) cmdDelete() (tea.Model, tea.Cmd) {
 	if m.currentSession == nil {
 		m.errorMessage = "No session to delete"
 		return m, nil
 	}
 
-	sessionID := m.currentSession.ID
-	m.currentSession = nil
-	m.messages = make([]*store.Message, 0)
-
-	return m, func() tea.Msg {
-		err := m.store.DeleteSession(sessionID)
-		if err != nil {
-			return errorMsg("Failed to delete session: " + err.Error())
-		}
-		return sessionsLoadedMsg{sessions: nil} // Will trigger reload
-	}
+	return m.trashSession(m.currentSession)
 }
 
 // cmdRename renames the current session
@@ -312,14 +336,14 @@ func (m *Model) loadSession(sessionID string) tea.Cmd {
 
 // loadModels loads available models for the current provider
 func (m *Model) loadModels() tea.Cmd {
+	prov := m.currentProvider
+	m.availableModels = nil
+	if prov == nil {
+		return func() tea.Msg { return errorMsg("No provider selected") }
+	}
 	return func() tea.Msg {
-		if m.currentProvider == nil {
-			return errorMsg("No provider selected")
-		}
-		// Use static model list
-		models, _ := m.currentProvider.Models(nil)
-		m.availableModels = models
-		return nil
+		models, err := m.registry.Models(context.Background(), prov.Name())
+		return modelsLoadedMsg{provider: prov.Name(), models: models, err: err}
 	}
 }
 
@@ -488,10 +512,45 @@ func (m *Model) cmdContext() (tea.Model, tea.Cmd) {
 		}
 	}
 
+	// Add prompt cache info
+	if m.currentSession != nil {
+		if usage, _ := m.store.GetCacheUsage(m.currentSession.ID); len(usage) > 0 {
+			var read, written int
+			var saved float64
+			for _, u := range usage {
+				read += u.ReadTokens
+				written += u.WriteTokens
+				if pricing, ok := provider.LookupPricing(u.Provider, u.Model); ok {
+					saved += pricing.CacheSavings(provider.Usage{
+						CacheReadTokens:  u.ReadTokens,
+						CacheWriteTokens: u.WriteTokens,
+					})
+				}
+			}
+			info.WriteString("\n  Prompt cache: ")
+			info.WriteString(formatInt(read))
+			info.WriteString(" tokens read, ")
+			info.WriteString(formatInt(written))
+			info.WriteString(" written")
+			if saved > 0 {
+				info.WriteString(" (saved ~")
+				info.WriteString(store.FormatCost(saved))
+				info.WriteString(")")
+			}
+		}
+	}
+
 	m.statusMessage = info.String()
 	return m, nil
 }
 
+// modelsLoadedMsg is sent when a provider's model list has been fetched
+type modelsLoadedMsg struct {
+	provider string
+	models   []string
+	err      error
+}
+
 // summarizeRequestMsg is sent when a summary needs to be generated
 type summarizeRequestMsg struct {
 	messages        []*store.Message
@@ -511,28 +570,43 @@ type summarizeCompleteMsg struct {
 	err              error
 }
 
-// cmdThinking toggles Gemini thinking mode
-func (m *Model) cmdThinking() (tea.Model, tea.Cmd) {
-	// Check if current provider is Gemini
-	if m.currentProvider == nil || m.currentProvider.Name() != "gemini" {
-		m.errorMessage = "Thinking mode is only available for Gemini models"
+// cmdThinking sets the session's reasoning effort or budget. Without
+// arguments it toggles reasoning between off and medium effort.
+func (m *Model) cmdThinking(args []string) (tea.Model, tea.Cmd) {
+	if m.currentSession == nil {
+		m.errorMessage = "No session selected"
 		return m, nil
 	}
 
-	// Toggle thinking mode
-	m.geminiThinking = !m.geminiThinking
-
-	// Update the provider
-	if gemini, ok := m.currentProvider.(*provider.Gemini); ok {
-		gemini.SetThinkingEnabled(m.geminiThinking)
+	params := m.currentSession.Params
+	value := "off"
+	switch {
+	case len(args) > 0:
+		value = strings.ToLower(args[0])
+	case params.Reasoning == "":
+		value = "medium"
+	}
+	if value == "off" {
+		value = "default"
+	}
+	if err := params.Set(store.ParamReasoning, value); err != nil {
+		m.errorMessage = err.Error()
+		return m, nil
+	}
+	m.currentSession.Params = params
+	if err := m.store.UpdateSession(m.currentSession); err != nil {
+		m.errorMessage = "Failed to save settings: " + err.Error()
+		return m, nil
 	}
 
-	if m.geminiThinking {
-		m.statusMessage = "Thinking mode enabled (Gemini will show reasoning)"
+	if params.Reasoning == "" {
+		m.statusMessage = "Thinking off"
 	} else {
-		m.statusMessage = "Thinking mode disabled"
+		m.statusMessage = "Thinking: " + params.Reasoning
+	}
+	if warning := m.paramWarning(); warning != "" {
+		m.statusMessage += " (" + warning + ")"
 	}
-
 	return m, nil
 }
 
@@ -544,14 +618,9 @@ func (m *Model) cmdGrounding() (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
-	// Toggle grounding
+	// Toggle grounding; it applies from the next request
 	m.geminiGrounding = !m.geminiGrounding
 
-	// Update the provider
-	if gemini, ok := m.currentProvider.(*provider.Gemini); ok {
-		gemini.SetSearchEnabled(m.geminiGrounding)
-	}
-
 	if m.geminiGrounding {
 		m.statusMessage = "Search grounding enabled (Gemini will use Google Search)"
 	} else {
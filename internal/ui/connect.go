@@ -13,7 +13,7 @@ func (m *Model) updateConnect(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "tab":
 		// Cycle through providers
-		providers := []string{"openai", "anthropic", "groq", "openrouter"}
+		providers := []string{"openai", "anthropic", "gemini", "groq", "openrouter"}
 		for i, p := range providers {
 			if p == m.connectProvider {
 				m.connectProvider = providers[(i+1)%len(providers)]
@@ -77,7 +77,7 @@ func (m *Model) viewConnect() string {
 
 	// Provider selection
 	b.WriteString("Provider: ")
-	providers := []string{"openai", "anthropic", "groq", "openrouter"}
+	providers := []string{"openai", "anthropic", "gemini", "groq", "openrouter"}
 	for _, p := range providers {
 		if p == m.connectProvider {
 			b.WriteString(statusProviderStyle.Render(" " + p + " "))
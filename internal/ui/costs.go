@@ -0,0 +1,202 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/user/openchat/internal/config"
+	"github.com/user/openchat/internal/provider"
+	"github.com/user/openchat/internal/store"
+	"github.com/user/openchat/internal/tokens"
+)
+
+// costTotals holds the spending shown in the status bar
+type costTotals struct {
+	session float64
+	day     float64
+	month   float64
+}
+
+// refreshCosts reloads the session, day and month totals from the store
+func (m *Model) refreshCosts() {
+	now := time.Now()
+	var totals costTotals
+	if m.currentSession != nil {
+		totals.session, _ = m.store.GetSessionCost(m.currentSession.ID)
+	}
+	totals.day, _ = m.store.GetCostSince(config.Budget{Period: "day"}.PeriodStart(now), "")
+	totals.month, _ = m.store.GetCostSince(config.Budget{}.PeriodStart(now), "")
+	m.costs = totals
+}
+
+// recordCost records what a call to a provider was billed. Calls that fail
+// or are cancelled after streaming part of a reply are billed too; when the
+// provider reported no usage for them, it is estimated from the request and
+// the streamed text. It is called from the goroutines that make the calls.
+func recordCost(st *store.Store, sessionID, providerName string, req provider.ChatRequest, resp provider.ChatResponse, streamed string) {
+	if resp.Provider != "" {
+		providerName = resp.Provider
+	}
+	model := resp.Model
+	if model == "" {
+		model = req.Model
+	}
+	usage := resp.Usage
+	if usage == (provider.Usage{}) && streamed != "" {
+		usage = estimateUsage(providerName, req, streamed)
+	}
+	_ = st.RecordCost(sessionID, providerName, model, provider.Cost(providerName, model, usage))
+}
+
+// estimateUsage estimates the tokens of a call the provider reported no
+// usage for
+func estimateUsage(providerName string, req provider.ChatRequest, streamed string) provider.Usage {
+	estimator := tokens.NewEstimator(providerName)
+	prompt := 0
+	for _, msg := range req.Messages {
+		prompt += estimator.EstimateTokens(msg.Content)
+	}
+	completion := estimator.EstimateTokens(streamed)
+	return provider.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+}
+
+// renderCosts renders the spending totals for the status bar
+func (m *Model) renderCosts() string {
+	if m.costs.month == 0 {
+		return ""
+	}
+	return costStyle.Render(fmt.Sprintf("%s · %s today · %s month",
+		store.FormatCost(m.costs.session), store.FormatCost(m.costs.day), store.FormatCost(m.costs.month)))
+}
+
+// budgetSpend returns a provider's budget and what has been spent in its
+// current period
+func (m *Model) budgetSpend(providerName string) (config.Budget, float64, bool) {
+	budget, ok := m.config.GetBudget(providerName)
+	if !ok {
+		return config.Budget{}, 0, false
+	}
+	spent, err := m.store.GetCostSince(budget.PeriodStart(time.Now()), providerName)
+	if err != nil {
+		return config.Budget{}, 0, false
+	}
+	return budget, spent, true
+}
+
+// overHardBudget reports whether sending to a provider should wait for the
+// user to confirm, because its hard budget is spent and not yet overridden
+func (m *Model) overHardBudget(providerName string) bool {
+	if m.budgetOverrides[providerName] {
+		return false
+	}
+	budget, spent, ok := m.budgetSpend(providerName)
+	return ok && budget.Hard > 0 && spent >= budget.Hard
+}
+
+// budgetCheck returns the check a fallback chain makes before calling each
+// of its targets, so a target whose hard budget is spent is skipped. It runs
+// in the stream goroutine, so it keeps its own copy of the overrides.
+func (m *Model) budgetCheck() func(providerName string) error {
+	overrides := make(map[string]bool, len(m.budgetOverrides))
+	for name, allowed := range m.budgetOverrides {
+		overrides[name] = allowed
+	}
+	cfg, st := m.config, m.store
+	return func(providerName string) error {
+		if overrides[providerName] {
+			return nil
+		}
+		budget, ok := cfg.GetBudget(providerName)
+		if !ok || budget.Hard <= 0 {
+			return nil
+		}
+		spent, err := st.GetCostSince(budget.PeriodStart(time.Now()), providerName)
+		if err != nil || spent < budget.Hard {
+			return nil
+		}
+		return fmt.Errorf("%s has spent its %s %s budget: %w",
+			providerName, store.FormatCost(budget.Hard), budgetPeriodName(budget), provider.ErrOverBudget)
+	}
+}
+
+// softBudgetWarning returns a warning once a provider's soft budget is
+// spent, or "" while it is within budget
+func (m *Model) softBudgetWarning(providerName string) string {
+	budget, spent, ok := m.budgetSpend(providerName)
+	if !ok || budget.Soft <= 0 || spent < budget.Soft {
+		return ""
+	}
+	return fmt.Sprintf("%s has spent %s of its %s %s budget",
+		providerName, store.FormatCost(spent), store.FormatCost(budget.Soft), budgetPeriodName(budget))
+}
+
+// budgetPeriodName returns "daily" or "monthly"
+func budgetPeriodName(budget config.Budget) string {
+	if budget.Period == "day" {
+		return "daily"
+	}
+	return "monthly"
+}
+
+// updateBudgetConfirm handles key events in the budget override prompt
+func (m *Model) updateBudgetConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "y", "Y":
+		// Allow this provider past its hard budget until restart
+		content := m.pendingSend
+		m.pendingSend = ""
+		providerName, _ := m.turnModel()
+		m.budgetOverrides[providerName] = true
+		m.currentView = ViewChat
+		m.textarea.Focus()
+		if m.pendingRegen {
+			m.pendingRegen = false
+			return m.regenerate()
+		}
+		return m.sendToAI(content)
+
+	case "n", "N", "esc":
+		// Cancel and give the message back for editing
+		m.textarea.SetValue(m.pendingSend)
+		m.pendingSend = ""
+		m.pendingRegen = false
+		m.regenProvider, m.regenModel = "", ""
+		m.currentView = ViewChat
+		m.textarea.Focus()
+		return m, nil
+	}
+
+	return m, nil
+}
+
+// viewBudgetConfirm renders the budget override prompt
+func (m *Model) viewBudgetConfirm() string {
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("Budget Exceeded"))
+	b.WriteString("\n\n")
+
+	name := m.currentProvider.Name()
+	if budget, spent, ok := m.budgetSpend(name); ok {
+		b.WriteString(fmt.Sprintf("%s has spent %s of its %s %s hard budget.",
+			name, store.FormatCost(spent), store.FormatCost(budget.Hard), budgetPeriodName(budget)))
+		b.WriteString("\n\n")
+	}
+
+	b.WriteString(warningStyle.Render("Sending will add to this spending."))
+	b.WriteString("\n\n")
+
+	b.WriteString("Send anyway and ignore the budget until restart? ")
+	b.WriteString(successStyle.Render("[Y]es"))
+	b.WriteString(" / ")
+	b.WriteString(errorStyle.Render("[N]o"))
+
+	return modalStyle.Width(m.width - 4).Render(b.String())
+}
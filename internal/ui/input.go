@@ -48,6 +48,9 @@ func (m *Model) updateModels(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			}
 
 			m.statusMessage = "Model set to: " + selectedModel
+			if warning := m.paramWarning(); warning != "" {
+				m.statusMessage += " (" + warning + ")"
+			}
 			m.currentView = ViewChat
 			m.textarea.Focus()
 		}
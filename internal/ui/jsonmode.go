@@ -0,0 +1,138 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/user/openchat/internal/jsonschema"
+	"github.com/user/openchat/internal/provider"
+)
+
+// maxSchemaSize limits the size of a /json schema file
+const maxSchemaSize = 256 * 1024
+
+// cmdJSON turns JSON mode on with a schema file, or off with "off"
+func (m *Model) cmdJSON(args []string) (tea.Model, tea.Cmd) {
+	if m.currentSession == nil {
+		m.errorMessage = "No session selected"
+		return m, nil
+	}
+
+	if len(args) == 0 {
+		if m.currentSession.JSONSchema != "" {
+			m.statusMessage = "JSON mode is on. Use /json off to turn it off."
+		} else {
+			m.statusMessage = "JSON mode is off. Use /json <schema-file> to turn it on."
+		}
+		return m, nil
+	}
+
+	path := strings.Join(args, " ")
+	if path == "off" {
+		m.currentSession.JSONSchema = ""
+		m.statusMessage = "JSON mode off"
+	} else {
+		schema, err := loadSchema(path)
+		if err != nil {
+			m.errorMessage = err.Error()
+			return m, nil
+		}
+		m.currentSession.JSONSchema = string(schema.Raw())
+		m.statusMessage = "JSON mode on: replies must match " + filepath.Base(path)
+	}
+
+	if err := m.store.UpdateSession(m.currentSession); err != nil {
+		m.errorMessage = "Failed to save JSON mode: " + err.Error()
+	}
+	return m, nil
+}
+
+// loadSchema reads and compiles a JSON Schema file
+func loadSchema(path string) (*jsonschema.Schema, error) {
+	if !filepath.IsAbs(path) {
+		cwd, _ := os.Getwd()
+		path = filepath.Join(cwd, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	if info.Size() > maxSchemaSize {
+		return nil, fmt.Errorf("schema file is too large (max %d KB)", maxSchemaSize/1024)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	return jsonschema.Compile(data)
+}
+
+// validateReply checks a reply against the request's schema and returns the
+// problems found
+func validateReply(schema *provider.ResponseSchema, reply string) []string {
+	compiled, err := jsonschema.Compile(schema.Schema)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return compiled.Validate([]byte(strings.TrimSpace(reply)))
+}
+
+// schemaRetryRequest returns req followed by the rejected reply and a request
+// to fix it. These messages are not saved to the session.
+func schemaRetryRequest(req provider.ChatRequest, reply string, problems []string) provider.ChatRequest {
+	var feedback strings.Builder
+	feedback.WriteString("Your reply did not match the required JSON schema:\n")
+	for _, p := range problems {
+		feedback.WriteString("- ")
+		feedback.WriteString(p)
+		feedback.WriteString("\n")
+	}
+	feedback.WriteString("Reply again with only a JSON document that matches the schema.")
+
+	retry := req
+	retry.Messages = make([]provider.Message, 0, len(req.Messages)+2)
+	retry.Messages = append(retry.Messages, req.Messages...)
+	retry.Messages = append(retry.Messages,
+		provider.Message{Role: provider.RoleAssistant, Content: reply},
+		provider.Message{Role: provider.RoleUser, Content: feedback.String()},
+	)
+	return retry
+}
+
+// retryInvalidReply retries a JSON mode reply that doesn't match the
+// request's schema once, with the validation errors. notify is called with
+// the errors before retrying. It returns the final reply, with the usage of
+// both attempts, and the problems it still has.
+func retryInvalidReply(req provider.ChatRequest, resp provider.ChatResponse,
+	attempt func(provider.ChatRequest) (provider.ChatResponse, error),
+	notify func(problems []string)) (provider.ChatResponse, []string, error) {
+	problems := validateReply(req.ResponseSchema, resp.Content)
+	if len(problems) == 0 {
+		return resp, nil, nil
+	}
+
+	notify(problems)
+	first := resp
+	resp, err := attempt(schemaRetryRequest(req, first.Content, problems))
+	resp.Usage = addUsage(resp.Usage, first.Usage)
+	if err != nil {
+		return resp, nil, err
+	}
+	return resp, validateReply(req.ResponseSchema, resp.Content), nil
+}
+
+// addUsage sums the token usage of two attempts
+func addUsage(a, b provider.Usage) provider.Usage {
+	return provider.Usage{
+		PromptTokens:     a.PromptTokens + b.PromptTokens,
+		CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+		TotalTokens:      a.TotalTokens + b.TotalTokens,
+		ThinkingTokens:   a.ThinkingTokens + b.ThinkingTokens,
+		CacheReadTokens:  a.CacheReadTokens + b.CacheReadTokens,
+		CacheWriteTokens: a.CacheWriteTokens + b.CacheWriteTokens,
+	}
+}
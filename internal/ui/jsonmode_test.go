@@ -0,0 +1,58 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/user/openchat/internal/provider"
+)
+
+func TestRetryInvalidReply(t *testing.T) {
+	req := provider.ChatRequest{
+		Messages: []provider.Message{{Role: provider.RoleUser, Content: "name?"}},
+		ResponseSchema: &provider.ResponseSchema{
+			Schema: []byte(`{"type": "object", "required": ["name"]}`),
+		},
+	}
+	first := provider.ChatResponse{
+		Content: `{}`,
+		Usage: provider.Usage{
+			PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110,
+			ThinkingTokens: 4, CacheReadTokens: 80, CacheWriteTokens: 20,
+		},
+	}
+
+	var notified []string
+	var retried provider.ChatRequest
+	attempt := func(r provider.ChatRequest) (provider.ChatResponse, error) {
+		retried = r
+		return provider.ChatResponse{
+			Content: `{"name": "Ada"}`,
+			Usage: provider.Usage{
+				PromptTokens: 130, CompletionTokens: 12, TotalTokens: 142,
+				ThinkingTokens: 5, CacheReadTokens: 100, CacheWriteTokens: 30,
+			},
+		}, nil
+	}
+
+	resp, problems, err := retryInvalidReply(req, first, attempt, func(p []string) { notified = p })
+	if err != nil {
+		t.Fatalf("retryInvalidReply failed: %v", err)
+	}
+	if len(notified) == 0 {
+		t.Error("expected the validation errors to be reported before retrying")
+	}
+	if len(retried.Messages) != 3 || retried.Messages[1].Content != `{}` {
+		t.Errorf("expected the retry to include the rejected reply, got %+v", retried.Messages)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected the retried reply to be valid, got %v", problems)
+	}
+
+	want := provider.Usage{
+		PromptTokens: 230, CompletionTokens: 22, TotalTokens: 252,
+		ThinkingTokens: 9, CacheReadTokens: 180, CacheWriteTokens: 50,
+	}
+	if resp.Usage != want {
+		t.Errorf("expected usage of both attempts %+v, got %+v", want, resp.Usage)
+	}
+}
@@ -15,8 +15,12 @@ import (
 	"github.com/user/openchat/internal/sanitize"
 	"github.com/user/openchat/internal/store"
 	"github.com/user/openchat/internal/tokens"
+	"github.com/user/openchat/internal/tools"
 )
 
+// maxToolRounds limits how many times the model may call tools in a single turn
+const maxToolRounds = 5
+
 // View represents the current view mode
 type View int
 
@@ -29,6 +33,9 @@ const (
 	ViewSearch
 	ViewAttachments
 	ViewAttachConfirm
+	ViewBudgetConfirm
+	ViewSettings
+	ViewTrash
 )
 
 // Model is the main Bubble Tea model for the chat UI
@@ -38,6 +45,7 @@ type Model struct {
 	store    *store.Store
 	exporter *exporter.Exporter
 	registry *provider.Registry
+	tools    *tools.Registry
 
 	// Current state
 	currentView     View
@@ -56,6 +64,7 @@ type Model struct {
 	sessions        []*store.Session
 	sessionIndex    int
 	sessionsLoaded  bool
+	sessionTag      string // Tag the session list is filtered by
 
 	// Connect screen state
 	connectProvider string
@@ -67,10 +76,51 @@ type Model struct {
 	availableModels []string
 	modelIndex      int
 
+	// Settings view state
+	settingsIndex int
+
+	// Trash state: sessions in the trash, and the last deleted session while
+	// its undo toast is shown
+	trash          []*store.Session
+	trashIndex     int
+	trashConfirm   bool // Purge pressed once, awaiting confirmation
+	undoSession    *store.Session
+	undoWasCurrent bool
+
+	// Message versions: counts for messages on the active branch that have
+	// siblings, and the message selected with Ctrl+Up/Down (-1 for none)
+	branches        map[string]store.Branch
+	selectedMessage int
+	editing         *store.Message // User message being edited with /edit
+
+	// showThinking expands the reasoning blocks above replies
+	showThinking bool
+
 	// Streaming state
 	streaming       bool
 	streamContent   strings.Builder
+	streamReasoning strings.Builder
 	streamCancel    context.CancelFunc
+	streamCh        <-chan tea.Msg
+	streamID        int // Tags the current stream's messages
+
+	// Tool calling state
+	toolRounds int // Tool rounds used in the current turn
+
+	// Regeneration state: the reply shown before /regen, made active again
+	// if the regenerated reply is never saved, and the provider and model
+	// given to /regen for this turn only
+	regenSession  string
+	regenLeaf     string
+	regenProvider string
+	regenModel    string
+
+	// Cost tracking state
+	costs           costTotals
+	unsavedCost     float64         // Cost of empty replies not yet saved
+	budgetOverrides map[string]bool // Providers allowed past their hard budget
+	pendingSend     string          // Message held by the budget prompt
+	pendingRegen    bool            // /regen held by the budget prompt
 
 	// Status and errors
 	statusMessage string
@@ -97,12 +147,11 @@ type Model struct {
 	attachMaxSize       int64 // Max file size in bytes (default 1MB)
 
 	// Gemini-specific state
-	geminiThinking  bool // Enable thinking mode for Gemini
 	geminiGrounding bool // Enable Google Search grounding for Gemini
 }
 
 // NewModel creates a new chat UI model
-func NewModel(cfg *config.Config, st *store.Store, exp *exporter.Exporter, reg *provider.Registry) *Model {
+func NewModel(cfg *config.Config, st *store.Store, exp *exporter.Exporter, reg *provider.Registry, tl *tools.Registry) *Model {
 	// Initialize textarea
 	ta := textarea.New()
 	ta.Placeholder = "Type your message... (Ctrl+Enter to send, /help for commands)"
@@ -117,6 +166,7 @@ func NewModel(cfg *config.Config, st *store.Store, exp *exporter.Exporter, reg *
 		store:            st,
 		exporter:         exp,
 		registry:         reg,
+		tools:            tl,
 		currentView:      ViewChat,
 		textarea:         ta,
 		messages:         make([]*store.Message, 0),
@@ -124,7 +174,9 @@ func NewModel(cfg *config.Config, st *store.Store, exp *exporter.Exporter, reg *
 		helpText:         generateHelpText(),
 		tokenEstimator:   tokens.NewEstimator(cfg.GetDefaultProvider()),
 		selectedSnippets: make(map[string]bool),
+		budgetOverrides:  make(map[string]bool),
 		attachMaxSize:    1024 * 1024, // 1MB default
+		selectedMessage:  -1,
 	}
 
 	// Set up default provider
@@ -154,6 +206,14 @@ func (m *Model) Init() tea.Cmd {
 func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 
+	// Messages from a cancelled or replaced stream are dropped
+	if sm, ok := msg.(streamMsg); ok {
+		if sm.id != m.streamID {
+			return m, nil
+		}
+		msg = sm.msg
+	}
+
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		// Global key bindings
@@ -161,6 +221,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "ctrl+c":
 			if m.streaming {
 				m.cancelStream()
+				m.finishRegen()
 				return m, nil
 			}
 			return m, tea.Quit
@@ -169,6 +230,10 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 
 		case "esc":
+			if m.currentView == ViewBudgetConfirm {
+				// Give the held message back rather than dropping it
+				return m.updateBudgetConfirm(msg)
+			}
 			if m.currentView != ViewChat {
 				m.currentView = ViewChat
 				m.textarea.Focus()
@@ -176,6 +241,13 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			if m.streaming {
 				m.cancelStream()
+				m.finishRegen()
+				return m, nil
+			}
+			if m.editing != nil {
+				m.editing = nil
+				m.textarea.Reset()
+				m.statusMessage = "Edit cancelled"
 				return m, nil
 			}
 		}
@@ -196,6 +268,12 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updateAttachments(msg)
 		case ViewAttachConfirm:
 			return m.updateAttachConfirm(msg)
+		case ViewBudgetConfirm:
+			return m.updateBudgetConfirm(msg)
+		case ViewSettings:
+			return m.updateSettings(msg)
+		case ViewTrash:
+			return m.updateTrash(msg)
 		case ViewHelp:
 			if msg.String() == "q" || msg.String() == "esc" {
 				m.currentView = ViewChat
@@ -232,40 +310,176 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case sessionsLoadedMsg:
 		m.sessions = msg.sessions
 		m.sessionsLoaded = true
+		if n := len(m.visibleSessions()); m.sessionIndex >= n {
+			m.sessionIndex = max(n-1, 0)
+		}
+
+	case trashLoadedMsg:
+		if msg.err != nil {
+			m.errorMessage = "Failed to load trash: " + msg.err.Error()
+		}
+		m.trash = msg.sessions
+		if m.trashIndex >= len(m.trash) {
+			m.trashIndex = max(len(m.trash)-1, 0)
+		}
+
+	case undoExpiredMsg:
+		m.expireUndo(string(msg))
 
 	case sessionLoadedMsg:
 		if msg.session != nil {
 			m.currentSession = msg.session
 			m.messages = msg.messages
+			m.selectedMessage = -1
+			m.editing = nil
+			m.refreshBranches()
+			m.refreshCosts()
 			m.updateViewportContent()
 		}
 
 	case streamDeltaMsg:
+		// Deltas arriving after a cancel are dropped and stop the read loop
 		if m.streaming {
 			m.streamContent.WriteString(string(msg))
 			m.updateViewportContent()
+			cmds = append(cmds, m.waitForStream())
+		}
+
+	case reasoningDeltaMsg:
+		// The model is thinking before it answers
+		if m.streaming {
+			m.streamReasoning.WriteString(string(msg))
+			m.updateViewportContent()
+			cmds = append(cmds, m.waitForStream())
+		}
+
+	case retryNoticeMsg:
+		// A transient failure is being retried, e.g. "overloaded, retrying in 4s (2/5)"
+		if m.streaming {
+			m.statusMessage = string(msg)
+			cmds = append(cmds, m.waitForStream())
+		}
+
+	case schemaRetryMsg:
+		// The reply didn't match the JSON schema; discard it and show the retry
+		if m.streaming {
+			m.streamContent.Reset()
+			m.streamReasoning.Reset()
+			m.statusMessage = "Reply didn't match the JSON schema, retrying: " + msg[0]
+			m.updateViewportContent()
+			cmds = append(cmds, m.waitForStream())
+		}
+
+	case fallbackNoticeMsg:
+		// The chain moved on, e.g. "anthropic overloaded, falling back to openai/gpt-4o"
+		if m.streaming {
+			m.statusMessage = string(msg)
+			cmds = append(cmds, m.waitForStream())
 		}
 
 	case streamCompleteMsg:
-		m.streaming = false
+		if !m.streaming {
+			// Stream was cancelled; its result is no longer wanted
+			break
+		}
+		// Release the stream context; the goroutine has already finished
+		m.cancelStream()
+		runningTools := false
+		m.statusMessage = ""
 		if msg.err != nil {
 			m.errorMessage = msg.err.Error()
+			m.refreshCosts()
 		} else {
-			// Save assistant message
+			// Run requested tools, but only when the user has enabled them
+			callTools := false
+			if len(msg.resp.ToolCalls) > 0 && m.currentSession != nil {
+				switch {
+				case !m.config.EnableTools || m.tools == nil:
+					m.errorMessage = "Model requested tools but tools are disabled (enable_tools)"
+				case m.toolRounds >= maxToolRounds:
+					m.errorMessage = "Stopped after too many tool calls in one turn"
+				default:
+					callTools = true
+				}
+			}
+
+			// Save assistant message. A tool-call round is saved even without
+			// text so each round's results follow their own assistant row;
+			// other empty replies are not, and their cost is carried into the
+			// next saved reply.
+			meta := msg.meta()
+			meta.Cost += m.unsavedCost
 			content := sanitize.Sanitize(m.streamContent.String())
-			if m.currentSession != nil && content != "" {
-				dbMsg, err := m.store.AddMessage(m.currentSession.ID, store.RoleAssistant, content)
+			reasoning := sanitize.Sanitize(msg.resp.Reasoning)
+			if m.currentSession != nil && (content != "" || callTools) {
+				dbMsg, err := m.store.AddAssistantMessage(m.currentSession.ID, content, reasoning, msg.citations(content), meta)
 				if err == nil {
 					m.messages = append(m.messages, dbMsg)
+					m.refreshBranches()
+					m.regenLeaf = ""
+					meta.Cost = 0
 				}
 			}
+			m.unsavedCost = meta.Cost
+			m.refreshCosts()
+			if msg.fellBack {
+				m.statusMessage = "Answered by fallback " + msg.provider + "/" + msg.resp.Model
+			}
+			if warning := m.softBudgetWarning(msg.provider); warning != "" {
+				m.statusMessage = warning
+			}
+			if len(msg.schemaErrors) > 0 {
+				m.errorMessage = "Reply doesn't match the JSON schema: " + strings.Join(msg.schemaErrors, "; ")
+			}
+
+			if callTools {
+				m.toolRounds++
+				m.statusMessage = "Running tools..."
+				cmds = append(cmds, m.runTools(m.currentSession.ID, msg.resp.ToolCalls))
+				runningTools = true
+			}
+		}
+		if !runningTools {
+			// The turn is over
+			m.finishRegen()
 		}
 		m.streamContent.Reset()
+		m.streamReasoning.Reset()
+		m.updateViewportContent()
+
+	case toolResultsMsg:
+		// Ignore results for a session the user has since left
+		if m.currentSession == nil || m.currentSession.ID != msg.sessionID {
+			break
+		}
+		for _, r := range msg.results {
+			dbMsg, err := m.store.AddToolMessage(msg.sessionID, r.call.ID, r.call.Name, r.call.Arguments, r.output)
+			if err != nil {
+				m.errorMessage = "Failed to save tool result: " + err.Error()
+				break
+			}
+			m.messages = append(m.messages, dbMsg)
+			m.regenLeaf = ""
+		}
+		m.statusMessage = ""
 		m.updateViewportContent()
 
+		// Send the results back to the model
+		m.streaming = true
+		m.streamContent.Reset()
+		if cmd := m.streamResponse(m.buildRequest()); cmd != nil {
+			cmds = append(cmds, cmd)
+		} else {
+			m.finishRegen()
+		}
+
 	case sessionCreatedMsg:
 		m.currentSession = msg.session
 		m.messages = make([]*store.Message, 0)
+		m.branches = nil
+		m.selectedMessage = -1
+		m.editing = nil
+		m.refreshCosts()
 		m.statusMessage = "New session created: " + msg.session.Name
 		cmds = append(cmds, m.loadSessions())
 		m.updateViewportContent()
@@ -323,16 +537,31 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			Filename:  msg.filename,
 			Filepath:  msg.filepath,
 			Content:   msg.content,
+			Data:      msg.data,
 			SizeBytes: msg.size,
-			MimeType:  detectMimeType(msg.filename),
+			MimeType:  msg.mimeType,
 		}
 		m.currentView = ViewAttachConfirm
 
+	case modelsLoadedMsg:
+		// Ignore results for a provider the user has already tabbed away from
+		if m.currentProvider == nil || m.currentProvider.Name() != msg.provider {
+			break
+		}
+		if msg.err != nil {
+			m.errorMessage = "Failed to load models: " + msg.err.Error()
+		}
+		m.availableModels = msg.models
+		if m.modelIndex >= len(m.availableModels) {
+			m.modelIndex = 0
+		}
+
 	case summarizeRequestMsg:
 		// Send the summary request to the AI
 		return m, m.executeSummarize(msg)
 
 	case summarizeCompleteMsg:
+		m.refreshCosts()
 		if msg.err != nil {
 			m.errorMessage = "Summarization failed: " + msg.err.Error()
 		} else {
@@ -388,6 +617,12 @@ func (m *Model) View() string {
 		return m.viewAttachments()
 	case ViewAttachConfirm:
 		return m.viewAttachConfirm()
+	case ViewBudgetConfirm:
+		return m.viewBudgetConfirm()
+	case ViewSettings:
+		return m.viewSettings()
+	case ViewTrash:
+		return m.viewTrash()
 	case ViewHelp:
 		return m.viewHelp()
 	default:
@@ -447,6 +682,11 @@ func (m *Model) renderStatusBar() string {
 		parts = append(parts, contextMeter)
 	}
 
+	// Spending totals
+	if costs := m.renderCosts(); costs != "" {
+		parts = append(parts, costs)
+	}
+
 	// Attachments indicator
 	if m.currentSession != nil {
 		if atts, _ := m.store.GetActiveAttachments(m.currentSession.ID); len(atts) > 0 {
@@ -454,18 +694,19 @@ func (m *Model) renderStatusBar() string {
 		}
 	}
 
+	// JSON mode indicator
+	if m.currentSession != nil && m.currentSession.JSONSchema != "" {
+		parts = append(parts, attachmentIndicatorStyle.Render("{} JSON"))
+	}
+
+	// Reasoning indicator
+	if m.currentSession != nil && m.currentSession.Params.Reasoning != "" {
+		parts = append(parts, geminiFeatureStyle.Render("🧠 "+m.currentSession.Params.Reasoning))
+	}
+
 	// Gemini features indicator
-	if m.currentProvider != nil && m.currentProvider.Name() == "gemini" {
-		var geminiFeatures []string
-		if m.geminiThinking {
-			geminiFeatures = append(geminiFeatures, "🧠")
-		}
-		if m.geminiGrounding {
-			geminiFeatures = append(geminiFeatures, "🔍")
-		}
-		if len(geminiFeatures) > 0 {
-			parts = append(parts, geminiFeatureStyle.Render(strings.Join(geminiFeatures, "")))
-		}
+	if m.currentProvider != nil && m.currentProvider.Name() == "gemini" && m.geminiGrounding {
+		parts = append(parts, geminiFeatureStyle.Render("🔍"))
 	}
 
 	// Streaming indicator
@@ -604,35 +845,54 @@ func (m *Model) renderFooter() string {
 func (m *Model) updateViewportContent() {
 	var content strings.Builder
 
-	for _, msg := range m.messages {
+	for i, msg := range m.messages {
 		switch msg.Role {
 		case store.RoleUser:
 			content.WriteString(userLabelStyle.String())
+			content.WriteString(m.renderBranchLabel(i, msg))
 			content.WriteString("\n")
 			content.WriteString(sanitize.SanitizeForDisplay(msg.Content))
 			content.WriteString("\n\n")
 		case store.RoleAssistant:
 			content.WriteString(assistantLabelStyle.String())
+			content.WriteString(m.renderBranchLabel(i, msg))
+			content.WriteString("\n")
+			content.WriteString(m.renderThinking(msg.Reasoning))
+			content.WriteString(sanitize.SanitizeForDisplay(renderCitedContent(msg)))
+			content.WriteString("\n")
+			content.WriteString(renderFootnotes(msg.Citations))
+			if !msg.Meta.IsZero() {
+				content.WriteString(metaStyle.Render(sanitize.SanitizeForDisplay(msg.Meta.String())))
+				content.WriteString("\n")
+			}
 			content.WriteString("\n")
-			content.WriteString(sanitize.SanitizeForDisplay(msg.Content))
-			content.WriteString("\n\n")
 		case store.RoleSystem:
 			content.WriteString(systemMessageStyle.Render("System: " + sanitize.SanitizeForDisplay(msg.Content)))
 			content.WriteString("\n\n")
 		case store.RoleSummary:
 			content.WriteString(summaryLabelStyle.String())
+			content.WriteString(m.renderBranchLabel(i, msg))
 			content.WriteString("\n")
 			content.WriteString(summaryMessageStyle.Render(sanitize.SanitizeForDisplay(msg.Content)))
 			content.WriteString("\n\n")
+		case store.RoleTool:
+			content.WriteString(toolLabelStyle.Render("🔧 " + sanitize.SanitizeForDisplay(msg.ToolName)))
+			content.WriteString(" ")
+			content.WriteString(systemMessageStyle.Render(sanitize.SanitizeForDisplay(msg.ToolArguments)))
+			content.WriteString(m.renderBranchLabel(i, msg))
+			content.WriteString("\n")
+			content.WriteString(toolMessageStyle.Render(sanitize.SanitizeForDisplay(msg.Content)))
+			content.WriteString("\n\n")
 		}
 	}
 
 	// Streaming content
-	if m.streaming && m.streamContent.Len() > 0 {
+	if m.streaming && (m.streamContent.Len() > 0 || m.streamReasoning.Len() > 0) {
 		content.WriteString(assistantLabelStyle.String())
 		content.WriteString(" ")
 		content.WriteString(streamingStyle.Render("●"))
 		content.WriteString("\n")
+		content.WriteString(m.renderThinking(m.streamReasoning.String()))
 		content.WriteString(sanitize.SanitizeForDisplay(m.streamContent.String()))
 	}
 
@@ -646,6 +906,7 @@ func (m *Model) cancelStream() {
 		m.streamCancel()
 		m.streamCancel = nil
 	}
+	m.streamCh = nil
 	m.streaming = false
 }
 
@@ -658,16 +919,28 @@ func generateHelpText() string {
 │  SESSION COMMANDS                                     │
 │  ────────────────                                     │
 │  /new [name]       Create new chat session            │
-│  /switch           Switch between sessions            │
+│  /switch [tag]     Switch sessions, optionally by tag │
 │  /rename <name>    Rename current session             │
-│  /delete           Delete current session             │
+│  /tag [-]<tag>...  Add tags, or remove with -         │
+│  /pin              Pin or unpin current session       │
+│  /folder [name]    File session in a folder (or off)  │
+│  /delete           Move current session to the trash  │
+│  /trash            Restore or purge deleted sessions  │
+│  /undo             Undo the last delete (or Ctrl+Z)   │
 │  /export           Export session to Markdown         │
+│  /edit             Edit the last or selected prompt   │
+│  /regen [p/model]  Regenerate the last reply          │
 │                                                       │
 │  PROVIDER & MODEL                                     │
 │  ───────────────                                      │
 │  /connect          Set API keys                       │
 │  /model            Select provider/model              │
 │  /system <prompt>  Set system prompt                  │
+│  /set [name value] Generation settings, e.g.          │
+│                    /set temperature 0.2               │
+│  /json <file|off>  Require replies matching a schema  │
+│  /thinking [level] Reasoning effort: low, medium,     │
+│                    high, a token budget, or off       │
 │                                                       │
 │  SEARCH & RECALL                                      │
 │  ──────────────                                       │
@@ -686,7 +959,6 @@ func generateHelpText() string {
 │                                                       │
 │  GEMINI FEATURES                                      │
 │  ───────────────                                      │
-│  /thinking         Toggle thinking mode (reasoning)   │
 │  /grounding        Toggle Google Search grounding     │
 │                                                       │
 │  KEYBINDINGS                                          │
@@ -697,6 +969,9 @@ func generateHelpText() string {
 │  Esc               Close modal / Cancel               │
 │  Up/Down           Scroll chat history                │
 │  PgUp/PgDn         Scroll page up/down                │
+│  Ctrl+O            Expand/collapse thinking           │
+│  Ctrl+Up/Down      Select a message                   │
+│  Ctrl+Left/Right   Switch between message versions    │
 │                                                       │
 │  Press 'q' or Esc to close this help                  │
 ╰───────────────────────────────────────────────────────╯
@@ -727,26 +1002,17 @@ func (m *Model) loadSessionAndJumpTo(sessionID, messageID string) tea.Cmd {
 
 // executeSummarize sends the summarization request to the AI provider
 func (m *Model) executeSummarize(req summarizeRequestMsg) tea.Cmd {
+	// Build the provider here rather than in the background, so the
+	// summary gets its own instance with the current API key
+	prov, ok := m.registry.Build(m.config.GetDefaultProvider(), m.providerSettings())
+	st, sessionID := m.store, m.currentSession.ID
 	return func() tea.Msg {
 		ctx := context.Background()
 
-		// Get provider
-		prov, ok := m.registry.Get(m.config.GetDefaultProvider())
 		if !ok {
 			return summarizeCompleteMsg{err: provider.ErrNoAPIKey}
 		}
 
-		// Set API key
-		apiKey := m.config.GetAPIKey(prov.Name())
-		switch p := prov.(type) {
-		case *provider.OpenAI:
-			p.SetAPIKey(apiKey)
-		case *provider.Anthropic:
-			p.SetAPIKey(apiKey)
-		case *provider.Gemini:
-			p.SetAPIKey(apiKey)
-		}
-
 		// Create the summarization request
 		chatReq := provider.ChatRequest{
 			Model: m.config.GetDefaultModel(),
@@ -758,8 +1024,14 @@ func (m *Model) executeSummarize(req summarizeRequestMsg) tea.Cmd {
 			},
 		}
 
-		// Send request
-		resp, err := prov.Send(ctx, chatReq)
+		// Send request, retrying transient failures
+		var resp provider.ChatResponse
+		err := retryPolicy(prov).Do(ctx, func(ctx context.Context) error {
+			var err error
+			resp, err = prov.Send(ctx, chatReq)
+			recordCost(st, sessionID, prov.Name(), chatReq, resp, resp.Content)
+			return err
+		}, nil)
 		if err != nil {
 			return summarizeCompleteMsg{err: err}
 		}
@@ -825,6 +1097,12 @@ func detectMimeType(filename string) string {
 		return "text/x-sql"
 	case ".csv":
 		return "text/csv"
+	case ".png":
+		return "image/png"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".webp":
+		return "image/webp"
 	default:
 		return "text/plain"
 	}
@@ -10,6 +10,8 @@ import (
 
 // updateSessions handles updates in the sessions view
 func (m *Model) updateSessions(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	sessions := m.visibleSessions()
+
 	switch msg.String() {
 	case "up", "k":
 		if m.sessionIndex > 0 {
@@ -17,18 +19,27 @@ func (m *Model) updateSessions(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 
 	case "down", "j":
-		if m.sessionIndex < len(m.sessions)-1 {
+		if m.sessionIndex < len(sessions)-1 {
 			m.sessionIndex++
 		}
 
 	case "enter":
-		if len(m.sessions) > 0 && m.sessionIndex < len(m.sessions) {
-			selectedSession := m.sessions[m.sessionIndex]
+		if len(sessions) > 0 && m.sessionIndex < len(sessions) {
+			selectedSession := sessions[m.sessionIndex]
 			m.currentView = ViewChat
 			m.textarea.Focus()
 			return m, m.loadSession(selectedSession.ID)
 		}
 
+	case "tab":
+		// Filter by the next tag
+		m.cycleSessionTag()
+
+	case "p":
+		if len(sessions) > 0 && m.sessionIndex < len(sessions) {
+			return m.togglePin(sessions[m.sessionIndex])
+		}
+
 	case "n":
 		// Quick new session
 		m.currentView = ViewChat
@@ -36,24 +47,17 @@ func (m *Model) updateSessions(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.cmdNew(nil)
 
 	case "d":
-		// Delete selected session
-		if len(m.sessions) > 0 && m.sessionIndex < len(m.sessions) {
-			sessionToDelete := m.sessions[m.sessionIndex]
-			// Don't delete if it's the current session
-			if m.currentSession != nil && sessionToDelete.ID == m.currentSession.ID {
-				m.currentSession = nil
-				m.messages = nil
-			}
-			return m, func() tea.Msg {
-				err := m.store.DeleteSession(sessionToDelete.ID)
-				if err != nil {
-					return errorMsg("Failed to delete: " + err.Error())
-				}
-				sessions, _ := m.store.ListSessions()
-				return sessionsLoadedMsg{sessions: sessions}
-			}
+		// Move the selected session to the trash
+		if len(sessions) > 0 && m.sessionIndex < len(sessions) {
+			return m.trashSession(sessions[m.sessionIndex])
 		}
 
+	case "t":
+		return m.cmdTrash()
+
+	case "ctrl+z":
+		return m.undoDelete()
+
 	case "esc", "q":
 		m.currentView = ViewChat
 		m.textarea.Focus()
@@ -69,6 +73,9 @@ func (m *Model) viewSessions() string {
 	// Title
 	title := sessionListTitleStyle.Render("📚 Sessions")
 	b.WriteString(title)
+	if m.sessionTag != "" {
+		b.WriteString(" " + mutedStyle("#"+m.sessionTag))
+	}
 	b.WriteString("\n\n")
 
 	if !m.sessionsLoaded {
@@ -76,44 +83,61 @@ func (m *Model) viewSessions() string {
 		return modalStyle.Width(m.width - 4).Render(b.String())
 	}
 
+	groups := m.sessionGroups()
 	if len(m.sessions) == 0 {
 		b.WriteString(mutedStyle("No sessions yet. Press 'n' to create one."))
+	} else if len(groups) == 0 {
+		b.WriteString(mutedStyle("No sessions tagged #" + m.sessionTag + ". Press Tab for the next tag."))
 	} else {
-		// Session list
-		for i, session := range m.sessions {
-			// Format: [index] Name (provider/model) - message count
-			messageCount, _ := m.store.GetMessageCount(session.ID)
-			item := fmt.Sprintf("%s (%s/%s) - %d messages",
-				session.Name,
-				session.Provider,
-				truncateString(session.Model, 20),
-				messageCount,
-			)
-
-			// Highlight current session
-			isCurrent := m.currentSession != nil && session.ID == m.currentSession.ID
-
-			if i == m.sessionIndex {
-				// Selected
-				marker := "▶ "
-				if isCurrent {
-					marker = "▶★"
+		// Session list, grouped under pins and folders
+		i := 0
+		for g, group := range groups {
+			if group.title != "" {
+				if g > 0 {
+					b.WriteString("\n")
 				}
-				b.WriteString(sessionSelectedStyle.Render(marker + item))
-			} else {
-				// Not selected
-				marker := "  "
-				if isCurrent {
-					marker = " ★"
+				b.WriteString(sessionGroupStyle.Render(group.title))
+				b.WriteString("\n")
+			}
+			for _, session := range group.sessions {
+				// Format: [index] Name (provider/model) - message count #tags
+				messageCount, _ := m.store.GetMessageCount(session.ID)
+				item := fmt.Sprintf("%s (%s/%s) - %d messages",
+					session.Name,
+					session.Provider,
+					truncateString(session.Model, 20),
+					messageCount,
+				)
+				if len(session.Tags) > 0 {
+					item += " #" + strings.Join(session.Tags, " #")
+				}
+
+				// Highlight current session
+				isCurrent := m.currentSession != nil && session.ID == m.currentSession.ID
+
+				if i == m.sessionIndex {
+					// Selected
+					marker := "▶ "
+					if isCurrent {
+						marker = "▶★"
+					}
+					b.WriteString(sessionSelectedStyle.Render(marker + item))
+				} else {
+					// Not selected
+					marker := "  "
+					if isCurrent {
+						marker = " ★"
+					}
+					b.WriteString(sessionItemStyle.Render(marker + item))
 				}
-				b.WriteString(sessionItemStyle.Render(marker + item))
+				b.WriteString("\n")
+				i++
 			}
-			b.WriteString("\n")
 		}
 	}
 
 	b.WriteString("\n")
-	b.WriteString(helpStyle.Render("↑/↓: Navigate | Enter: Select | n: New | d: Delete | Esc: Back"))
+	b.WriteString(helpStyle.Render("↑/↓: Navigate | Enter: Select | Tab: Filter by tag | p: Pin | n: New | d: Delete | t: Trash | Ctrl+Z: Undo | Esc: Back"))
 
 	return modalStyle.Width(m.width - 4).Render(b.String())
 }
@@ -0,0 +1,179 @@
+package ui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/user/openchat/internal/provider"
+	"github.com/user/openchat/internal/store"
+)
+
+// cmdSet sets a generation parameter for the current session, or opens the
+// settings view when called without arguments
+func (m *Model) cmdSet(args []string) (tea.Model, tea.Cmd) {
+	if m.currentSession == nil {
+		m.errorMessage = "No session selected"
+		return m, nil
+	}
+
+	if len(args) == 0 {
+		m.currentView = ViewSettings
+		m.settingsIndex = 0
+		return m, nil
+	}
+
+	name := strings.ToLower(strings.ReplaceAll(args[0], "-", "_"))
+	if len(args) < 2 {
+		m.errorMessage = "Usage: /set <" + strings.Join(store.ParamNames, "|") + "> <value|default>"
+		return m, nil
+	}
+
+	params := m.currentSession.Params
+	if err := params.Set(name, strings.Join(args[1:], " ")); err != nil {
+		m.errorMessage = err.Error()
+		return m, nil
+	}
+	m.currentSession.Params = params
+	if err := m.store.UpdateSession(m.currentSession); err != nil {
+		m.errorMessage = "Failed to save settings: " + err.Error()
+		return m, nil
+	}
+
+	if value := params.Get(name); value != "" {
+		m.statusMessage = name + " set to " + value
+	} else {
+		m.statusMessage = name + " reset to the provider default"
+	}
+	if warning := m.paramWarning(); warning != "" {
+		m.statusMessage += " (" + warning + ")"
+	}
+	return m, nil
+}
+
+// applyParams copies a session's generation parameters onto a request
+func applyParams(req *provider.ChatRequest, params store.GenerationParams) {
+	req.Temperature = params.Temperature
+	req.TopP = params.TopP
+	req.MaxTokens = params.MaxTokens
+	req.Stop = params.Stop
+	req.Seed = params.Seed
+	req.FrequencyPenalty = params.FrequencyPenalty
+	if params.Reasoning != "" {
+		req.Reasoning = &provider.Reasoning{
+			Effort:       params.ReasoningEffort(),
+			BudgetTokens: params.ReasoningBudget(),
+		}
+	}
+}
+
+// unsupportedParams returns the session parameters the current model ignores
+func (m *Model) unsupportedParams() []string {
+	if m.currentSession == nil || m.currentProvider == nil {
+		return nil
+	}
+	req := provider.ChatRequest{Model: m.config.GetDefaultModel()}
+	applyParams(&req, m.currentSession.Params)
+	return provider.UnsupportedParams(m.currentProvider, req)
+}
+
+// paramWarning describes the session parameters the current model ignores,
+// e.g. "o3 ignores temperature, top_p"
+func (m *Model) paramWarning() string {
+	unsupported := m.unsupportedParams()
+	if len(unsupported) == 0 {
+		return ""
+	}
+	return m.config.GetDefaultModel() + " ignores " + strings.Join(unsupported, ", ")
+}
+
+// updateSettings handles updates in the settings view
+func (m *Model) updateSettings(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.settingsIndex > 0 {
+			m.settingsIndex--
+		}
+
+	case "down", "j":
+		if m.settingsIndex < len(store.ParamNames)-1 {
+			m.settingsIndex++
+		}
+
+	case "enter":
+		// Edit the selected parameter as a /set command
+		name := store.ParamNames[m.settingsIndex]
+		m.textarea.SetValue("/set " + name + " ")
+		m.currentView = ViewChat
+		m.textarea.Focus()
+
+	case "d":
+		// Reset the selected parameter
+		if m.currentSession != nil {
+			name := store.ParamNames[m.settingsIndex]
+			m.currentSession.Params.Unset(name)
+			if err := m.store.UpdateSession(m.currentSession); err != nil {
+				m.errorMessage = "Failed to save settings: " + err.Error()
+			}
+		}
+
+	case "esc", "q":
+		m.currentView = ViewChat
+		m.textarea.Focus()
+	}
+
+	return m, nil
+}
+
+// viewSettings renders the session's generation parameters
+func (m *Model) viewSettings() string {
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("⚙ Generation Settings"))
+	b.WriteString("\n\n")
+
+	if m.currentSession == nil {
+		b.WriteString(mutedStyle("No session selected."))
+		return modalStyle.Width(m.width - 4).Render(b.String())
+	}
+
+	b.WriteString(mutedStyle("Session: " + m.currentSession.Name + " · " +
+		m.config.GetDefaultProvider() + "/" + m.config.GetDefaultModel()))
+	b.WriteString("\n\n")
+
+	ignored := make(map[string]bool)
+	for _, name := range m.unsupportedParams() {
+		ignored[name] = true
+	}
+
+	for i, name := range store.ParamNames {
+		value := m.currentSession.Params.Get(name)
+		if value == "" {
+			value = mutedStyle("default")
+		}
+		item := padRight(name, 18) + value
+		if ignored[name] {
+			item += " " + warningStyle.Render("(ignored by this model)")
+		}
+
+		if i == m.settingsIndex {
+			b.WriteString(sessionSelectedStyle.Render("▶ " + item))
+		} else {
+			b.WriteString(sessionItemStyle.Render("  " + item))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(helpStyle.Render("↑/↓: Navigate | Enter: Edit | d: Reset to default | Esc: Back"))
+
+	return modalStyle.Width(m.width - 4).Render(b.String())
+}
+
+// padRight pads s with spaces to width
+func padRight(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-len(s))
+}
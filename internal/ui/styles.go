@@ -109,6 +109,11 @@ var (
 				Foreground(lipgloss.Color("230")).
 				Padding(0, 1)
 
+	sessionGroupStyle = lipgloss.NewStyle().
+				Foreground(secondaryColor).
+				Bold(true).
+				Padding(0, 1)
+
 	// Modal/overlay styles
 	modalStyle = lipgloss.NewStyle().
 			Border(lipgloss.RoundedBorder()).
@@ -165,6 +170,11 @@ var (
 					Foreground(lipgloss.Color("141")). // Purple
 					Padding(0, 1)
 
+	// Spending totals
+	costStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("114")). // Light green
+			Padding(0, 1)
+
 	// Gemini feature indicator (thinking and grounding)
 	geminiFeatureStyle = lipgloss.NewStyle().
 				Foreground(lipgloss.Color("39")). // Blue (Google blue)
@@ -215,6 +225,41 @@ var (
 				Foreground(lipgloss.Color("147")).
 				Bold(true).
 				SetString("📋 Summary")
+
+	// Tool call styles
+	toolLabelStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("215")). // Light orange
+			Bold(true)
+
+	toolMessageStyle = lipgloss.NewStyle().
+				Foreground(mutedColor)
+
+	// Response metadata shown under assistant messages
+	metaStyle = lipgloss.NewStyle().
+			Foreground(mutedColor).
+			Italic(true)
+
+	// Reasoning shown above assistant messages
+	thinkingLabelStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("147")).
+				Bold(true)
+
+	thinkingStyle = lipgloss.NewStyle().
+			Foreground(mutedColor).
+			Italic(true)
+
+	// Citations listed under grounded replies
+	footnoteStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("39")) // Light blue
+
+	// Version counter on edited prompts and regenerated replies
+	branchStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("180")) // Tan
+
+	// Marker on the message selected with Ctrl+Up/Down
+	selectedMarkerStyle = lipgloss.NewStyle().
+				Foreground(primaryColor).
+				Bold(true)
 )
 
 // TODO: Add theme support - light/dark mode switching
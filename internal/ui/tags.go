@@ -0,0 +1,230 @@
+package ui
+
+import (
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/user/openchat/internal/store"
+)
+
+// sessionGroup is a heading in the session switcher with the sessions under it
+type sessionGroup struct {
+	title    string
+	sessions []*store.Session
+}
+
+// sessionGroups returns the sessions shown in the switcher, filtered by the
+// selected tag: pinned sessions first, then each folder in alphabetical
+// order, then the sessions without a folder
+func (m *Model) sessionGroups() []sessionGroup {
+	var pinned, unfiled []*store.Session
+	folders := make(map[string][]*store.Session)
+	for _, session := range m.sessions {
+		if m.sessionTag != "" && !hasTag(session, m.sessionTag) {
+			continue
+		}
+		switch {
+		case session.Pinned:
+			pinned = append(pinned, session)
+		case session.Folder != "":
+			folders[session.Folder] = append(folders[session.Folder], session)
+		default:
+			unfiled = append(unfiled, session)
+		}
+	}
+
+	var groups []sessionGroup
+	if len(pinned) > 0 {
+		groups = append(groups, sessionGroup{title: "📌 Pinned", sessions: pinned})
+	}
+	names := make([]string, 0, len(folders))
+	for name := range folders {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+	for _, name := range names {
+		groups = append(groups, sessionGroup{title: "📁 " + name, sessions: folders[name]})
+	}
+	if len(unfiled) > 0 {
+		title := ""
+		if len(groups) > 0 {
+			title = "No folder"
+		}
+		groups = append(groups, sessionGroup{title: title, sessions: unfiled})
+	}
+	return groups
+}
+
+// visibleSessions returns the sessions shown in the switcher in display
+// order; sessionIndex indexes into it
+func (m *Model) visibleSessions() []*store.Session {
+	var sessions []*store.Session
+	for _, group := range m.sessionGroups() {
+		sessions = append(sessions, group.sessions...)
+	}
+	return sessions
+}
+
+// sessionTags returns every tag used by the loaded sessions, sorted
+func (m *Model) sessionTags() []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, session := range m.sessions {
+		for _, tag := range session.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// cycleSessionTag filters the switcher by the next tag, ending with no filter
+func (m *Model) cycleSessionTag() {
+	tags := m.sessionTags()
+	next := ""
+	if m.sessionTag == "" {
+		if len(tags) > 0 {
+			next = tags[0]
+		}
+	} else {
+		for i, tag := range tags {
+			if tag == m.sessionTag && i+1 < len(tags) {
+				next = tags[i+1]
+			}
+		}
+	}
+	m.sessionTag = next
+	m.sessionIndex = 0
+}
+
+// hasTag reports whether a session has a tag
+func hasTag(session *store.Session, tag string) bool {
+	for _, t := range session.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// cmdTag adds tags to the current session, or removes those prefixed with
+// '-'. Without arguments it shows the session's tags.
+func (m *Model) cmdTag(args []string) (tea.Model, tea.Cmd) {
+	if m.currentSession == nil {
+		m.errorMessage = "No session selected"
+		return m, nil
+	}
+
+	if len(args) == 0 {
+		if len(m.currentSession.Tags) == 0 {
+			m.statusMessage = "No tags. Usage: /tag <tag>... (prefix with - to remove)"
+		} else {
+			m.statusMessage = "Tags: #" + strings.Join(m.currentSession.Tags, " #")
+		}
+		return m, nil
+	}
+
+	var add, remove []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			remove = append(remove, arg[1:])
+		} else {
+			add = append(add, arg)
+		}
+	}
+	if err := m.store.AddTags(m.currentSession.ID, add...); err != nil {
+		m.errorMessage = "Failed to tag session: " + err.Error()
+		return m, nil
+	}
+	if err := m.store.RemoveTags(m.currentSession.ID, remove...); err != nil {
+		m.errorMessage = "Failed to untag session: " + err.Error()
+		return m, nil
+	}
+
+	session, err := m.store.GetSession(m.currentSession.ID)
+	if err != nil || session == nil {
+		m.errorMessage = "Failed to load session tags"
+		return m, nil
+	}
+	m.currentSession.Tags = session.Tags
+	return m.cmdTag(nil)
+}
+
+// cmdPin pins the current session to the top of the session switcher, or
+// unpins it
+func (m *Model) cmdPin() (tea.Model, tea.Cmd) {
+	if m.currentSession == nil {
+		m.errorMessage = "No session selected"
+		return m, nil
+	}
+	return m.togglePin(m.currentSession)
+}
+
+// togglePin pins or unpins a session
+func (m *Model) togglePin(session *store.Session) (tea.Model, tea.Cmd) {
+	if err := m.store.SetPinned(session.ID, !session.Pinned); err != nil {
+		m.errorMessage = "Failed to pin session: " + err.Error()
+		return m, nil
+	}
+	session.Pinned = !session.Pinned
+	if m.currentSession != nil && m.currentSession.ID == session.ID {
+		m.currentSession.Pinned = session.Pinned
+	}
+
+	if session.Pinned {
+		m.statusMessage = "Pinned " + session.Name
+	} else {
+		m.statusMessage = "Unpinned " + session.Name
+	}
+	return m, m.loadSessions()
+}
+
+// cmdFolder files the current session in a folder, or takes it out with
+// "off". Without arguments it lists the folders.
+func (m *Model) cmdFolder(args []string) (tea.Model, tea.Cmd) {
+	if m.currentSession == nil {
+		m.errorMessage = "No session selected"
+		return m, nil
+	}
+
+	if len(args) == 0 {
+		folders, err := m.store.ListFolders()
+		if err != nil {
+			m.errorMessage = "Failed to list folders: " + err.Error()
+			return m, nil
+		}
+		current := "none"
+		if m.currentSession.Folder != "" {
+			current = m.currentSession.Folder
+		}
+		m.statusMessage = "Folder: " + current
+		if len(folders) > 0 {
+			m.statusMessage += " · Folders: " + strings.Join(folders, ", ")
+		}
+		return m, nil
+	}
+
+	folder := strings.Join(args, " ")
+	if strings.ToLower(folder) == "off" {
+		folder = ""
+	}
+	if err := m.store.SetFolder(m.currentSession.ID, folder); err != nil {
+		m.errorMessage = "Failed to set folder: " + err.Error()
+		return m, nil
+	}
+	m.currentSession.Folder = folder
+
+	if folder == "" {
+		m.statusMessage = "Removed from folder"
+	} else {
+		m.statusMessage = "Moved to folder " + folder
+	}
+	return m, m.loadSessions()
+}
@@ -0,0 +1,25 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/user/openchat/internal/sanitize"
+)
+
+// renderThinking renders a reply's reasoning as a block above it: one
+// collapsed line with its length, or the full text when expanded with Ctrl+O
+func (m *Model) renderThinking(reasoning string) string {
+	reasoning = strings.TrimSpace(reasoning)
+	if reasoning == "" {
+		return ""
+	}
+
+	words := len(strings.Fields(reasoning))
+	if !m.showThinking {
+		return thinkingLabelStyle.Render(fmt.Sprintf("▸ Thinking (%d words)", words)) +
+			" " + metaStyle.Render("Ctrl+O to expand") + "\n"
+	}
+	return thinkingLabelStyle.Render("▾ Thinking") + " " + metaStyle.Render("Ctrl+O to collapse") + "\n" +
+		thinkingStyle.Render(sanitize.SanitizeForDisplay(reasoning)) + "\n"
+}
@@ -0,0 +1,209 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/user/openchat/internal/store"
+)
+
+// undoWindow is how long the undo toast is shown after a session is deleted
+const undoWindow = 10 * time.Second
+
+// Message types for the trash
+type trashLoadedMsg struct {
+	sessions []*store.Session
+	err      error
+}
+
+// undoExpiredMsg ends the undo window for a deleted session
+type undoExpiredMsg string
+
+// trashSession moves a session to the trash and shows an undo toast
+func (m *Model) trashSession(session *store.Session) (tea.Model, tea.Cmd) {
+	if err := m.store.TrashSession(session.ID); err != nil {
+		m.errorMessage = "Failed to delete session: " + err.Error()
+		return m, nil
+	}
+
+	m.undoSession = session
+	m.undoWasCurrent = m.currentSession != nil && m.currentSession.ID == session.ID
+	if m.undoWasCurrent {
+		m.currentSession = nil
+		m.messages = make([]*store.Message, 0)
+		m.branches = nil
+		m.selectedMessage = -1
+		m.editing = nil
+		m.refreshCosts()
+		m.updateViewportContent()
+	}
+	m.statusMessage = undoToast(session)
+
+	id := session.ID
+	return m, tea.Batch(m.loadSessions(), tea.Tick(undoWindow, func(time.Time) tea.Msg {
+		return undoExpiredMsg(id)
+	}))
+}
+
+// undoToast is the status shown while a deleted session can be restored
+func undoToast(session *store.Session) string {
+	return fmt.Sprintf("Moved %q to the trash (Ctrl+Z to undo)", session.Name)
+}
+
+// expireUndo ends the undo window for a session if it is still open
+func (m *Model) expireUndo(sessionID string) {
+	if m.undoSession == nil || m.undoSession.ID != sessionID {
+		return
+	}
+	if m.statusMessage == undoToast(m.undoSession) {
+		m.statusMessage = ""
+	}
+	m.undoSession = nil
+}
+
+// undoDelete restores the session deleted last, while its undo toast shows
+func (m *Model) undoDelete() (tea.Model, tea.Cmd) {
+	session := m.undoSession
+	if session == nil {
+		m.statusMessage = "Nothing to undo"
+		return m, nil
+	}
+	m.undoSession = nil
+
+	if err := m.store.RestoreSession(session.ID); err != nil {
+		m.errorMessage = "Failed to restore session: " + err.Error()
+		return m, nil
+	}
+	m.statusMessage = "Restored " + session.Name
+
+	cmds := []tea.Cmd{m.loadSessions()}
+	if m.undoWasCurrent && m.currentSession == nil {
+		cmds = append(cmds, m.loadSession(session.ID))
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// cmdTrash opens the trash view
+func (m *Model) cmdTrash() (tea.Model, tea.Cmd) {
+	m.currentView = ViewTrash
+	m.trashIndex = 0
+	m.trashConfirm = false
+	return m, m.loadTrash()
+}
+
+// loadTrash loads the sessions in the trash
+func (m *Model) loadTrash() tea.Cmd {
+	return func() tea.Msg {
+		sessions, err := m.store.ListTrash()
+		return trashLoadedMsg{sessions: sessions, err: err}
+	}
+}
+
+// updateTrash handles key events in the trash view
+func (m *Model) updateTrash(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	// Purging asks for a second press; any other key cancels it
+	confirmed := m.trashConfirm
+	m.trashConfirm = false
+
+	switch msg.String() {
+	case "up", "k":
+		if m.trashIndex > 0 {
+			m.trashIndex--
+		}
+
+	case "down", "j":
+		if m.trashIndex < len(m.trash)-1 {
+			m.trashIndex++
+		}
+
+	case "r", "enter":
+		// Restore the selected session
+		if m.trashIndex < len(m.trash) {
+			session := m.trash[m.trashIndex]
+			if err := m.store.RestoreSession(session.ID); err != nil {
+				m.errorMessage = "Failed to restore session: " + err.Error()
+				return m, nil
+			}
+			m.statusMessage = "Restored " + session.Name
+			return m, tea.Batch(m.loadTrash(), m.loadSessions())
+		}
+
+	case "p":
+		// Delete the selected session permanently
+		if m.trashIndex < len(m.trash) {
+			if !confirmed {
+				m.trashConfirm = true
+				return m, nil
+			}
+			session := m.trash[m.trashIndex]
+			if err := m.store.DeleteSession(session.ID); err != nil {
+				m.errorMessage = "Failed to purge session: " + err.Error()
+				return m, nil
+			}
+			m.statusMessage = "Deleted " + session.Name + " permanently"
+			return m, m.loadTrash()
+		}
+
+	case "q":
+		m.currentView = ViewChat
+		m.textarea.Focus()
+	}
+
+	return m, nil
+}
+
+// viewTrash renders the trash view
+func (m *Model) viewTrash() string {
+	var b strings.Builder
+
+	b.WriteString(sessionListTitleStyle.Render("🗑 Trash"))
+	b.WriteString("\n\n")
+
+	retention := m.config.GetTrashRetention()
+	if retention > 0 {
+		b.WriteString(mutedStyle(fmt.Sprintf("Deleted sessions are purged after %d days.", int(retention.Hours()/24))))
+		b.WriteString("\n\n")
+	}
+
+	if len(m.trash) == 0 {
+		b.WriteString(mutedStyle("The trash is empty."))
+	} else {
+		for i, session := range m.trash {
+			item := fmt.Sprintf("%s (%s/%s) - deleted %s",
+				session.Name,
+				session.Provider,
+				truncateString(session.Model, 20),
+				session.DeletedAt.Format("2006-01-02 15:04"),
+			)
+			if retention > 0 {
+				switch days := int(time.Until(session.DeletedAt.Add(retention)).Hours() / 24); {
+				case days <= 0:
+					item += ", purged soon"
+				case days == 1:
+					item += ", purged in 1 day"
+				default:
+					item += fmt.Sprintf(", purged in %d days", days)
+				}
+			}
+
+			if i == m.trashIndex {
+				b.WriteString(sessionSelectedStyle.Render("▶ " + item))
+			} else {
+				b.WriteString(sessionItemStyle.Render("  " + item))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("\n")
+	if m.trashConfirm && m.trashIndex < len(m.trash) {
+		b.WriteString(warningStyle.Render("Press p again to delete " + m.trash[m.trashIndex].Name + " permanently"))
+		b.WriteString("\n")
+	}
+	b.WriteString(helpStyle.Render("↑/↓: Navigate | r: Restore | p: Delete permanently | Esc: Back"))
+
+	return modalStyle.Width(m.width - 4).Render(b.String())
+}